@@ -0,0 +1,283 @@
+package keylight
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// BackupVersion is the version of the Backup format produced by this package.
+const BackupVersion = 1
+
+// A Backup is a versioned snapshot of the configuration of one or more Key
+// Light devices, suitable for storing as JSON.
+type Backup struct {
+	// Version is the version of the Backup format.
+	Version int `json:"version"`
+
+	// Created is the time at which the Backup was created.
+	Created time.Time `json:"created"`
+
+	// Devices contains the configuration of each device.
+	Devices []*DeviceBackup `json:"devices"`
+}
+
+// A DeviceBackup is the configuration of a single device in a Backup.
+type DeviceBackup struct {
+	// Device is the device's accessory information. Only the display name is
+	// restored; the remaining fields identify the device.
+	Device *Device `json:"device"`
+
+	// Lights is the state of the device's lights.
+	Lights []*Light `json:"lights"`
+
+	// Settings is the device's persistent light settings.
+	Settings *LightSettings `json:"settings"`
+}
+
+// CreateBackup creates a Backup of the configuration of the devices of
+// clients. If any device fails, it returns a *GroupError.
+func CreateBackup(ctx context.Context, clients []*Client) (*Backup, error) {
+	b := &Backup{
+		Version: BackupVersion,
+		Created: time.Now().UTC(),
+		Devices: make([]*DeviceBackup, len(clients)),
+	}
+
+	results := NewGroup(clients, nil).each(ctx, func(ctx context.Context, i int, c *Client, r *GroupResult) {
+		d, err := c.AccessoryInfo(ctx)
+		if err != nil {
+			r.Err = err
+			return
+		}
+
+		lights, err := c.Lights(ctx)
+		if err != nil {
+			r.Err = err
+			return
+		}
+		r.Lights = lights
+
+		s, err := c.Settings(ctx)
+		if err != nil {
+			r.Err = err
+			return
+		}
+
+		b.Devices[i] = &DeviceBackup{
+			Device:   d,
+			Lights:   lights,
+			Settings: s,
+		}
+	})
+	if err := groupError(results); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// A RestoreConfig configures Restore. A nil *RestoreConfig applies default
+// settings.
+type RestoreConfig struct {
+	// DryRun reports the Changes which would be made to a device without
+	// applying them.
+	DryRun bool
+
+	// SerialNumber, if set, selects the device in the Backup to restore
+	// instead of matching the serial number of the target device. This allows
+	// restoring a Backup to a different device, such as a replacement.
+	SerialNumber string
+}
+
+// A Change is a difference between the configuration of a device and a
+// Backup.
+type Change struct {
+	// Field describes the value which differs, such as "light 0 brightness".
+	Field string
+
+	// Current and Backup are the current and backed up values.
+	Current, Backup string
+}
+
+// String returns the string representation of a Change.
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Field, c.Current, c.Backup)
+}
+
+// Restore restores the device configuration in Backup b whose serial number
+// matches the device, and returns the Changes made to the device. If cfg
+// enables DryRun, the Changes are reported but not applied.
+func (c *Client) Restore(ctx context.Context, b *Backup, cfg *RestoreConfig) ([]Change, error) {
+	if cfg == nil {
+		cfg = &RestoreConfig{}
+	}
+
+	if b.Version != BackupVersion {
+		return nil, fmt.Errorf("backup version (%d) is not supported", b.Version)
+	}
+
+	d, err := c.AccessoryInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	serial := cfg.SerialNumber
+	if serial == "" {
+		serial = d.SerialNumber
+	}
+
+	var db *DeviceBackup
+	for _, v := range b.Devices {
+		if v.Device != nil && v.Device.SerialNumber == serial {
+			db = v
+			break
+		}
+	}
+	if db == nil {
+		return nil, fmt.Errorf("backup does not contain device %q", serial)
+	}
+
+	if err := validateLights(db.Lights); err != nil {
+		return nil, err
+	}
+
+	lights, err := c.Lights(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(lights) != len(db.Lights) {
+		return nil, &LightCountError{
+			Configured: len(db.Lights),
+			Present:    len(lights),
+		}
+	}
+
+	s, err := c.Settings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		nameChanges     = diffDevice(d, db.Device)
+		lightChanges    = diffLights(lights, db.Lights)
+		settingsChanges = diffSettings(s, db.Settings)
+	)
+
+	changes := append(append(nameChanges, lightChanges...), settingsChanges...)
+	if cfg.DryRun {
+		return changes, nil
+	}
+
+	if len(nameChanges) > 0 {
+		if err := c.SetDisplayName(ctx, db.Device.DisplayName); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(settingsChanges) > 0 {
+		if err := c.SetSettings(ctx, db.Settings); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(lightChanges) > 0 {
+		if err := c.SetLights(ctx, db.Lights); err != nil {
+			return nil, err
+		}
+	}
+
+	return changes, nil
+}
+
+// diffDevice reports the differences between the restorable fields of the
+// current and backed up accessory information. An empty display name in the
+// backup is treated as unchanged, since devices cannot be given an empty name.
+func diffDevice(current, backup *Device) []Change {
+	if backup == nil || backup.DisplayName == "" || current.DisplayName == backup.DisplayName {
+		return nil
+	}
+
+	return []Change{{
+		Field:   "display name",
+		Current: fmt.Sprintf("%q", current.DisplayName),
+		Backup:  fmt.Sprintf("%q", backup.DisplayName),
+	}}
+}
+
+// diffLights reports the differences between the current and backed up
+// lights, which must be of equal length.
+func diffLights(current, backup []*Light) []Change {
+	var changes []Change
+	for i := range current {
+		a, b := current[i], backup[i]
+		add := func(field string, av, bv interface{}) {
+			changes = append(changes, Change{
+				Field:   fmt.Sprintf("light %d %s", i, field),
+				Current: fmt.Sprint(av),
+				Backup:  fmt.Sprint(bv),
+			})
+		}
+
+		if a.On != b.On {
+			add("on", a.On, b.On)
+		}
+		if a.Brightness != b.Brightness {
+			add("brightness", fmt.Sprintf("%d%%", a.Brightness), fmt.Sprintf("%d%%", b.Brightness))
+		}
+
+		switch {
+		case a.Mode != b.Mode:
+			add("color", lightColor(a), lightColor(b))
+		case b.Mode == ColorModeTemperature && a.rawTemperature() != b.rawTemperature():
+			add("temperature", lightColor(a), lightColor(b))
+		case b.Mode == ColorModeHueSaturation && (a.Hue != b.Hue || a.Saturation != b.Saturation):
+			add("color", lightColor(a), lightColor(b))
+		}
+	}
+
+	return changes
+}
+
+// lightColor returns a description of the color of l.
+func lightColor(l *Light) string {
+	if l.Mode == ColorModeHueSaturation {
+		return fmt.Sprintf("hue %.1f, saturation %.1f%%", l.Hue, l.Saturation)
+	}
+
+	return fmt.Sprintf("%dK (raw %d)", l.Temperature, l.rawTemperature())
+}
+
+// settingsTemperature returns a description of the power on color temperature
+// of s.
+func settingsTemperature(s *LightSettings) string {
+	return fmt.Sprintf("%dK (raw %d)", s.PowerOnTemperature, s.powerOnRawTemperature())
+}
+
+// diffSettings reports the differences between the current and backed up
+// light settings.
+func diffSettings(current, backup *LightSettings) []Change {
+	if backup == nil {
+		return nil
+	}
+
+	var changes []Change
+	add := func(field string, av, bv interface{}) {
+		if av != bv {
+			changes = append(changes, Change{
+				Field:   "settings " + field,
+				Current: fmt.Sprint(av),
+				Backup:  fmt.Sprint(bv),
+			})
+		}
+	}
+
+	add("power on behavior", current.PowerOnBehavior, backup.PowerOnBehavior)
+	add("power on brightness", current.PowerOnBrightness, backup.PowerOnBrightness)
+	add("power on temperature", settingsTemperature(current), settingsTemperature(backup))
+	add("switch on duration", current.SwitchOnDuration, backup.SwitchOnDuration)
+	add("switch off duration", current.SwitchOffDuration, backup.SwitchOffDuration)
+	add("color change duration", current.ColorChangeDuration, backup.ColorChangeDuration)
+
+	return changes
+}
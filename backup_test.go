@@ -0,0 +1,195 @@
+package keylight_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/keylight"
+)
+
+func TestBackupRestore(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	devices, clients := testSceneDevices(t, 2)
+	c := clients[0]
+
+	if err := c.SetDisplayName(ctx, "Office"); err != nil {
+		t.Fatalf("failed to set display name: %v", err)
+	}
+
+	// Use a power on temperature which does not survive a round trip through
+	// Kelvin, which must be backed up and restored exactly.
+	settings, err := c.Settings(ctx)
+	if err != nil {
+		t.Fatalf("failed to fetch settings: %v", err)
+	}
+	settings.PowerOnTemperature, settings.PowerOnRawTemperature = 0, 291
+	if err := c.SetSettings(ctx, settings); err != nil {
+		t.Fatalf("failed to set settings: %v", err)
+	}
+
+	b, err := keylight.CreateBackup(ctx, clients)
+	if err != nil {
+		t.Fatalf("failed to create backup: %v", err)
+	}
+
+	// Backups round-trip through JSON.
+	buf, err := json.Marshal(b)
+	if err != nil {
+		t.Fatalf("failed to marshal backup: %v", err)
+	}
+	b = new(keylight.Backup)
+	if err := json.Unmarshal(buf, b); err != nil {
+		t.Fatalf("failed to unmarshal backup: %v", err)
+	}
+
+	wantLights := devices[0].Lights()
+	wantSettings := devices[0].Settings()
+
+	// Simulate a factory reset.
+	if err := c.SetDisplayName(ctx, "Elgato Key Light"); err != nil {
+		t.Fatalf("failed to set display name: %v", err)
+	}
+	if err := c.SetLights(ctx, []*keylight.Light{{On: true, Brightness: 100, Temperature: 7000}}); err != nil {
+		t.Fatalf("failed to set lights: %v", err)
+	}
+	s := *wantSettings
+	s.SwitchOnDuration = time.Second
+	s.PowerOnTemperature, s.PowerOnRawTemperature = 0, 290
+	if err := c.SetSettings(ctx, &s); err != nil {
+		t.Fatalf("failed to set settings: %v", err)
+	}
+
+	wantChanges := []keylight.Change{
+		{Field: "display name", Current: `"Elgato Key Light"`, Backup: `"Office"`},
+		{Field: "light 0 on", Current: "true", Backup: "false"},
+		{Field: "light 0 brightness", Current: "100%", Backup: "20%"},
+		{Field: "light 0 temperature", Current: "7000K (raw 143)", Backup: "5550K (raw 214)"},
+		{Field: "settings power on temperature", Current: "4000K (raw 290)", Backup: "4000K (raw 291)"},
+		{Field: "settings switch on duration", Current: "1s", Backup: "0s"},
+	}
+
+	changes, err := c.Restore(ctx, b, &keylight.RestoreConfig{DryRun: true})
+	if err != nil {
+		t.Fatalf("failed to perform dry run: %v", err)
+	}
+
+	if diff := cmp.Diff(wantChanges, changes); diff != "" {
+		t.Fatalf("unexpected dry run changes (-want +got):\n%s", diff)
+	}
+
+	// A dry run does not modify the device.
+	if diff := cmp.Diff("Elgato Key Light", devices[0].AccessoryInfo().DisplayName); diff != "" {
+		t.Fatalf("unexpected display name after dry run (-want +got):\n%s", diff)
+	}
+
+	if _, err := c.Restore(ctx, b, nil); err != nil {
+		t.Fatalf("failed to restore: %v", err)
+	}
+
+	if diff := cmp.Diff("Office", devices[0].AccessoryInfo().DisplayName); diff != "" {
+		t.Fatalf("unexpected display name (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(wantLights, devices[0].Lights()); diff != "" {
+		t.Fatalf("unexpected lights (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(wantSettings, devices[0].Settings()); diff != "" {
+		t.Fatalf("unexpected settings (-want +got):\n%s", diff)
+	}
+
+	// Restoring again makes no changes.
+	changes, err = c.Restore(ctx, b, nil)
+	if err != nil {
+		t.Fatalf("failed to restore: %v", err)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("expected no changes, but got: %v", changes)
+	}
+
+	// Restore to a replacement device by selecting the original's serial.
+	changes, err = clients[1].Restore(ctx, b, &keylight.RestoreConfig{SerialNumber: "SN0"})
+	if err != nil {
+		t.Fatalf("failed to restore to replacement: %v", err)
+	}
+
+	want := []keylight.Change{
+		{Field: "display name", Current: `""`, Backup: `"Office"`},
+		{Field: "settings power on temperature", Current: "5550K (raw 214)", Backup: "4000K (raw 291)"},
+	}
+	if diff := cmp.Diff(want, changes); diff != "" {
+		t.Fatalf("unexpected replacement changes (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff("Office", devices[1].AccessoryInfo().DisplayName); diff != "" {
+		t.Fatalf("unexpected replacement display name (-want +got):\n%s", diff)
+	}
+
+	// A backup without a display name leaves the device's name unchanged.
+	b.Devices[0].Device.DisplayName = ""
+	changes, err = c.Restore(ctx, b, nil)
+	if err != nil {
+		t.Fatalf("failed to restore without display name: %v", err)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("expected no changes, but got: %v", changes)
+	}
+	if diff := cmp.Diff("Office", devices[0].AccessoryInfo().DisplayName); diff != "" {
+		t.Fatalf("unexpected display name (-want +got):\n%s", diff)
+	}
+}
+
+func TestRestoreErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		b    *keylight.Backup
+		err  string
+	}{
+		{
+			name: "version",
+			b:    &keylight.Backup{Version: 2},
+			err:  "backup version (2) is not supported",
+		},
+		{
+			name: "no device",
+			b: &keylight.Backup{
+				Version: keylight.BackupVersion,
+				Devices: []*keylight.DeviceBackup{{
+					Device: &keylight.Device{SerialNumber: "OTHER"},
+				}},
+			},
+			err: `backup does not contain device "SN0"`,
+		},
+		{
+			name: "light count",
+			b: &keylight.Backup{
+				Version: keylight.BackupVersion,
+				Devices: []*keylight.DeviceBackup{{
+					Device: &keylight.Device{SerialNumber: "SN0"},
+				}},
+			},
+			err: "attempted to configure 0 lights, but 1 are present",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			_, clients := testSceneDevices(t, 1)
+
+			_, err := clients[0].Restore(ctx, tt.b, nil)
+			if err == nil {
+				t.Fatal("an error was expected, but none occurred")
+			}
+
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
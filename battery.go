@@ -0,0 +1,173 @@
+package keylight
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+)
+
+var (
+	_ json.Marshaler   = &BatterySettings{}
+	_ json.Unmarshaler = &BatterySettings{}
+)
+
+// PowerSource is the power source of a battery-powered device such as the
+// Key Light Mini.
+type PowerSource int
+
+// Possible PowerSource values for use in a BatteryInfo.
+const (
+	PowerSourceBattery  PowerSource = 1
+	PowerSourceExternal PowerSource = 2
+)
+
+// BatteryStatus is the charging state of a device's battery.
+type BatteryStatus int
+
+// Possible BatteryStatus values for use in a BatteryInfo.
+const (
+	BatteryDischarging BatteryStatus = 0
+	BatteryCharging    BatteryStatus = 1
+	BatteryFull        BatteryStatus = 2
+)
+
+// A BatteryInfo contains the status of a battery-powered device such as the
+// Key Light Mini.
+type BatteryInfo struct {
+	// PowerSource is the device's current power source.
+	PowerSource PowerSource `json:"powerSource"`
+
+	// Level is the battery charge level as a percentage.
+	Level float64 `json:"level"`
+
+	// Status is the battery's charging state.
+	Status BatteryStatus `json:"status"`
+
+	// Voltage is the battery voltage in millivolts.
+	Voltage int `json:"currentBatteryVoltage"`
+
+	// InputVoltage and InputCurrent are the charging input voltage and
+	// current in millivolts and milliamps.
+	InputVoltage int `json:"inputChargeVoltage"`
+	InputCurrent int `json:"inputChargeCurrent"`
+}
+
+// BatteryInfo fetches the battery status of a battery-powered device. Devices
+// without a battery will return an error.
+func (c *Client) BatteryInfo(ctx context.Context) (*BatteryInfo, error) {
+	var b BatteryInfo
+	if err := c.do(ctx, http.MethodGet, "/elgato/battery-info", nil, &b); err != nil {
+		return nil, err
+	}
+
+	return &b, nil
+}
+
+// BatterySettings are the energy saving settings of a battery-powered device.
+type BatterySettings struct {
+	// EnergySaving enables energy saving mode when the battery level drops
+	// to MinimumBatteryLevel, with a valid range of 0-100.
+	EnergySaving        bool
+	MinimumBatteryLevel float64
+
+	// DisableWiFi disables Wi-Fi while in energy saving mode.
+	DisableWiFi bool
+
+	// AdjustBrightness reduces the brightness of the lights to Brightness
+	// while in energy saving mode, with a valid range of 3-100.
+	AdjustBrightness bool
+	Brightness       int
+
+	// Bypass powers the device directly from an external power source
+	// rather than through its battery.
+	Bypass bool
+}
+
+// A jsonBatterySettings is the raw JSON representation of BatterySettings.
+type jsonBatterySettings struct {
+	EnergySaving struct {
+		Enable              int     `json:"enable"`
+		MinimumBatteryLevel float64 `json:"minimumBatteryLevel"`
+		DisableWiFi         int     `json:"disableWifi"`
+		AdjustBrightness    struct {
+			Enable     int     `json:"enable"`
+			Brightness float64 `json:"brightness"`
+		} `json:"adjustBrightness"`
+	} `json:"energySaving"`
+	Bypass int `json:"bypass"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s *BatterySettings) MarshalJSON() ([]byte, error) {
+	var js jsonBatterySettings
+	js.EnergySaving.Enable = boolToInt(s.EnergySaving)
+	js.EnergySaving.MinimumBatteryLevel = s.MinimumBatteryLevel
+	js.EnergySaving.DisableWiFi = boolToInt(s.DisableWiFi)
+	js.EnergySaving.AdjustBrightness.Enable = boolToInt(s.AdjustBrightness)
+	js.EnergySaving.AdjustBrightness.Brightness = float64(s.Brightness)
+	js.Bypass = boolToInt(s.Bypass)
+
+	return json.Marshal(js)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *BatterySettings) UnmarshalJSON(b []byte) error {
+	var js jsonBatterySettings
+	if err := json.Unmarshal(b, &js); err != nil {
+		return err
+	}
+
+	*s = BatterySettings{
+		EnergySaving:        js.EnergySaving.Enable == 1,
+		MinimumBatteryLevel: js.EnergySaving.MinimumBatteryLevel,
+		DisableWiFi:         js.EnergySaving.DisableWiFi == 1,
+		AdjustBrightness:    js.EnergySaving.AdjustBrightness.Enable == 1,
+		Brightness:          int(math.Round(js.EnergySaving.AdjustBrightness.Brightness)),
+		Bypass:              js.Bypass == 1,
+	}
+
+	return nil
+}
+
+// BatterySettings fetches the energy saving settings of a battery-powered
+// device. Devices without a battery will return an error.
+func (c *Client) BatterySettings(ctx context.Context) (*BatterySettings, error) {
+	var s BatterySettings
+	if err := c.do(ctx, http.MethodGet, "/elgato/battery/settings", nil, &s); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// SetBatterySettings updates the energy saving settings of a battery-powered
+// device.
+func (c *Client) SetBatterySettings(ctx context.Context, s *BatterySettings) error {
+	if err := checkRange("minimum battery level", s.MinimumBatteryLevel, 0, 100); err != nil {
+		return err
+	}
+
+	// Brightness is only meaningful when it will be applied.
+	if s.AdjustBrightness {
+		if err := checkRange("energy saving brightness", s.Brightness, BrightnessMin, BrightnessMax); err != nil {
+			return err
+		}
+	}
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	return c.do(ctx, http.MethodPut, "/elgato/battery/settings", b, nil)
+}
+
+// boolToInt converts b to the integer representation used by the API.
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+
+	return 0
+}
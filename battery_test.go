@@ -0,0 +1,167 @@
+package keylight_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/keylight"
+)
+
+func TestClientBatteryInfo(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if diff := cmp.Diff(http.MethodGet, r.Method); diff != "" {
+			panicf("unexpected HTTP method (-want +got):\n%s", diff)
+		}
+
+		if diff := cmp.Diff("/elgato/battery-info", r.URL.Path); diff != "" {
+			panicf("unexpected URL path (-want +got):\n%s", diff)
+		}
+
+		// Raw output from a Key Light Mini device.
+		_, _ = io.WriteString(w, `{"powerSource":1,"level":86.67,"status":1,"currentBatteryVoltage":3912,"inputChargeVoltage":4790,"inputChargeCurrent":2960}`)
+	})
+
+	got, err := c.BatteryInfo(ctx)
+	if err != nil {
+		t.Fatalf("failed to fetch battery info: %v", err)
+	}
+
+	want := &keylight.BatteryInfo{
+		PowerSource:  keylight.PowerSourceBattery,
+		Level:        86.67,
+		Status:       keylight.BatteryCharging,
+		Voltage:      3912,
+		InputVoltage: 4790,
+		InputCurrent: 2960,
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected battery info (-want +got):\n%s", diff)
+	}
+}
+
+func TestClientBatterySettings(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if diff := cmp.Diff(http.MethodGet, r.Method); diff != "" {
+			panicf("unexpected HTTP method (-want +got):\n%s", diff)
+		}
+
+		if diff := cmp.Diff("/elgato/battery/settings", r.URL.Path); diff != "" {
+			panicf("unexpected URL path (-want +got):\n%s", diff)
+		}
+
+		_, _ = io.WriteString(w, `{"energySaving":{"enable":1,"minimumBatteryLevel":15.0,"disableWifi":0,"adjustBrightness":{"enable":1,"brightness":10.0}},"bypass":0}`)
+	})
+
+	got, err := c.BatterySettings(ctx)
+	if err != nil {
+		t.Fatalf("failed to fetch battery settings: %v", err)
+	}
+
+	want := &keylight.BatterySettings{
+		EnergySaving:        true,
+		MinimumBatteryLevel: 15,
+		AdjustBrightness:    true,
+		Brightness:          10,
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected battery settings (-want +got):\n%s", diff)
+	}
+}
+
+func TestClientSetBatterySettings(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings *keylight.BatterySettings
+		body     string
+		check    func(t *testing.T, err error)
+	}{
+		{
+			name: "OK",
+			settings: &keylight.BatterySettings{
+				EnergySaving:        true,
+				MinimumBatteryLevel: 20,
+				DisableWiFi:         true,
+				Bypass:              true,
+			},
+			body: `{"energySaving":{"enable":1,"minimumBatteryLevel":20,"disableWifi":1,"adjustBrightness":{"enable":0,"brightness":0}},"bypass":1}`,
+		},
+		{
+			name: "minimum battery level outside of range",
+			settings: &keylight.BatterySettings{
+				EnergySaving:        true,
+				MinimumBatteryLevel: 101,
+			},
+			check: func(t *testing.T, err error) {
+				if !strings.Contains(err.Error(), "minimum battery level (101) out of range 0 <= x <= 100") {
+					t.Fatalf("error did not mention malformed battery level input: %v", err)
+				}
+			},
+		},
+		{
+			name: "brightness outside of range",
+			settings: &keylight.BatterySettings{
+				AdjustBrightness: true,
+				Brightness:       1,
+			},
+			check: func(t *testing.T, err error) {
+				if !strings.Contains(err.Error(), "energy saving brightness (1) out of range 3 <= x <= 100") {
+					t.Fatalf("error did not mention malformed brightness input: %v", err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+			defer cancel()
+
+			var got string
+			c := testClient(t, func(_ http.ResponseWriter, r *http.Request) {
+				if diff := cmp.Diff(http.MethodPut, r.Method); diff != "" {
+					panicf("unexpected HTTP method (-want +got):\n%s", diff)
+				}
+
+				if diff := cmp.Diff("/elgato/battery/settings", r.URL.Path); diff != "" {
+					panicf("unexpected URL path (-want +got):\n%s", diff)
+				}
+
+				b, err := io.ReadAll(r.Body)
+				if err != nil {
+					panicf("failed to read body: %v", err)
+				}
+				got = string(b)
+			})
+
+			err := c.SetBatterySettings(ctx, tt.settings)
+			if err == nil && tt.check != nil {
+				t.Fatal("an error was expected, but none occurred")
+			}
+			if err != nil {
+				if tt.check == nil {
+					t.Fatalf("failed to set battery settings: %v", err)
+				}
+
+				tt.check(t, err)
+				return
+			}
+
+			if diff := cmp.Diff(tt.body, got); diff != "" {
+				t.Fatalf("unexpected request body (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,289 @@
+// Package circadian adjusts the color temperature and brightness of Elgato
+// Key Light devices to follow the sun, using sunrise and sunset times computed
+// locally from a latitude and longitude.
+package circadian
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/mdlayher/keylight"
+)
+
+// nightElevation is the elevation of the sun in degrees at and below which the
+// night values of a Curve apply, corresponding to the end of civil twilight.
+const nightElevation = -6
+
+// A Curve maps a time of day at a location to a color temperature and
+// brightness.
+type Curve struct {
+	// Latitude and Longitude are the location in degrees. Longitudes east of
+	// the prime meridian are positive.
+	Latitude, Longitude float64
+
+	// NightTemperature and DayTemperature are the color temperatures in
+	// Kelvin applied at night and at solar noon, in the range 2900-7000K. If
+	// zero, 2900K and 6500K are used.
+	NightTemperature, DayTemperature int
+
+	// NightBrightness and DayBrightness are the brightness percentages applied
+	// at night and at solar noon, in the range 3-100. If both are zero,
+	// brightness is not changed.
+	NightBrightness, DayBrightness int
+}
+
+// At computes the color temperature in Kelvin and brightness percentage for
+// time t. Values change smoothly from their night values at the end of civil
+// twilight to their day values when the sun is highest in the sky, and are
+// clamped to the ranges accepted by devices. If the Curve does not change
+// brightness, brightness is zero.
+func (c *Curve) At(t time.Time) (temperature, brightness int) {
+	night, day := c.NightTemperature, c.DayTemperature
+	if night == 0 {
+		night = keylight.TemperatureMin
+	}
+	if day == 0 {
+		day = 6500
+	}
+	night = max(keylight.TemperatureMin, min(night, keylight.TemperatureMax))
+	day = max(keylight.TemperatureMin, min(day, keylight.TemperatureMax))
+
+	// The sun may never reach the day values at high latitudes in winter, so
+	// progress is relative to the highest elevation it reaches on that date.
+	var f float64
+	peak := Elevation(Sun(t, c.Latitude, c.Longitude).Noon, c.Latitude, c.Longitude)
+	if peak > nightElevation {
+		e := Elevation(t, c.Latitude, c.Longitude)
+		f = (e - nightElevation) / (peak - nightElevation)
+		f = math.Max(0, math.Min(1, f))
+
+		// Smoothstep.
+		f = f * f * (3 - 2*f)
+	}
+
+	temperature = int(math.Round((float64(night)+float64(day-night)*f)/50)) * 50
+	temperature = max(keylight.TemperatureMin, min(temperature, keylight.TemperatureMax))
+
+	if c.NightBrightness != 0 || c.DayBrightness != 0 {
+		brightness = int(math.Round(float64(c.NightBrightness) + float64(c.DayBrightness-c.NightBrightness)*f))
+		brightness = max(keylight.BrightnessMin, min(brightness, keylight.BrightnessMax))
+	}
+
+	return temperature, brightness
+}
+
+// A Config configures a Scheduler.
+type Config struct {
+	// Curve determines the color temperature and brightness applied over the
+	// course of the day.
+	Curve Curve
+
+	// Interval is the interval at which the Curve is applied. If zero, one
+	// minute is used.
+	Interval time.Duration
+
+	// Pause is the duration for which the Scheduler stops adjusting a device
+	// after detecting a manual change to its lights. If zero, one hour is
+	// used.
+	Pause time.Duration
+
+	// Now, if set, returns the current time. If nil, time.Now is used.
+	Now func() time.Time
+
+	// Logger, if set, logs failures to apply the Curve by Run.
+	Logger *slog.Logger
+}
+
+// A Scheduler periodically applies a Curve to the lights of a Key Light
+// device.
+//
+// Only lights which are on and in keylight.ColorModeTemperature are adjusted,
+// so a light which is turned off or set to a color stays that way. If the
+// temperature or brightness of a light is changed by another controller, the
+// Scheduler pauses for the configured duration before resuming.
+type Scheduler struct {
+	c     *keylight.Client
+	curve Curve
+	pause time.Duration
+	every time.Duration
+	now   func() time.Time
+	ll    *slog.Logger
+
+	mu          sync.Mutex
+	applied     []*keylight.Light
+	pausedUntil time.Time
+}
+
+// New creates a Scheduler which adjusts the lights of the device controlled by
+// c, as configured by cfg.
+func New(c *keylight.Client, cfg Config) (*Scheduler, error) {
+	if lat := cfg.Curve.Latitude; lat < -90 || lat > 90 {
+		return nil, fmt.Errorf("latitude (%v) out of range -90 <= x <= 90", lat)
+	}
+	if lon := cfg.Curve.Longitude; lon < -180 || lon > 180 {
+		return nil, fmt.Errorf("longitude (%v) out of range -180 <= x <= 180", lon)
+	}
+
+	curve := cfg.Curve
+	for _, v := range []struct {
+		field    string
+		v        int
+		min, max int
+		optional bool
+	}{
+		// Temperatures default when zero, and brightness is only changed if
+		// either value is set.
+		{"night temperature", curve.NightTemperature, keylight.TemperatureMin, keylight.TemperatureMax, true},
+		{"day temperature", curve.DayTemperature, keylight.TemperatureMin, keylight.TemperatureMax, true},
+		{"night brightness", curve.NightBrightness, keylight.BrightnessMin, keylight.BrightnessMax, curve.DayBrightness == 0},
+		{"day brightness", curve.DayBrightness, keylight.BrightnessMin, keylight.BrightnessMax, curve.NightBrightness == 0},
+	} {
+		if v.optional && v.v == 0 {
+			continue
+		}
+		if v.v < v.min || v.v > v.max {
+			return nil, &keylight.RangeError{
+				Field: v.field,
+				Value: float64(v.v),
+				Min:   float64(v.min),
+				Max:   float64(v.max),
+			}
+		}
+	}
+
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Minute
+	}
+	if cfg.Pause <= 0 {
+		cfg.Pause = time.Hour
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+
+	return &Scheduler{
+		c:     c,
+		curve: cfg.Curve,
+		pause: cfg.Pause,
+		every: cfg.Interval,
+		now:   cfg.Now,
+		ll:    cfg.Logger,
+	}, nil
+}
+
+// Run applies the Curve immediately and then at each interval until ctx is
+// canceled, at which point it returns ctx.Err(). Errors from individual
+// updates, such as when the device is unreachable, do not stop the Scheduler
+// and the update is retried at the next interval. Use Config.Logger to
+// observe them.
+func (s *Scheduler) Run(ctx context.Context) error {
+	t := time.NewTicker(s.every)
+	defer t.Stop()
+
+	for {
+		if err := s.Apply(ctx); err != nil && ctx.Err() == nil && s.ll != nil {
+			s.ll.Warn("failed to apply curve", slog.String("addr", s.c.Addr()), slog.String("error", err.Error()))
+		}
+
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Paused reports whether the Scheduler is paused after a manual change, and
+// if so, when it will resume.
+func (s *Scheduler) Paused() (until time.Time, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.pausedUntil, s.now().Before(s.pausedUntil)
+}
+
+// Apply applies the Curve for the current time to the device's lights once,
+// unless the Scheduler is paused or detects a manual change.
+func (s *Scheduler) Apply(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Before(s.pausedUntil) {
+		return nil
+	}
+
+	lights, err := s.c.Lights(ctx)
+	if err != nil {
+		return err
+	}
+
+	if s.applied != nil && overridden(s.applied, lights) {
+		// Somebody else changed the lights since the last update.
+		s.pausedUntil = now.Add(s.pause)
+		s.applied = nil
+		return nil
+	}
+
+	temperature, brightness := s.curve.At(now)
+
+	var updates []*keylight.LightUpdate
+	for i, l := range lights {
+		if !l.On || l.Mode != keylight.ColorModeTemperature {
+			continue
+		}
+
+		u := &keylight.LightUpdate{Index: i}
+		if l.Temperature != temperature {
+			u.Temperature = &temperature
+		}
+		if brightness != 0 && l.Brightness != brightness {
+			u.Brightness = &brightness
+		}
+
+		if u.Temperature != nil || u.Brightness != nil {
+			updates = append(updates, u)
+		}
+	}
+
+	if len(updates) == 0 {
+		s.applied = lights
+		return nil
+	}
+
+	applied, err := s.c.UpdateLights(ctx, updates...)
+	if err != nil {
+		// The state of the lights is unknown.
+		s.applied = nil
+		return err
+	}
+
+	s.applied = applied
+	return nil
+}
+
+// overridden reports whether the color temperature or brightness of any light
+// which is on changed between the prev and curr states.
+func overridden(prev, curr []*keylight.Light) bool {
+	if len(prev) != len(curr) {
+		return true
+	}
+
+	for i := range curr {
+		a, b := prev[i], curr[i]
+		if !a.On || !b.On {
+			// Turning a light on or off is not a manual change to its color.
+			continue
+		}
+
+		if a.Mode != b.Mode || a.Brightness != b.Brightness || a.RawTemperature != b.RawTemperature {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,245 @@
+package circadian_test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/keylight"
+	"github.com/mdlayher/keylight/circadian"
+	"github.com/mdlayher/keylight/keylighttest"
+)
+
+var london = circadian.Curve{Latitude: 51.5074, Longitude: -0.1278}
+
+func TestCurveAt(t *testing.T) {
+	bst := time.FixedZone("BST", 1*60*60)
+
+	tests := []struct {
+		name                    string
+		curve                   circadian.Curve
+		at                      time.Time
+		temperature, brightness int
+	}{
+		{
+			name:        "night",
+			curve:       london,
+			at:          time.Date(2024, time.June, 21, 1, 0, 0, 0, bst),
+			temperature: 2900,
+		},
+		{
+			name:        "noon",
+			curve:       london,
+			at:          circadian.Sun(time.Date(2024, time.June, 21, 0, 0, 0, 0, bst), london.Latitude, london.Longitude).Noon,
+			temperature: 6500,
+		},
+		{
+			name:        "evening",
+			curve:       london,
+			at:          time.Date(2024, time.June, 21, 20, 0, 0, 0, bst),
+			temperature: 3400,
+		},
+		{
+			name: "clamped with brightness",
+			curve: circadian.Curve{
+				Latitude:         london.Latitude,
+				Longitude:        london.Longitude,
+				NightTemperature: 1000,
+				DayTemperature:   9000,
+				NightBrightness:  10,
+				DayBrightness:    60,
+			},
+			at:          time.Date(2024, time.June, 21, 1, 0, 0, 0, bst),
+			temperature: 2900,
+			brightness:  10,
+		},
+		{
+			name: "minimum brightness",
+			curve: circadian.Curve{
+				Latitude:      london.Latitude,
+				Longitude:     london.Longitude,
+				DayBrightness: 80,
+			},
+			at:          time.Date(2024, time.June, 21, 1, 0, 0, 0, bst),
+			temperature: 2900,
+			brightness:  3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			temperature, brightness := tt.curve.At(tt.at)
+
+			if diff := cmp.Diff(tt.temperature, temperature); diff != "" {
+				t.Fatalf("unexpected temperature (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.brightness, brightness); diff != "" {
+				t.Fatalf("unexpected brightness (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSchedulerApply(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	d := keylighttest.NewDevice(&keylighttest.Config{
+		Lights: []*keylight.Light{
+			{On: true, Brightness: 50, Temperature: 5000},
+			{On: false, Brightness: 50, Temperature: 5000},
+		},
+	})
+	srv := httptest.NewServer(d)
+	defer srv.Close()
+
+	c, err := keylight.New(srv.URL)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	clock := &fakeClock{now: time.Date(2024, time.June, 21, 1, 0, 0, 0, time.UTC)}
+	s, err := circadian.New(c, circadian.Config{
+		Curve: london,
+		Pause: time.Hour,
+		Now:   clock.Now,
+	})
+	if err != nil {
+		t.Fatalf("failed to create scheduler: %v", err)
+	}
+
+	apply := func(want ...int) {
+		t.Helper()
+
+		if err := s.Apply(ctx); err != nil {
+			t.Fatalf("failed to apply: %v", err)
+		}
+
+		var got []int
+		for _, l := range d.Lights() {
+			got = append(got, l.Temperature)
+		}
+
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("unexpected temperatures (-want +got):\n%s", diff)
+		}
+	}
+
+	// Only the light which is on is adjusted.
+	apply(2900, 5000)
+
+	// Somebody turns up the temperature, so the scheduler pauses.
+	temp := 6000
+	if _, err := c.UpdateLights(ctx, &keylight.LightUpdate{Temperature: &temp}); err != nil {
+		t.Fatalf("failed to update lights: %v", err)
+	}
+
+	clock.Advance(10 * time.Minute)
+	apply(6000, 5000)
+
+	if _, ok := s.Paused(); !ok {
+		t.Fatal("scheduler should be paused")
+	}
+
+	clock.Advance(30 * time.Minute)
+	apply(6000, 5000)
+
+	// The pause ends and the scheduler resumes.
+	clock.Advance(time.Hour)
+	apply(2900, 5000)
+
+	if _, ok := s.Paused(); ok {
+		t.Fatal("scheduler should not be paused")
+	}
+
+	// Turning a light on is not a manual change.
+	on := true
+	if _, err := c.UpdateLights(ctx, &keylight.LightUpdate{Index: 1, On: &on}); err != nil {
+		t.Fatalf("failed to update lights: %v", err)
+	}
+
+	clock.Advance(time.Minute)
+	apply(2900, 2900)
+}
+
+func TestNewErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		curve circadian.Curve
+
+		// field, if set, is the field of the expected *keylight.RangeError.
+		field string
+	}{
+		{
+			name:  "latitude",
+			curve: circadian.Curve{Latitude: 91},
+		},
+		{
+			name:  "longitude",
+			curve: circadian.Curve{Longitude: -181},
+		},
+		{
+			name:  "night temperature",
+			curve: circadian.Curve{NightTemperature: 2000},
+			field: "night temperature",
+		},
+		{
+			name:  "day temperature",
+			curve: circadian.Curve{DayTemperature: 8000},
+			field: "day temperature",
+		},
+		{
+			name:  "night brightness",
+			curve: circadian.Curve{NightBrightness: 2, DayBrightness: 50},
+			field: "night brightness",
+		},
+		{
+			name:  "day brightness",
+			curve: circadian.Curve{NightBrightness: 10, DayBrightness: 101},
+			field: "day brightness",
+		},
+		{
+			name:  "night brightness unset",
+			curve: circadian.Curve{DayBrightness: 50},
+			field: "night brightness",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := circadian.New(nil, circadian.Config{Curve: tt.curve})
+			if err == nil {
+				t.Fatal("an error was expected, but none occurred")
+			}
+
+			var rerr *keylight.RangeError
+			if tt.field != "" && (!errors.As(err, &rerr) || rerr.Field != tt.field) {
+				t.Fatalf("expected %s range error, but got: %v", tt.field, err)
+			}
+		})
+	}
+}
+
+// A fakeClock is a manually advanced clock.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
@@ -0,0 +1,127 @@
+package circadian
+
+import (
+	"math"
+	"time"
+)
+
+// SunTimes are the times of sunrise, solar noon, and sunset for a location on
+// a given date.
+type SunTimes struct {
+	// Sunrise and Sunset are the times at which the sun rises and sets. If
+	// the sun does not rise or set on the date, they are the zero time and
+	// PolarDay or PolarNight is set.
+	Sunrise, Sunset time.Time
+
+	// Noon is the time of solar noon, when the sun is highest in the sky.
+	Noon time.Time
+
+	// PolarDay and PolarNight report whether the sun remains above or below
+	// the horizon for the entire date.
+	PolarDay, PolarNight bool
+}
+
+// Sun computes the SunTimes for the calendar date of t in t's location, at
+// the specified latitude and longitude in degrees. Longitudes east of the
+// prime meridian are positive. The calculation uses the NOAA solar equations
+// and is accurate to within about a minute for latitudes between +/- 72
+// degrees.
+func Sun(t time.Time, latitude, longitude float64) SunTimes {
+	y, m, d := t.Date()
+	midnight := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+
+	// Evaluate the solar position near local solar noon for the date.
+	p := position(midnight.Add(time.Duration((12 - longitude/15) * float64(time.Hour))))
+
+	noon := 720 - 4*longitude - p.eqTime
+	st := SunTimes{Noon: at(midnight, noon, t.Location())}
+
+	// Hour angle of sunrise, accounting for atmospheric refraction and the
+	// apparent radius of the sun.
+	cosH := math.Cos(rad(90.833))/(math.Cos(rad(latitude))*math.Cos(rad(p.declination))) -
+		math.Tan(rad(latitude))*math.Tan(rad(p.declination))
+
+	switch {
+	case cosH > 1:
+		st.PolarNight = true
+	case cosH < -1:
+		st.PolarDay = true
+	default:
+		h := deg(math.Acos(cosH))
+		st.Sunrise = at(midnight, noon-4*h, t.Location())
+		st.Sunset = at(midnight, noon+4*h, t.Location())
+	}
+
+	return st
+}
+
+// Elevation computes the elevation of the sun above the horizon in degrees at
+// time t, at the specified latitude and longitude in degrees. Atmospheric
+// refraction is not taken into account.
+func Elevation(t time.Time, latitude, longitude float64) float64 {
+	p := position(t)
+
+	u := t.UTC()
+	minutes := float64(u.Hour()*60+u.Minute()) + float64(u.Second())/60
+
+	tst := math.Mod(minutes+p.eqTime+4*longitude, 1440)
+	if tst < 0 {
+		tst += 1440
+	}
+
+	// Hour angle in degrees, which is zero at solar noon.
+	ha := tst/4 - 180
+
+	cosZenith := math.Sin(rad(latitude))*math.Sin(rad(p.declination)) +
+		math.Cos(rad(latitude))*math.Cos(rad(p.declination))*math.Cos(rad(ha))
+
+	return 90 - deg(math.Acos(math.Max(-1, math.Min(1, cosZenith))))
+}
+
+// A solarPosition contains the parameters of the sun's position used to
+// compute SunTimes and Elevation.
+type solarPosition struct {
+	// declination is the solar declination in degrees, and eqTime is the
+	// equation of time in minutes.
+	declination, eqTime float64
+}
+
+// position computes the solarPosition at time t using the NOAA solar
+// equations.
+func position(t time.Time) solarPosition {
+	jd := float64(t.Unix())/86400 + 2440587.5
+	jc := (jd - 2451545) / 36525
+
+	l := math.Mod(280.46646+jc*(36000.76983+jc*0.0003032), 360)
+	m := 357.52911 + jc*(35999.05029-0.0001537*jc)
+	e := 0.016708634 - jc*(0.000042037+0.0000001267*jc)
+
+	c := math.Sin(rad(m))*(1.914602-jc*(0.004817+0.000014*jc)) +
+		math.Sin(rad(2*m))*(0.019993-0.000101*jc) +
+		math.Sin(rad(3*m))*0.000289
+
+	omega := 125.04 - 1934.136*jc
+	lambda := l + c - 0.00569 - 0.00478*math.Sin(rad(omega))
+
+	obliquity := 23 + (26+(21.448-jc*(46.815+jc*(0.00059-jc*0.001813)))/60)/60
+	obliquity += 0.00256 * math.Cos(rad(omega))
+
+	y := math.Pow(math.Tan(rad(obliquity/2)), 2)
+
+	return solarPosition{
+		declination: deg(math.Asin(math.Sin(rad(obliquity)) * math.Sin(rad(lambda)))),
+		eqTime: 4 * deg(y*math.Sin(2*rad(l))-
+			2*e*math.Sin(rad(m))+
+			4*e*y*math.Sin(rad(m))*math.Cos(2*rad(l))-
+			0.5*y*y*math.Sin(4*rad(l))-
+			1.25*e*e*math.Sin(2*rad(m))),
+	}
+}
+
+// at returns the time which is minutes after midnight, in loc.
+func at(midnight time.Time, minutes float64, loc *time.Location) time.Time {
+	return midnight.Add(time.Duration(minutes * float64(time.Minute))).Round(time.Second).In(loc)
+}
+
+func rad(d float64) float64 { return d * math.Pi / 180 }
+func deg(r float64) float64 { return r * 180 / math.Pi }
@@ -0,0 +1,111 @@
+package circadian_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mdlayher/keylight/circadian"
+)
+
+func TestSun(t *testing.T) {
+	var (
+		bst  = time.FixedZone("BST", 1*60*60)
+		est  = time.FixedZone("EST", -5*60*60)
+		aedt = time.FixedZone("AEDT", 11*60*60)
+	)
+
+	tests := []struct {
+		name                 string
+		date                 time.Time
+		lat, lon             float64
+		sunrise, sunset      time.Time
+		polarDay, polarNight bool
+	}{
+		{
+			name:    "London summer",
+			date:    time.Date(2024, time.June, 21, 0, 0, 0, 0, bst),
+			lat:     51.5074,
+			lon:     -0.1278,
+			sunrise: time.Date(2024, time.June, 21, 4, 43, 0, 0, bst),
+			sunset:  time.Date(2024, time.June, 21, 21, 21, 0, 0, bst),
+		},
+		{
+			name:    "New York winter",
+			date:    time.Date(2024, time.December, 21, 12, 0, 0, 0, est),
+			lat:     40.7128,
+			lon:     -74.0060,
+			sunrise: time.Date(2024, time.December, 21, 7, 16, 0, 0, est),
+			sunset:  time.Date(2024, time.December, 21, 16, 32, 0, 0, est),
+		},
+		{
+			name:    "Sydney summer",
+			date:    time.Date(2024, time.December, 21, 23, 0, 0, 0, aedt),
+			lat:     -33.8688,
+			lon:     151.2093,
+			sunrise: time.Date(2024, time.December, 21, 5, 41, 0, 0, aedt),
+			sunset:  time.Date(2024, time.December, 21, 20, 5, 0, 0, aedt),
+		},
+		{
+			name:     "Tromsø midnight sun",
+			date:     time.Date(2024, time.June, 21, 0, 0, 0, 0, time.UTC),
+			lat:      69.6492,
+			lon:      18.9553,
+			polarDay: true,
+		},
+		{
+			name:       "Tromsø polar night",
+			date:       time.Date(2024, time.December, 21, 0, 0, 0, 0, time.UTC),
+			lat:        69.6492,
+			lon:        18.9553,
+			polarNight: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := circadian.Sun(tt.date, tt.lat, tt.lon)
+
+			if st.PolarDay != tt.polarDay || st.PolarNight != tt.polarNight {
+				t.Fatalf("unexpected polar state: day: %v, night: %v", st.PolarDay, st.PolarNight)
+			}
+
+			if !within(tt.sunrise, st.Sunrise) {
+				t.Fatalf("unexpected sunrise: want %s, got %s", tt.sunrise, st.Sunrise)
+			}
+			if !within(tt.sunset, st.Sunset) {
+				t.Fatalf("unexpected sunset: want %s, got %s", tt.sunset, st.Sunset)
+			}
+
+			// The sun is at its highest at noon, and near the horizon at sunrise.
+			noon := circadian.Elevation(st.Noon, tt.lat, tt.lon)
+			if tt.polarNight {
+				if noon >= 0 {
+					t.Fatalf("sun is above the horizon during polar night: %v", noon)
+				}
+				return
+			}
+
+			for _, d := range []time.Duration{-time.Hour, time.Hour} {
+				if e := circadian.Elevation(st.Noon.Add(d), tt.lat, tt.lon); e >= noon {
+					t.Fatalf("elevation %v from noon (%v) is not lower than noon (%v)", d, e, noon)
+				}
+			}
+
+			if !tt.polarDay {
+				if e := circadian.Elevation(st.Sunrise, tt.lat, tt.lon); e < -1.5 || e > 0.5 {
+					t.Fatalf("unexpected elevation at sunrise: %v", e)
+				}
+			}
+		})
+	}
+}
+
+// within reports whether got is within two minutes of want.
+func within(want, got time.Time) bool {
+	if want.IsZero() || got.IsZero() {
+		return want.IsZero() == got.IsZero()
+	}
+
+	d := got.Sub(want)
+	return d > -2*time.Minute && d < 2*time.Minute
+}
@@ -0,0 +1,114 @@
+package keylight
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// A CloneConfig selects the aspects of a reference device's configuration
+// which Clone applies to each target device. A nil *CloneConfig clones lights
+// and settings.
+type CloneConfig struct {
+	// Lights clones the state of the reference device's lights.
+	Lights bool
+
+	// Settings clones the reference device's persistent light settings, such
+	// as fade durations and power on brightness and temperature.
+	Settings bool
+
+	// NameTemplate, if set, sets the display name of each target device. The
+	// placeholder {n} is replaced by the 1-based index of the target, so the
+	// template "Studio-{n}" names the targets Studio-1, Studio-2, and so on.
+	NameTemplate string
+}
+
+// A CloneResult is the result of cloning configuration to a single target
+// device.
+type CloneResult struct {
+	// Client is the Client for the target device.
+	Client *Client
+
+	// DisplayName is the display name applied to the device, if any.
+	DisplayName string
+
+	// Lights and Settings are the light state and settings applied to the
+	// device, if any.
+	Lights   []*Light
+	Settings *LightSettings
+
+	// Err is the error which occurred for this device, if any.
+	Err error
+}
+
+// Clone reads the configuration of the reference device and applies the
+// aspects selected by cfg to each of the target devices concurrently. It
+// returns a result for each target in order, and a *GroupError if any target
+// failed.
+func Clone(ctx context.Context, reference *Client, targets []*Client, cfg *CloneConfig) ([]*CloneResult, error) {
+	if cfg == nil {
+		cfg = &CloneConfig{Lights: true, Settings: true}
+	}
+
+	if !cfg.Lights && !cfg.Settings && cfg.NameTemplate == "" {
+		return nil, errors.New("no aspects selected to clone")
+	}
+
+	if cfg.NameTemplate != "" && len(targets) > 1 && !strings.Contains(cfg.NameTemplate, "{n}") {
+		return nil, errors.New("name template must contain {n} to clone to multiple devices")
+	}
+
+	var (
+		lights   []*Light
+		settings *LightSettings
+		err      error
+	)
+
+	if cfg.Lights {
+		if lights, err = reference.Lights(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.Settings {
+		if settings, err = reference.Settings(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]*CloneResult, len(targets))
+	gresults := NewGroup(targets, nil).each(ctx, func(ctx context.Context, i int, c *Client, gr *GroupResult) {
+		r := &CloneResult{Client: c}
+		results[i] = r
+
+		defer func() { gr.Err = r.Err }()
+
+		if cfg.NameTemplate != "" {
+			name := strings.ReplaceAll(cfg.NameTemplate, "{n}", strconv.Itoa(i+1))
+			if r.Err = c.SetDisplayName(ctx, name); r.Err != nil {
+				return
+			}
+			r.DisplayName = name
+		}
+
+		if settings != nil {
+			if r.Err = c.SetSettings(ctx, settings); r.Err != nil {
+				return
+			}
+			r.Settings = settings
+		}
+
+		if lights != nil {
+			applied, err := c.ApplyLights(ctx, lights)
+			if err != nil {
+				r.Err = err
+				return
+			}
+			r.Lights = applied
+			gr.Lights = applied
+		}
+	})
+
+	return results, groupError(gresults)
+}
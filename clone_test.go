@@ -0,0 +1,129 @@
+package keylight_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/keylight"
+	"github.com/mdlayher/keylight/keylighttest"
+)
+
+func TestClone(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	devices, clients := testSceneDevices(t, 4)
+	ref, targets := clients[0], clients[1:]
+
+	wantLights := []*keylight.Light{{On: true, Brightness: 70, Temperature: 3500}}
+	if err := ref.SetLights(ctx, wantLights); err != nil {
+		t.Fatalf("failed to set lights: %v", err)
+	}
+
+	// The power on temperature does not survive a round trip through Kelvin,
+	// so it must be cloned exactly.
+	wantSettings := &keylight.LightSettings{
+		PowerOnBehavior:       keylight.PowerOnDefaults,
+		PowerOnBrightness:     40,
+		PowerOnTemperature:    4000,
+		PowerOnRawTemperature: 291,
+		SwitchOnDuration:      200 * time.Millisecond,
+	}
+	if err := ref.SetSettings(ctx, wantSettings); err != nil {
+		t.Fatalf("failed to set settings: %v", err)
+	}
+
+	// The last target fails to apply its lights.
+	devices[3].InjectFault(keylighttest.Fault{
+		Method:     http.MethodPut,
+		Path:       "/elgato/lights",
+		StatusCode: http.StatusInternalServerError,
+	})
+
+	results, err := keylight.Clone(ctx, ref, targets, &keylight.CloneConfig{
+		Lights:       true,
+		Settings:     true,
+		NameTemplate: "Studio-{n}",
+	})
+
+	var gerr *keylight.GroupError
+	if !errors.As(err, &gerr) {
+		t.Fatalf("expected group error, but got: %v", err)
+	}
+
+	if diff := cmp.Diff(3, len(results)); diff != "" {
+		t.Fatalf("unexpected number of results (-want +got):\n%s", diff)
+	}
+
+	for i, d := range devices[1:] {
+		r := results[i]
+		if diff := cmp.Diff(i == 2, r.Err != nil); diff != "" {
+			t.Fatalf("%d: unexpected error state (-want +got):\n%s", i, diff)
+		}
+
+		// All aspects before the failure were applied.
+		name := []string{"Studio-1", "Studio-2", "Studio-3"}[i]
+		if diff := cmp.Diff(name, d.AccessoryInfo().DisplayName); diff != "" {
+			t.Fatalf("%d: unexpected display name (-want +got):\n%s", i, diff)
+		}
+		if diff := cmp.Diff(name, r.DisplayName); diff != "" {
+			t.Fatalf("%d: unexpected result display name (-want +got):\n%s", i, diff)
+		}
+
+		if diff := cmp.Diff(wantSettings, d.Settings()); diff != "" {
+			t.Fatalf("%d: unexpected settings (-want +got):\n%s", i, diff)
+		}
+
+		if r.Err != nil {
+			continue
+		}
+
+		if diff := cmp.Diff(wantLights, d.Lights(), ignoreRaw); diff != "" {
+			t.Fatalf("%d: unexpected lights (-want +got):\n%s", i, diff)
+		}
+		if diff := cmp.Diff(wantLights, r.Lights, ignoreRaw); diff != "" {
+			t.Fatalf("%d: unexpected result lights (-want +got):\n%s", i, diff)
+		}
+	}
+}
+
+func TestCloneErrors(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, clients := testSceneDevices(t, 3)
+
+	tests := []struct {
+		name string
+		cfg  *keylight.CloneConfig
+		err  string
+	}{
+		{
+			name: "no aspects",
+			cfg:  &keylight.CloneConfig{},
+			err:  "no aspects selected to clone",
+		},
+		{
+			name: "duplicate names",
+			cfg:  &keylight.CloneConfig{NameTemplate: "Studio"},
+			err:  "name template must contain {n} to clone to multiple devices",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := keylight.Clone(ctx, clients[0], clients[1:], tt.cfg)
+			if err == nil {
+				t.Fatal("an error was expected, but none occurred")
+			}
+
+			if diff := cmp.Diff(tt.err, err.Error()); diff != "" {
+				t.Fatalf("unexpected error (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/mdlayher/keylight"
+)
+
+// backupCommand runs the backup subcommand with args against the devices at
+// the comma-separated addresses in addrs.
+func backupCommand(ctx context.Context, addrs string, args []string) {
+	if len(args) > 1 {
+		log.Fatal("usage: keylight [flags] backup [FILE]")
+	}
+
+	b, err := keylight.CreateBackup(ctx, clients(addrs))
+	if err != nil {
+		log.Fatalf("failed to create backup: %v", err)
+	}
+
+	buf, err := json.MarshalIndent(b, "", "\t")
+	if err != nil {
+		log.Fatalf("failed to marshal backup: %v", err)
+	}
+	buf = append(buf, '\n')
+
+	if len(args) == 0 {
+		_, _ = os.Stdout.Write(buf)
+		return
+	}
+
+	// Backups describe the user's devices and network, so only the current
+	// user may read them.
+	if err := os.WriteFile(args[0], buf, 0o600); err != nil {
+		log.Fatalf("failed to write backup: %v", err)
+	}
+
+	log.Printf("backed up %d devices to %s", len(b.Devices), args[0])
+}
+
+// restoreCommand runs the restore subcommand with args against the devices at
+// the comma-separated addresses in addrs.
+func restoreCommand(ctx context.Context, addrs string, args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	var (
+		dryRun = fs.Bool("n", false, "display the changes which would be made without applying them")
+		serial = fs.String("serial", "", "restore the device with this serial number from the backup to a different device")
+	)
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		log.Fatal("usage: keylight [flags] restore [-n] [-serial SERIAL] FILE")
+	}
+
+	buf, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		log.Fatalf("failed to read backup: %v", err)
+	}
+
+	var b keylight.Backup
+	if err := json.Unmarshal(buf, &b); err != nil {
+		log.Fatalf("failed to parse backup: %v", err)
+	}
+
+	cs := clients(addrs)
+	if *serial != "" && len(cs) != 1 {
+		log.Fatal("-serial may only be used to restore a single device")
+	}
+
+	cfg := &keylight.RestoreConfig{
+		DryRun:       *dryRun,
+		SerialNumber: *serial,
+	}
+
+	var failed bool
+	for _, c := range cs {
+		changes, err := c.Restore(ctx, &b, cfg)
+		if err != nil {
+			log.Printf("device %s: failed to restore: %v", c.Addr(), err)
+			failed = true
+			continue
+		}
+
+		for _, ch := range changes {
+			log.Printf("device %s: %s", c.Addr(), ch)
+		}
+
+		switch {
+		case *dryRun:
+			log.Printf("device %s: dry run, %d changes not applied", c.Addr(), len(changes))
+		default:
+			log.Printf("device %s: restored %d changes", c.Addr(), len(changes))
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
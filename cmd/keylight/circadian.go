@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"log/slog"
+	"time"
+
+	"github.com/mdlayher/keylight"
+	"github.com/mdlayher/keylight/circadian"
+)
+
+// circadianCommand runs the circadian subcommand with args, adjusting the
+// device at addr to follow the sun until ctx is canceled.
+func circadianCommand(ctx context.Context, addr string, args []string) {
+	fs := flag.NewFlagSet("circadian", flag.ExitOnError)
+	var (
+		lat      = fs.Float64("lat", 0, "the latitude of the device in degrees (required)")
+		lon      = fs.Float64("lon", 0, "the longitude of the device in degrees, positive east of the prime meridian (required)")
+		night    = fs.Int("night", 2900, "the color temperature in Kelvin to apply at night")
+		day      = fs.Int("day", 6500, "the color temperature in Kelvin to apply at solar noon")
+		interval = fs.Duration("interval", time.Minute, "the interval at which to adjust the lights")
+		pause    = fs.Duration("pause", time.Hour, "pause for the specified duration after the lights are changed manually")
+	)
+	_ = fs.Parse(args)
+
+	// The default of 0 is a valid location, so require it to be explicit.
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if !set["lat"] || !set["lon"] {
+		log.Fatal("usage: keylight [flags] circadian -lat LATITUDE -lon LONGITUDE [flags]")
+	}
+
+	c, err := keylight.NewClient(addr, httpClient)
+	if err != nil {
+		log.Fatalf("failed to create Key Light client: %v", err)
+	}
+
+	s, err := circadian.New(c, circadian.Config{
+		Curve: circadian.Curve{
+			Latitude:         *lat,
+			Longitude:        *lon,
+			NightTemperature: *night,
+			DayTemperature:   *day,
+		},
+		Interval: *interval,
+		Pause:    *pause,
+		Logger:   slog.Default(),
+	})
+	if err != nil {
+		log.Fatalf("failed to create circadian scheduler: %v", err)
+	}
+
+	st := circadian.Sun(time.Now(), *lat, *lon)
+	switch {
+	case st.PolarDay:
+		log.Printf("device %s: following the sun, which does not set today", addr)
+	case st.PolarNight:
+		log.Printf("device %s: following the sun, which does not rise today", addr)
+	default:
+		log.Printf("device %s: following the sun, sunrise %s, sunset %s",
+			addr, st.Sunrise.Format(time.Kitchen), st.Sunset.Format(time.Kitchen))
+	}
+
+	if err := s.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		log.Fatalf("failed to run circadian scheduler: %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/mdlayher/keylight"
+)
+
+// cloneCommand runs the clone subcommand with args, cloning the configuration
+// of the reference device at addr to the target devices in args.
+func cloneCommand(ctx context.Context, addr string, args []string) {
+	fs := flag.NewFlagSet("clone", flag.ExitOnError)
+	var (
+		lights   = fs.Bool("lights", false, "clone the state of the reference device's lights")
+		settings = fs.Bool("settings", false, "clone the reference device's light settings, such as fade durations")
+		name     = fs.String("name", "", "set each target's display name using a template where {n} is the target's number, such as Studio-{n}")
+	)
+	_ = fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		log.Fatal("usage: keylight [-a REFERENCE] clone [-lights] [-settings] [-name TEMPLATE] TARGET...")
+	}
+
+	ref, err := keylight.NewClient(addr, httpClient)
+	if err != nil {
+		log.Fatalf("failed to create Key Light client: %v", err)
+	}
+
+	results, err := keylight.Clone(ctx, ref, clients(strings.Join(fs.Args(), ",")), &keylight.CloneConfig{
+		Lights:       *lights,
+		Settings:     *settings,
+		NameTemplate: *name,
+	})
+	if results == nil && err != nil {
+		log.Fatalf("failed to clone: %v", err)
+	}
+
+	for _, r := range results {
+		var applied []string
+		if r.DisplayName != "" {
+			applied = append(applied, "name "+r.DisplayName)
+		}
+		if r.Settings != nil {
+			applied = append(applied, "settings")
+		}
+		if r.Lights != nil {
+			applied = append(applied, "lights")
+		}
+		if len(applied) == 0 {
+			applied = append(applied, "nothing")
+		}
+
+		if r.Err != nil {
+			log.Printf("device %s: failed: %v (applied %s)", r.Client.Addr(), r.Err, strings.Join(applied, ", "))
+			continue
+		}
+
+		log.Printf("device %s: applied %s", r.Client.Addr(), strings.Join(applied, ", "))
+	}
+
+	if err != nil {
+		os.Exit(1)
+	}
+}
@@ -7,29 +7,78 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
 	"time"
 
 	"github.com/mdlayher/keylight"
+	"github.com/mdlayher/keylight/internal/daemon"
 )
 
+// httpClient is the HTTP client used to communicate with devices, or nil to
+// use a default client.
+var httpClient *http.Client
+
 func main() {
 	log.SetFlags(0)
 
 	var (
-		addr    = flag.String("a", "http://keylight:9123", "the address of an Elgato Key Light's HTTP API")
+		addr    = flag.String("a", "http://keylight:9123", "the address of an Elgato Key Light's HTTP API, or a comma-separated list of addresses for scene, backup, and restore commands")
 		display = flag.String("d", "", "set the display name of an Elgato Key Light device")
 		info    = flag.Bool("i", false, "display the current status of an Elgato Key Light without changing its state")
+		list    = flag.Bool("l", false, "list Elgato Key Light devices discovered on the local network using mDNS")
+		fade    = flag.Duration("f", 0, "fade smoothly to the new brightness and temperature over the specified duration")
+		scenes  = flag.String("s", defaultSceneFile(), "the path to the file used to store scenes")
+		socket  = flag.String("socket", daemon.DefaultSocket(), "the path to the Unix socket of a keylightd daemon, which is used to control devices if it is running")
 	)
 	var brightness, temperature signedNumber
 	flag.Var(&brightness, "b", "set brightness to an absolute (between 0 and 100) or relative (-N or +N) percentage")
 	flag.Var(&temperature, "t", "set temperature to an absolute (between 2900 and 7000) or relative (-N or +N) degrees")
 	flag.Parse()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	// Devices are controlled through the daemon when it is running, and
+	// directly otherwise.
+	httpClient = daemon.HTTPClient(*socket)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second+*fade)
 	defer cancel()
 
-	c, err := keylight.NewClient(*addr, nil)
+	if *list {
+		discover(ctx)
+		return
+	}
+
+	switch flag.Arg(0) {
+	case "scene":
+		sceneCommand(ctx, *scenes, *addr, *fade, flag.Args()[1:])
+		return
+	case "backup":
+		backupCommand(ctx, *addr, flag.Args()[1:])
+		return
+	case "restore":
+		restoreCommand(ctx, *addr, flag.Args()[1:])
+		return
+	case "clone":
+		cloneCommand(ctx, *addr, flag.Args()[1:])
+		return
+	case "circadian":
+		// Runs until interrupted rather than under the command timeout.
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer cancel()
+
+		circadianCommand(ctx, *addr, flag.Args()[1:])
+		return
+	case "schedule":
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer cancel()
+
+		scheduleCommand(ctx, flag.Args()[1:])
+		return
+	}
+
+	c, err := keylight.NewClient(*addr, httpClient)
 	if err != nil {
 		log.Fatalf("failed to create Key Light client: %v", err)
 	}
@@ -48,7 +97,14 @@ func main() {
 		log.Fatalf("failed to fetch accessory info: %v", err)
 	}
 
-	lights, err := c.Lights(ctx)
+	// Lights may be toggled or adjusted relative to their current state, so
+	// don't rely on a daemon's cached state.
+	lctx := ctx
+	if !*info {
+		lctx = daemon.NoCache(ctx)
+	}
+
+	lights, err := c.Lights(lctx)
 	if err != nil {
 		log.Fatalf("failed to fetch lights: %v", err)
 	}
@@ -62,6 +118,31 @@ func main() {
 	// Only toggle the light if no modification flags are set.
 	toggle := !brightness.set && !temperature.set
 
+	// Absolute changes are applied as partial updates so that attributes
+	// which are not being changed are never overwritten.
+	if !toggle && *fade == 0 && !brightness.relative && !temperature.relative {
+		on := true
+		updates := make([]*keylight.LightUpdate, 0, len(lights))
+		for i := range lights {
+			u := &keylight.LightUpdate{Index: i, On: &on}
+			if brightness.set {
+				u.Brightness = &brightness.number
+			}
+			if temperature.set {
+				u.Temperature = &temperature.number
+			}
+			updates = append(updates, u)
+		}
+
+		lights, err := c.UpdateLights(ctx, updates...)
+		if err != nil {
+			log.Fatalf("failed to update lights: %v", err)
+		}
+
+		logInfo(d, lights)
+		return
+	}
+
 	for _, l := range lights {
 		if brightness.relative {
 			l.Brightness += brightness.number
@@ -73,6 +154,11 @@ func main() {
 		} else if temperature.set {
 			l.Temperature = temperature.number
 		}
+		if temperature.set {
+			// Setting a temperature switches color-capable lights back to
+			// temperature mode.
+			l.Mode = keylight.ColorModeTemperature
+		}
 
 		if toggle {
 			l.On = !l.On
@@ -82,7 +168,17 @@ func main() {
 		}
 	}
 
-	if err := c.SetLights(ctx, lights); err != nil {
+	if *fade > 0 {
+		if err := c.Transition(ctx, lights, *fade, keylight.EasePerceptual); err != nil {
+			log.Fatalf("failed to set lights: %v", err)
+		}
+
+		// Display the final state reported by the device.
+		lights, err = c.Lights(ctx)
+	} else {
+		lights, err = c.ApplyLights(ctx, lights)
+	}
+	if err != nil {
 		log.Fatalf("failed to set lights: %v", err)
 	}
 
@@ -129,6 +225,34 @@ func (p *signedNumber) Set(s string) error {
 	return nil
 }
 
+// discover logs the addresses of devices found on the local network, or known
+// to the daemon if it is running.
+func discover(ctx context.Context) {
+	if httpClient != nil {
+		ds, err := daemon.Devices(ctx, httpClient)
+		if err != nil {
+			log.Fatalf("failed to list daemon devices: %v", err)
+		}
+
+		for _, d := range ds {
+			log.Printf("device %q: %s", d.Name, d.Addr)
+		}
+		return
+	}
+
+	dctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	ss, err := keylight.Discover(dctx, nil)
+	if err != nil {
+		log.Fatalf("failed to discover devices: %v", err)
+	}
+
+	for _, s := range ss {
+		log.Printf("device %q: %s", s.Instance, s.Addr)
+	}
+}
+
 // logInfo logs information about a device and its lights.
 func logInfo(d *keylight.Device, ls []*keylight.Light) {
 	name := d.DisplayName
@@ -138,7 +262,11 @@ func logInfo(d *keylight.Device, ls []*keylight.Light) {
 
 	for i, l := range ls {
 		onOff := "off"
-		if l.On {
+		switch {
+		case l.On && l.Mode == keylight.ColorModeHueSaturation:
+			onOff = fmt.Sprintf("on: hue %.1f, saturation %.1f%%, brightness %d%%",
+				l.Hue, l.Saturation, l.Brightness)
+		case l.On:
 			onOff = fmt.Sprintf("on: temperature %dK, brightness %d%%",
 				l.Temperature, l.Brightness)
 		}
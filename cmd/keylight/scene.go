@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mdlayher/keylight"
+)
+
+// defaultSceneFile returns the default path of the file used to store scenes.
+func defaultSceneFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "keylight-scenes.json"
+	}
+
+	return filepath.Join(dir, "keylight", "scenes.json")
+}
+
+// sceneCommand runs the scene subcommand with args against the devices at
+// the comma-separated addresses in addrs.
+func sceneCommand(ctx context.Context, file, addrs string, fade time.Duration, args []string) {
+	const usage = "usage: keylight [flags] scene save|apply|delete NAME, or scene list"
+	if len(args) == 0 {
+		log.Fatal(usage)
+	}
+
+	store := keylight.NewSceneStore(file)
+
+	if args[0] == "list" {
+		scenes, err := store.List()
+		if err != nil {
+			log.Fatalf("failed to list scenes: %v", err)
+		}
+
+		for _, s := range scenes {
+			log.Printf("scene %q: %d devices", s.Name, len(s.Lights))
+		}
+		return
+	}
+
+	if len(args) != 2 {
+		log.Fatal(usage)
+	}
+	name := args[1]
+
+	switch args[0] {
+	case "save":
+		s, err := keylight.CaptureScene(ctx, name, clients(addrs))
+		if err != nil {
+			log.Fatalf("failed to capture scene: %v", err)
+		}
+
+		if err := store.Save(s); err != nil {
+			log.Fatalf("failed to save scene: %v", err)
+		}
+
+		log.Printf("saved scene %q: %d devices", s.Name, len(s.Lights))
+	case "apply":
+		s, err := store.Get(name)
+		if err != nil {
+			log.Fatalf("failed to load scene: %v", err)
+		}
+
+		results, err := keylight.NewGroup(clients(addrs), nil).ApplyScene(ctx, s, fade)
+		if err != nil {
+			if results == nil {
+				log.Fatalf("failed to apply scene %q: %v", s.Name, err)
+			}
+
+			var rolledBack, unrestored int
+			for _, r := range results {
+				if r.Err != nil {
+					log.Printf("device %s: %v", r.Client.Addr(), r.Err)
+				}
+
+				switch {
+				case r.RollbackErr != nil:
+					unrestored++
+					log.Printf("device %s: failed to restore previous state: %v", r.Client.Addr(), r.RollbackErr)
+				case r.RolledBack:
+					rolledBack++
+					log.Printf("device %s: restored previous state", r.Client.Addr())
+				}
+			}
+
+			switch {
+			case unrestored > 0:
+				log.Fatalf("failed to apply scene %q, %d devices could not be restored", s.Name, unrestored)
+			case rolledBack > 0:
+				log.Fatalf("failed to apply scene %q, all changed devices were restored", s.Name)
+			default:
+				log.Fatalf("failed to apply scene %q, no devices were changed", s.Name)
+			}
+		}
+
+		log.Printf("applied scene %q", s.Name)
+	case "delete":
+		if err := store.Delete(name); err != nil {
+			log.Fatalf("failed to delete scene: %v", err)
+		}
+
+		log.Printf("deleted scene %q", name)
+	default:
+		log.Fatal(usage)
+	}
+}
+
+// clients creates a Client for each of the comma-separated addresses in
+// addrs.
+func clients(addrs string) []*keylight.Client {
+	var cs []*keylight.Client
+	for _, addr := range strings.Split(addrs, ",") {
+		c, err := keylight.NewClient(strings.TrimSpace(addr), httpClient)
+		if err != nil {
+			log.Fatalf("failed to create Key Light client: %v", err)
+		}
+
+		cs = append(cs, c)
+	}
+
+	return cs
+}
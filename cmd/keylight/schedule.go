@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"log/slog"
+	"time"
+
+	"github.com/mdlayher/keylight"
+	"github.com/mdlayher/keylight/schedule"
+)
+
+// scheduleCommand runs the schedule subcommand with args, running the rules
+// of a schedule file until ctx is canceled.
+func scheduleCommand(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("schedule", flag.ExitOnError)
+	catchUp := fs.Duration("catchup", time.Hour, "run rules which were missed by up to the specified duration, such as while the system was asleep")
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		log.Fatal("usage: keylight schedule [-catchup DURATION] FILE")
+	}
+
+	f, err := schedule.Load(fs.Arg(0))
+	if err != nil {
+		log.Fatalf("failed to load schedule: %v", err)
+	}
+
+	cfg := schedule.Config{
+		CatchUp: *catchUp,
+		Logger:  slog.Default(),
+	}
+	if httpClient != nil {
+		cfg.Options = append(cfg.Options, keylight.WithHTTPClient(httpClient))
+	}
+
+	s, err := schedule.New(f, cfg)
+	if err != nil {
+		log.Fatalf("failed to create scheduler: %v", err)
+	}
+
+	if r, at, ok := s.Next(); ok {
+		log.Printf("loaded %d rules, next: %s at %s", len(f.Rules), r, at.Format(time.RFC1123))
+	}
+
+	if err := s.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		log.Fatalf("failed to run scheduler: %v", err)
+	}
+}
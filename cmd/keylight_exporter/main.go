@@ -0,0 +1,63 @@
+// Command keylight_exporter serves Prometheus metrics for Elgato Key Light
+// devices.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/mdlayher/keylight"
+	"github.com/mdlayher/keylight/internal/cmdconfig"
+	"github.com/mdlayher/keylight/metrics"
+)
+
+// A config is the configuration file for keylight_exporter.
+type config struct {
+	// Devices are the addresses of each device's HTTP API.
+	Devices []string `json:"devices"`
+}
+
+func main() {
+	log.SetFlags(0)
+
+	var (
+		listen   = flag.String("listen", ":9288", "the address on which to serve Prometheus metrics")
+		cfgFile  = flag.String("c", "", "the path to a JSON configuration file which lists devices, such as {\"devices\": [\"http://keylight:9123\"]}")
+		discover = flag.Bool("discover", false, "discover devices on the local network using mDNS at startup")
+		timeout  = flag.Duration("timeout", 5*time.Second, "the maximum duration of a scrape of all devices")
+	)
+	flag.Parse()
+
+	var cfg config
+	if err := cmdconfig.Load(*cfgFile, &cfg); err != nil {
+		log.Fatal(err)
+	}
+
+	e := metrics.NewExporter(&metrics.Config{Timeout: *timeout})
+
+	clients, err := cmdconfig.Clients(context.Background(), cfg.Devices, *discover,
+		keylight.WithSerialization(),
+		keylight.WithMiddleware(e.Middleware()),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, c := range clients {
+		e.AddDevice(c)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", e)
+
+	log.Printf("serving metrics for %d devices on %s", len(clients), *listen)
+
+	srv := &http.Server{
+		Addr:              *listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	log.Fatal(srv.ListenAndServe())
+}
@@ -0,0 +1,69 @@
+// Command keylight_gateway serves an HTTP/JSON REST gateway which aggregates
+// Elgato Key Light devices behind a single API.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/mdlayher/keylight"
+	"github.com/mdlayher/keylight/gateway"
+	"github.com/mdlayher/keylight/internal/cmdconfig"
+)
+
+// A config is the configuration file for keylight_gateway.
+type config struct {
+	// Devices are the addresses of each device's HTTP API.
+	Devices []string `json:"devices"`
+
+	// Groups maps group names to the serial numbers or display names of the
+	// devices in each group.
+	Groups map[string][]string `json:"groups"`
+}
+
+func main() {
+	log.SetFlags(0)
+
+	var (
+		listen   = flag.String("listen", ":8080", "the address on which to serve the gateway API")
+		cfgFile  = flag.String("c", "", "the path to a JSON configuration file which lists devices and groups, such as {\"devices\": [\"http://keylight:9123\"], \"groups\": {\"studio\": [\"BW00A1A00001\"]}}")
+		discover = flag.Bool("discover", false, "discover devices on the local network using mDNS at startup")
+		scenes   = flag.String("s", "", "the path to a keylight scenes file, which enables the /scenes endpoints")
+	)
+	flag.Parse()
+
+	var cfg config
+	if err := cmdconfig.Load(*cfgFile, &cfg); err != nil {
+		log.Fatal(err)
+	}
+
+	clients, err := cmdconfig.Clients(context.Background(), cfg.Devices, *discover, keylight.WithSerialization())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	gcfg := gateway.Config{
+		Clients: clients,
+		Groups:  cfg.Groups,
+	}
+	if *scenes != "" {
+		gcfg.Scenes = keylight.NewSceneStore(*scenes)
+	}
+
+	s, err := gateway.New(gcfg)
+	if err != nil {
+		log.Fatalf("failed to create gateway: %v", err)
+	}
+
+	log.Printf("serving %d devices on %s", len(clients), *listen)
+
+	srv := &http.Server{
+		Addr:              *listen,
+		Handler:           s,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	log.Fatal(srv.ListenAndServe())
+}
@@ -0,0 +1,99 @@
+// Command keylight_mqtt bridges Elgato Key Light devices to an MQTT broker,
+// with support for Home Assistant MQTT discovery.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/mdlayher/keylight"
+	"github.com/mdlayher/keylight/internal/cmdconfig"
+	"github.com/mdlayher/keylight/mqttbridge"
+)
+
+// A config is the configuration file for keylight_mqtt.
+type config struct {
+	// Devices are the addresses of each device's HTTP API.
+	Devices []string `json:"devices"`
+
+	// Username and Password, if set, authenticate with the broker.
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func main() {
+	log.SetFlags(0)
+
+	var (
+		broker   = flag.String("broker", "localhost:1883", "the address of the MQTT broker")
+		cfgFile  = flag.String("c", "", "the path to a JSON configuration file which lists devices and optional broker credentials, such as {\"devices\": [\"http://keylight:9123\"], \"username\": \"keylight\", \"password\": \"secret\"}")
+		discover = flag.Bool("discover", false, "discover devices on the local network using mDNS at startup")
+		id       = flag.String("id", "keylight", "the MQTT client ID")
+		topic    = flag.String("topic", "keylight", "the base topic for device state and commands")
+		prefix   = flag.String("discovery-prefix", "homeassistant", "the Home Assistant MQTT discovery prefix")
+		interval = flag.Duration("interval", 5*time.Second, "the interval at which devices are polled for changes")
+		useTLS   = flag.Bool("tls", false, "connect to the MQTT broker using TLS, which is required to send credentials to a remote broker")
+		caFile   = flag.String("tls-ca", "", "the path to a PEM file of certificate authorities used to verify the broker, instead of the system's")
+	)
+	flag.Parse()
+
+	var cfg config
+	if err := cmdconfig.Load(*cfgFile, &cfg); err != nil {
+		log.Fatal(err)
+	}
+
+	clients, err := cmdconfig.Clients(context.Background(), cfg.Devices, *discover, keylight.WithSerialization())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var tlsConfig *tls.Config
+	if *useTLS || *caFile != "" {
+		tlsConfig = &tls.Config{}
+	}
+	if *caFile != "" {
+		pem, err := os.ReadFile(*caFile)
+		if err != nil {
+			log.Fatalf("failed to read certificate authorities: %v", err)
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			log.Fatalf("no certificates found in %s", *caFile)
+		}
+	}
+
+	b, err := mqttbridge.New(mqttbridge.Config{
+		Clients:         clients,
+		Broker:          *broker,
+		ClientID:        *id,
+		Username:        cfg.Username,
+		Password:        cfg.Password,
+		TLSConfig:       tlsConfig,
+		Topic:           *topic,
+		DiscoveryPrefix: *prefix,
+		Interval:        *interval,
+		Logger:          slog.Default(),
+	})
+	if err != nil {
+		log.Fatalf("failed to create bridge: %v", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	log.Printf("bridging %d devices to %s", len(clients), *broker)
+
+	if err := b.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		log.Fatalf("failed to run bridge: %v", err)
+	}
+}
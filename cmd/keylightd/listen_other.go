@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "net"
+
+// listen listens on the Unix socket at path. Access to the socket is
+// governed by the permissions of its parent directory.
+func listen(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
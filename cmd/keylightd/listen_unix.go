@@ -0,0 +1,21 @@
+//go:build unix
+
+package main
+
+import (
+	"net"
+	"syscall"
+)
+
+// listen listens on the Unix socket at path. The socket is created with a
+// restrictive umask so that only the current user may control devices
+// through the daemon, without a window in which other users could connect
+// before its permissions are changed.
+func listen(path string) (net.Listener, error) {
+	// The umask is process-wide, but no other goroutines create files while
+	// the daemon is starting.
+	old := syscall.Umask(0o077)
+	defer syscall.Umask(old)
+
+	return net.Listen("unix", path)
+}
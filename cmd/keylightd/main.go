@@ -0,0 +1,91 @@
+// Command keylightd is a daemon which owns the connections to Elgato Key Light
+// devices, caching their state and serializing requests on behalf of the
+// keylight CLI and other local clients, which connect over a Unix socket.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/mdlayher/keylight/internal/daemon"
+)
+
+// A config is the configuration file for keylightd.
+type config struct {
+	// Devices maps device names to the addresses of their HTTP APIs.
+	Devices map[string]string `json:"devices"`
+}
+
+func main() {
+	log.SetFlags(0)
+
+	var (
+		cfgFile  = flag.String("c", "", "the path to a JSON configuration file which names devices, such as {\"devices\": {\"desk\": \"http://keylight:9123\"}}")
+		discover = flag.Bool("discover", false, "discover devices on the local network using mDNS")
+		refresh  = flag.Duration("refresh", 5*time.Second, "the interval at which the state of each device is refreshed")
+		socket   = flag.String("socket", daemon.DefaultSocket(), "the path to the Unix socket on which to serve clients")
+	)
+	flag.Parse()
+
+	var cfg config
+	if *cfgFile != "" {
+		b, err := os.ReadFile(*cfgFile)
+		if err != nil {
+			log.Fatalf("failed to read configuration: %v", err)
+		}
+		if err := json.Unmarshal(b, &cfg); err != nil {
+			log.Fatalf("failed to parse configuration: %v", err)
+		}
+	}
+
+	s, err := daemon.NewServer(daemon.Config{
+		Devices:  cfg.Devices,
+		Discover: *discover,
+		Refresh:  *refresh,
+		Logger:   slog.Default(),
+	})
+	if err != nil {
+		log.Fatalf("failed to create daemon: %v", err)
+	}
+
+	// Remove the socket of a previous daemon which did not exit cleanly, but
+	// not one which is still running.
+	if daemon.HTTPClient(*socket) != nil {
+		log.Fatalf("keylightd is already running on %s", *socket)
+	}
+	_ = os.Remove(*socket)
+
+	l, err := listen(*socket)
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+	defer os.Remove(*socket)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	srv := &http.Server{
+		Handler:     s,
+		ReadTimeout: 5 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+	go func() { _ = s.Run(ctx) }()
+
+	log.Printf("serving on %s", *socket)
+
+	if err := srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("failed to serve: %v", err)
+	}
+}
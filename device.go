@@ -6,46 +6,62 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"math"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"time"
 )
 
+// Ranges of values accepted by Key Light devices, as enforced by
+// Client.SetLights and Client.UpdateLights.
 const (
-	brightnessMin = 3
-	brightnessMax = 100
-	tempMin       = 2900
-	tempMax       = 7000
-
-	tempConstant   = 9900
-	tempCoefficent = 20.35
-	tempHalfstep   = 25
-	tempStep       = 50
+	// BrightnessMin and BrightnessMax bound brightness percentages.
+	BrightnessMin = 3
+	BrightnessMax = 100
+
+	// TemperatureMin and TemperatureMax bound color temperatures in Kelvin.
+	TemperatureMin = 2900
+	TemperatureMax = 7000
+
+	// RawTemperatureMin and RawTemperatureMax bound color temperatures in
+	// native Elgato API units.
+	RawTemperatureMin = 143
+	RawTemperatureMax = 344
+
+	// HueMin and HueMax bound hues in degrees.
+	HueMin = 0
+	HueMax = 360
+
+	// SaturationMin and SaturationMax bound saturation percentages.
+	SaturationMin = 0
+	SaturationMax = 100
 )
 
 // A Client can control Elgato Key Light devices.
 type Client struct {
 	c *http.Client
 	u *url.URL
+
+	// Optional request behaviors configured by Options.
+	retry      *RetryPolicy
+	sem        chan struct{}
+	userAgent  string
+	log        *slog.Logger
+	middleware []Middleware
+	timeouts   Timeouts
 }
 
 // NewClient creates a Client for the Key Light specified by addr. If c is nil,
 // a default HTTP client will be configured.
+//
+// NewClient is equivalent to calling New with WithHTTPClient(c).
 func NewClient(addr string, c *http.Client) (*Client, error) {
-	if c == nil {
-		c = &http.Client{Timeout: 2 * time.Second}
-	}
-
-	u, err := url.Parse(addr)
-	if err != nil {
-		return nil, err
-	}
+	return New(addr, WithHTTPClient(c))
+}
 
-	return &Client{
-		c: c,
-		u: u,
-	}, nil
+// Addr returns the address of the Key Light device controlled by the Client.
+func (c *Client) Addr() string {
+	return c.u.String()
 }
 
 // A Device contains metadata about an Elgato Key Light device.
@@ -56,8 +72,34 @@ type Device struct {
 	FirmwareVersion     string `json:"firmwareVersion,omitempty"`
 	SerialNumber        string `json:"serialNumber,omitempty"`
 	DisplayName         string `json:"displayName,omitempty"`
+	MACAddress          string `json:"macAddress,omitempty"`
+
+	// Features lists the capabilities of the device. Use Supports to check
+	// for an individual Feature.
+	Features []Feature `json:"features,omitempty"`
 
-	// TODO: add features?
+	// WiFi reports the device's current wireless network connection, if
+	// known.
+	WiFi *WiFiStatus `json:"wifi-info,omitempty"`
+}
+
+// A Feature is a capability reported by an Elgato device.
+type Feature string
+
+// Possible Feature values reported by Elgato devices.
+const (
+	FeatureLights Feature = "lights"
+)
+
+// Supports reports whether the device advertises Feature f.
+func (d *Device) Supports(f Feature) bool {
+	for _, df := range d.Features {
+		if df == f {
+			return true
+		}
+	}
+
+	return false
 }
 
 // AccessoryInfo fetches information about a Key Light device.
@@ -77,7 +119,7 @@ func (c *Client) SetDisplayName(ctx context.Context, name string) error {
 		return err
 	}
 
-	return c.do(ctx, http.MethodPut, "/elgato/accessory-info", bytes.NewReader(b), nil)
+	return c.do(ctx, http.MethodPut, "/elgato/accessory-info", b, nil)
 }
 
 // Identify informs the Key Light device to flash its light for easy identification.
@@ -98,32 +140,89 @@ type Light struct {
 	// Brightness is the brightness level of the light with a valid range of 3-100.
 	Brightness int
 
+	// Mode is the light's color mode, which determines whether Temperature or
+	// Hue and Saturation are used to set its color.
+	Mode ColorMode
+
 	// Temperature is the light's color temperature with a valid range of 2900-7000K.
 	Temperature int
+
+	// RawTemperature is the light's color temperature in native Elgato API
+	// units with a valid range of 143-344, as reported by the device. Because
+	// Temperature is rounded to 50K, RawTemperature is sent to the device in
+	// its place whenever it still converts to Temperature, so that lights
+	// which are read and written back without modification are unchanged. If
+	// Temperature is zero, RawTemperature alone sets the light's color.
+	RawTemperature int
+
+	// Hue is the light's hue in degrees with a valid range of 0-360.
+	Hue float64
+
+	// Saturation is the light's color saturation with a valid range of 0-100.
+	Saturation float64
 }
 
+// A ColorMode determines how the color of a Light is set.
+type ColorMode int
+
+// Possible ColorMode values for use in a Light.
+const (
+	// ColorModeTemperature sets the light's color using Temperature, and is
+	// supported by all Key Light devices.
+	ColorModeTemperature ColorMode = iota
+
+	// ColorModeHueSaturation sets the light's color using Hue and Saturation,
+	// and is supported by color-capable devices such as the Light Strip.
+	ColorModeHueSaturation
+)
+
 // A jsonLight is the raw JSON representation of a Light.
 type jsonLight struct {
-	On          int `json:"on"`
-	Brightness  int `json:"brightness"`
-	Temperature int `json:"temperature"`
+	On          int      `json:"on"`
+	Brightness  int      `json:"brightness"`
+	Temperature *int     `json:"temperature,omitempty"`
+	Hue         *float64 `json:"hue,omitempty"`
+	Saturation  *float64 `json:"saturation,omitempty"`
 }
 
 // MarshalJSON implements json.Marshaler.
 func (l *Light) MarshalJSON() ([]byte, error) {
-	jl := jsonLight{
-		Brightness: l.Brightness,
-		// The API has its own format but Kelvin is more friendly for users.
-		Temperature: convertToAPI(l.Temperature),
-	}
+	jl := jsonLight{Brightness: l.Brightness}
 
 	if l.On {
 		jl.On = 1
 	}
 
+	// Only send the fields for the light's color mode so a device will not
+	// switch modes unexpectedly.
+	switch l.Mode {
+	case ColorModeHueSaturation:
+		hue, sat := l.Hue, l.Saturation
+		jl.Hue, jl.Saturation = &hue, &sat
+	default:
+		temp := l.rawTemperature()
+		jl.Temperature = &temp
+	}
+
 	return json.Marshal(jl)
 }
 
+// rawTemperature returns the light's color temperature in API units,
+// preferring RawTemperature when it is consistent with Temperature.
+func (l *Light) rawTemperature() int {
+	return preferRaw(l.RawTemperature, l.Temperature)
+}
+
+// preferRaw returns raw if it is set and consistent with kelvin, which may be
+// zero, or otherwise converts kelvin to API units.
+func preferRaw(raw, kelvin int) int {
+	if raw != 0 && (kelvin == 0 || RawToKelvin(raw) == kelvin) {
+		return raw
+	}
+
+	return KelvinToRaw(kelvin)
+}
+
 // UnmarshalJSON implements json.Unmarshaler.
 func (l *Light) UnmarshalJSON(b []byte) error {
 	var jl jsonLight
@@ -131,10 +230,28 @@ func (l *Light) UnmarshalJSON(b []byte) error {
 		return err
 	}
 
-	l.On = jl.On == 1
-	l.Brightness = jl.Brightness
-	// The API has its own format but Kelvin is more friendly for users.
-	l.Temperature = convertToKelvin(jl.Temperature)
+	*l = Light{
+		On:         jl.On == 1,
+		Brightness: jl.Brightness,
+	}
+
+	if jl.Temperature != nil {
+		// The API has its own format but Kelvin is more friendly for users.
+		// Keep the raw value as well so it can be written back exactly.
+		l.Temperature = RawToKelvin(*jl.Temperature)
+		l.RawTemperature = *jl.Temperature
+	}
+
+	// Devices which report hue or saturation are operating in color mode.
+	if jl.Hue != nil || jl.Saturation != nil {
+		l.Mode = ColorModeHueSaturation
+		if jl.Hue != nil {
+			l.Hue = *jl.Hue
+		}
+		if jl.Saturation != nil {
+			l.Saturation = *jl.Saturation
+		}
+	}
 
 	return nil
 }
@@ -156,34 +273,79 @@ func (c *Client) Lights(ctx context.Context) ([]*Light, error) {
 
 // SetLights configures the state of all lights on a Key Light device.
 func (c *Client) SetLights(ctx context.Context, lights []*Light) error {
-	for _, l := range lights {
-		if l.Temperature < tempMin || l.Temperature > tempMax {
-			return fmt.Errorf("temperature (%d) out of range 2900 <= x <= 7000", l.Temperature)
-		}
+	_, err := c.ApplyLights(ctx, lights)
+	return err
+}
 
-		if l.Brightness < brightnessMin || l.Brightness > brightnessMax {
-			return fmt.Errorf("brightness (%d) out of range 3 <= x <= 100", l.Brightness)
-		}
+// ApplyLights configures the state of all lights on a Key Light device, and
+// returns the state of the lights as reported by the device after applying
+// the configuration. The device may adjust the requested values, for example
+// by rounding color temperatures to those supported by the hardware.
+func (c *Client) ApplyLights(ctx context.Context, lights []*Light) ([]*Light, error) {
+	if err := validateLights(lights); err != nil {
+		return nil, err
 	}
 
 	// This structure is small enough where marshaling the whole thing in memory
 	// is not a concern.
 	b, err := json.Marshal(lightsBody{Lights: lights})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	var body lightsBody
-	if err := c.do(ctx, http.MethodPut, "/elgato/lights", bytes.NewReader(b), &body); err != nil {
-		return err
+	if err := c.do(ctx, http.MethodPut, "/elgato/lights", b, &body); err != nil {
+		return nil, err
 	}
 
 	// The device will ignore configuration for any lights which do not exist,
 	// but we treat this as an error because the caller should only attempt to
 	// configure the number of lights present on the device.
 	if len(body.Lights) != len(lights) {
-		return fmt.Errorf("keylight: attempted to configure %d lights, but %d are present",
-			len(lights), len(body.Lights))
+		return nil, &LightCountError{
+			Configured: len(lights),
+			Present:    len(body.Lights),
+		}
+	}
+
+	return body.Lights, nil
+}
+
+// maxErrorBody is the maximum number of bytes of a response body included in
+// an HTTPError.
+const maxErrorBody = 1024
+
+// validateLights verifies that all values of lights are within their valid
+// ranges.
+func validateLights(lights []*Light) error {
+	for _, l := range lights {
+		switch l.Mode {
+		case ColorModeTemperature:
+			if l.Temperature == 0 && l.RawTemperature != 0 {
+				if err := checkRange("raw temperature", l.RawTemperature, RawTemperatureMin, RawTemperatureMax); err != nil {
+					return err
+				}
+				break
+			}
+
+			if err := checkRange("temperature", l.Temperature, TemperatureMin, TemperatureMax); err != nil {
+				return err
+			}
+		case ColorModeHueSaturation:
+			if err := checkRange("hue", l.Hue, HueMin, HueMax); err != nil {
+				return err
+			}
+
+			if err := checkRange("saturation", l.Saturation, SaturationMin, SaturationMax); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("color mode (%d) is invalid", l.Mode)
+		}
+
+		if err := checkRange("brightness", l.Brightness, BrightnessMin, BrightnessMax); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -196,14 +358,56 @@ const (
 )
 
 // do performs an HTTP request with the input parameters, optionally
-// unmarshaling a JSON body into out if out is not nil.
-func (c *Client) do(ctx context.Context, method, path string, body io.Reader, out interface{}) error {
+// unmarshaling a JSON body into out if out is not nil. Requests are retried
+// according to the Client's RetryPolicy.
+func (c *Client) do(ctx context.Context, method, path string, body []byte, out interface{}) error {
+	ctx, cancel := c.withTimeout(ctx, method)
+	defer cancel()
+
+	attempts := 1
+	if c.retry != nil && idempotent(method) {
+		attempts = c.retry.Attempts
+	}
+
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 && !c.retry.wait(ctx, i) {
+			// Canceled while waiting, report the most recent failure.
+			break
+		}
+
+		err = c.once(ctx, method, path, body, out)
+		if err == nil || ctx.Err() != nil || !retryable(err) {
+			return err
+		}
+	}
+
+	return err
+}
+
+// once performs a single attempt of an HTTP request for do.
+func (c *Client) once(ctx context.Context, method, path string, body []byte, out interface{}) error {
+	if c.sem != nil {
+		// Requests are serialized, wait for our turn.
+		select {
+		case c.sem <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		defer func() { <-c.sem }()
+	}
+
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+
 	// Make a copy of c.u before manipulating the path to avoid modifying the
 	// base URL.
 	u := *c.u
 	u.Path = path
 
-	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), r)
 	if err != nil {
 		return err
 	}
@@ -217,15 +421,29 @@ func (c *Client) do(ctx context.Context, method, path string, body io.Reader, ou
 		content = contentJSON
 	}
 	req.Header.Set("Content-Type", content)
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
 
+	start := time.Now()
 	res, err := c.c.Do(req)
 	if err != nil {
+		err = classify(err)
+		c.logRequest(ctx, req, start, "request failed", slog.Any("err", err))
 		return err
 	}
 	defer res.Body.Close()
 
+	c.logRequest(ctx, req, start, "request complete", slog.Int("status", res.StatusCode))
+
 	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("keylight: device returned HTTP %d", res.StatusCode)
+		// Include the beginning of the body for diagnostics, but don't allow
+		// the device to send an arbitrary amount of data.
+		b, _ := io.ReadAll(io.LimitReader(res.Body, maxErrorBody))
+		return &HTTPError{
+			StatusCode: res.StatusCode,
+			Body:       b,
+		}
 	}
 
 	if out == nil {
@@ -240,18 +458,16 @@ func (c *Client) do(ctx context.Context, method, path string, body io.Reader, ou
 	return nil
 }
 
-// convertToKelvin converts the Elgato API temperatures to Kelvin.
-func convertToKelvin(elgato int) int {
-	kelvin := tempConstant - int(math.Round(float64(elgato)*tempCoefficent))
-	remainder := kelvin % tempStep
-	if remainder > tempHalfstep {
-		return kelvin + tempStep - remainder
+// logRequest logs information about req if logging is enabled.
+func (c *Client) logRequest(ctx context.Context, req *http.Request, start time.Time, msg string, attr slog.Attr) {
+	if c.log == nil {
+		return
 	}
-	return kelvin - remainder
-}
 
-// convertToAPI converts Kelvin temperatures to those of the Elgato API.
-func convertToAPI(kelvin int) int {
-	elgato := float64(kelvin-tempConstant) / tempCoefficent
-	return int(math.Abs(math.Trunc(elgato)))
+	c.log.LogAttrs(ctx, slog.LevelDebug, msg,
+		slog.String("method", req.Method),
+		slog.String("url", req.URL.String()),
+		slog.Duration("duration", time.Since(start)),
+		attr,
+	)
 }
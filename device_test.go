@@ -13,9 +13,14 @@ import (
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/mdlayher/keylight"
 )
 
+// ignoreRaw ignores raw temperatures when comparing lights, for tests which
+// only deal with temperatures in Kelvin.
+var ignoreRaw = cmpopts.IgnoreFields(keylight.Light{}, "RawTemperature")
+
 func TestClientAccessoryInfo(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
 	defer cancel()
@@ -50,6 +55,49 @@ func TestClientAccessoryInfo(t *testing.T) {
 	}
 }
 
+func TestClientAccessoryInfoExtended(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	c := testClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		// Raw output from a Key Light device.
+		_, _ = io.WriteString(w, `{"productName":"Elgato Key Light","hardwareBoardType":53,"firmwareBuildNumber":218,"firmwareVersion":"1.0.3","serialNumber":"ABCDEFGHIJKL","displayName":"Office","features":["lights"],"macAddress":"3C:6A:9D:00:11:22","wifi-info":{"ssid":"Elgato SSID","frequencyMHz":2400,"rssi":-48}}`)
+	})
+
+	got, err := c.AccessoryInfo(ctx)
+	if err != nil {
+		t.Fatalf("failed to fetch device: %v", err)
+	}
+
+	want := &keylight.Device{
+		ProductName:         "Elgato Key Light",
+		HardwareBoardType:   53,
+		FirmwareBuildNumber: 218,
+		FirmwareVersion:     "1.0.3",
+		SerialNumber:        "ABCDEFGHIJKL",
+		DisplayName:         "Office",
+		MACAddress:          "3C:6A:9D:00:11:22",
+		Features:            []keylight.Feature{keylight.FeatureLights},
+		WiFi: &keylight.WiFiStatus{
+			SSID:         "Elgato SSID",
+			FrequencyMHz: 2400,
+			RSSI:         -48,
+		},
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected device (-want +got):\n%s", diff)
+	}
+
+	if !got.Supports(keylight.FeatureLights) {
+		t.Fatal("device does not support lights")
+	}
+
+	if got.Supports("battery") {
+		t.Fatal("device unexpectedly supports battery")
+	}
+}
+
 func TestClientSetDisplayName(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
 	defer cancel()
@@ -106,9 +154,10 @@ func TestClientLights(t *testing.T) {
 	defer cancel()
 
 	want := []*keylight.Light{{
-		On:          true,
-		Brightness:  15,
-		Temperature: 3400,
+		On:             true,
+		Brightness:     15,
+		Temperature:    3400,
+		RawTemperature: 319,
 	}}
 
 	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
@@ -197,6 +246,49 @@ func TestClientSetLights(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "OK hue and saturation",
+			lights: []*keylight.Light{{
+				On:         true,
+				Brightness: 15,
+				Mode:       keylight.ColorModeHueSaturation,
+				Hue:        240,
+				Saturation: 50,
+			}},
+		},
+		{
+			name: "hue outside of range",
+			lights: []*keylight.Light{
+				{On: true, Brightness: 15, Mode: keylight.ColorModeHueSaturation, Hue: 360.5},
+			},
+			check: func(t *testing.T, err error) {
+				if !strings.Contains(err.Error(), "hue (360.5) out of range 0 <= x <= 360") {
+					t.Fatalf("error did not mention malformed hue input: %v", err)
+				}
+			},
+		},
+		{
+			name: "saturation outside of range",
+			lights: []*keylight.Light{
+				{On: true, Brightness: 15, Mode: keylight.ColorModeHueSaturation, Saturation: -1},
+			},
+			check: func(t *testing.T, err error) {
+				if !strings.Contains(err.Error(), "saturation (-1) out of range 0 <= x <= 100") {
+					t.Fatalf("error did not mention malformed saturation input: %v", err)
+				}
+			},
+		},
+		{
+			name: "bad color mode",
+			lights: []*keylight.Light{
+				{On: true, Brightness: 15, Mode: 10},
+			},
+			check: func(t *testing.T, err error) {
+				if !strings.Contains(err.Error(), "color mode (10) is invalid") {
+					t.Fatalf("error did not mention malformed color mode: %v", err)
+				}
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -240,6 +332,85 @@ func TestClientSetLights(t *testing.T) {
 	}
 }
 
+func TestClientApplyLights(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	d, c := testDeviceClient(t)
+
+	// The device snaps the temperature to one it supports, and the applied
+	// state should reflect that rather than the requested state.
+	got, err := c.ApplyLights(ctx, []*keylight.Light{{
+		On:          true,
+		Brightness:  40,
+		Temperature: 5025,
+	}})
+	if err != nil {
+		t.Fatalf("failed to apply lights: %v", err)
+	}
+
+	want := []*keylight.Light{{On: true, Brightness: 40, Temperature: 5000}}
+	if diff := cmp.Diff(want, got, ignoreRaw); diff != "" {
+		t.Fatalf("unexpected applied lights (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(want, d.Lights(), ignoreRaw); diff != "" {
+		t.Fatalf("unexpected device lights (-want +got):\n%s", diff)
+	}
+}
+
+func TestLightJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		light *keylight.Light
+		json  string
+	}{
+		{
+			name: "temperature",
+			light: &keylight.Light{
+				On:             true,
+				Brightness:     20,
+				Temperature:    2900,
+				RawTemperature: 344,
+			},
+			json: `{"on":1,"brightness":20,"temperature":344}`,
+		},
+		{
+			name: "hue and saturation",
+			light: &keylight.Light{
+				On:         true,
+				Brightness: 20,
+				Mode:       keylight.ColorModeHueSaturation,
+				Hue:        40.5,
+				Saturation: 77,
+			},
+			json: `{"on":1,"brightness":20,"hue":40.5,"saturation":77}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(tt.light)
+			if err != nil {
+				t.Fatalf("failed to marshal: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.json, string(b)); diff != "" {
+				t.Fatalf("unexpected JSON (-want +got):\n%s", diff)
+			}
+
+			var l keylight.Light
+			if err := json.Unmarshal(b, &l); err != nil {
+				t.Fatalf("failed to unmarshal: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.light, &l); diff != "" {
+				t.Fatalf("unexpected light (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 func TestClientErrors(t *testing.T) {
 	tests := []struct {
 		name  string
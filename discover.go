@@ -0,0 +1,305 @@
+package keylight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// mdnsAddr is the IPv4 multicast DNS group and port.
+	mdnsAddr = "224.0.0.251:5353"
+
+	// serviceName is the DNS-SD service type advertised by Elgato devices.
+	serviceName = "_elg._tcp.local."
+
+	// discoverTimeout is the browse duration used when the caller's context
+	// has no deadline.
+	discoverTimeout = 1 * time.Second
+)
+
+// A DiscoverConfig configures Key Light device discovery. A nil *DiscoverConfig
+// applies default settings.
+type DiscoverConfig struct {
+	// Addr is the UDP address which receives discovery queries. If empty,
+	// the IPv4 multicast DNS group 224.0.0.251:5353 is used.
+	Addr string
+}
+
+// A Service is a Key Light device discovered using multicast DNS.
+type Service struct {
+	// Instance is the DNS-SD service instance name, such as
+	// "Elgato Key Light 1A2B".
+	Instance string
+
+	// Host is the host name advertised by the device.
+	Host string
+
+	// Addr is the address of the device's HTTP API, suitable for use with
+	// NewClient.
+	Addr string
+
+	// AddrPort is the IP address and TCP port of the device's HTTP API.
+	AddrPort netip.AddrPort
+
+	// TXT contains the key/value metadata from the device's TXT record, such
+	// as its model ("md") and identifier ("id").
+	TXT map[string]string
+}
+
+// Discover browses for Elgato devices using multicast DNS until ctx is
+// canceled or its deadline expires, and returns all devices which responded.
+// If ctx has no deadline, a default browse duration of 1 second is applied.
+//
+// Queries request unicast responses so that Discover does not need to join
+// the multicast DNS group or bind port 5353.
+func Discover(ctx context.Context, cfg *DiscoverConfig) ([]*Service, error) {
+	if cfg == nil {
+		cfg = &DiscoverConfig{}
+	}
+
+	addr := cfg.Addr
+	if addr == "" {
+		addr = mdnsAddr
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, discoverTimeout)
+		defer cancel()
+	}
+
+	dst, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	query, err := discoverQuery()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := conn.WriteTo(query, dst); err != nil {
+		return nil, err
+	}
+
+	// Unblock any pending reads as soon as the context is done.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.SetReadDeadline(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+
+	b := newBrowser()
+	buf := make([]byte, 9000)
+	for {
+		n, src, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				// Browsing is complete.
+				break
+			}
+
+			return nil, err
+		}
+
+		// Ignore any malformed or unrelated traffic.
+		_ = b.parse(buf[:n], src)
+	}
+
+	return b.services(), nil
+}
+
+// discoverQuery builds a DNS-SD PTR query for Elgato devices which requests
+// unicast responses.
+func discoverQuery() ([]byte, error) {
+	name, err := dnsmessage.NewName(serviceName)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := dnsmessage.Message{
+		Questions: []dnsmessage.Question{{
+			Name: name,
+			Type: dnsmessage.TypePTR,
+			// The top bit of the class requests a unicast response.
+			Class: dnsmessage.ClassINET | 1<<15,
+		}},
+	}
+
+	return msg.Pack()
+}
+
+// A srv is the target of a DNS-SD service instance.
+type srv struct {
+	host string
+	port uint16
+}
+
+// A browser accumulates the records from multicast DNS responses.
+type browser struct {
+	instances map[string]string
+	srvs      map[string]srv
+	txts      map[string]map[string]string
+	addrs     map[string][]netip.Addr
+	sources   map[string]netip.Addr
+}
+
+func newBrowser() *browser {
+	return &browser{
+		instances: make(map[string]string),
+		srvs:      make(map[string]srv),
+		txts:      make(map[string]map[string]string),
+		addrs:     make(map[string][]netip.Addr),
+		sources:   make(map[string]netip.Addr),
+	}
+}
+
+// parse parses a single multicast DNS response from src.
+func (b *browser) parse(buf []byte, src *net.UDPAddr) error {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(buf); err != nil {
+		return err
+	}
+	if !msg.Header.Response {
+		return errors.New("keylight: not a DNS response")
+	}
+
+	// Responders typically place the PTR record in the answer section and
+	// the remaining records in the additional section, but accept any order.
+	rrs := make([]dnsmessage.Resource, 0, len(msg.Answers)+len(msg.Additionals))
+	rrs = append(rrs, msg.Answers...)
+	rrs = append(rrs, msg.Additionals...)
+
+	for _, rr := range rrs {
+		name := strings.ToLower(rr.Header.Name.String())
+
+		switch body := rr.Body.(type) {
+		case *dnsmessage.PTRResource:
+			if name != serviceName {
+				continue
+			}
+
+			// Instance names are compared case-insensitively but retain their
+			// original case for display.
+			inst := body.PTR.String()
+			if !strings.HasSuffix(strings.ToLower(inst), "."+serviceName) {
+				continue
+			}
+
+			b.instances[strings.ToLower(inst)] = inst
+			if ip, ok := netip.AddrFromSlice(src.IP); ok {
+				b.sources[strings.ToLower(inst)] = ip.Unmap()
+			}
+		case *dnsmessage.SRVResource:
+			b.srvs[name] = srv{
+				host: strings.ToLower(body.Target.String()),
+				port: body.Port,
+			}
+		case *dnsmessage.TXTResource:
+			b.txts[name] = parseTXT(body.TXT)
+		case *dnsmessage.AResource:
+			b.addAddr(name, netip.AddrFrom4(body.A))
+		case *dnsmessage.AAAAResource:
+			b.addAddr(name, netip.AddrFrom16(body.AAAA))
+		}
+	}
+
+	return nil
+}
+
+// addAddr adds ip to the addresses of host, ignoring duplicates.
+func (b *browser) addAddr(host string, ip netip.Addr) {
+	for _, a := range b.addrs[host] {
+		if a == ip {
+			return
+		}
+	}
+
+	b.addrs[host] = append(b.addrs[host], ip)
+}
+
+// services produces Services from all complete instances found during
+// browsing, sorted by instance name.
+func (b *browser) services() []*Service {
+	var ss []*Service
+	for key, inst := range b.instances {
+		srv, ok := b.srvs[key]
+		if !ok {
+			// Cannot determine the HTTP API port.
+			continue
+		}
+
+		ip, ok := b.addr(key, srv.host)
+		if !ok {
+			continue
+		}
+
+		ap := netip.AddrPortFrom(ip, srv.port)
+		ss = append(ss, &Service{
+			Instance: inst[:len(inst)-len(serviceName)-1],
+			Host:     srv.host,
+			Addr:     fmt.Sprintf("http://%s", ap),
+			AddrPort: ap,
+			TXT:      b.txts[key],
+		})
+	}
+
+	sort.Slice(ss, func(i, j int) bool {
+		return ss[i].Instance < ss[j].Instance
+	})
+
+	return ss
+}
+
+// addr selects an IP address for a service instance, preferring IPv4
+// addresses and falling back to the source address of the response.
+func (b *browser) addr(inst, host string) (netip.Addr, bool) {
+	addrs := b.addrs[host]
+	for _, a := range addrs {
+		if a.Is4() {
+			return a, true
+		}
+	}
+	for _, a := range addrs {
+		// Link-local IPv6 addresses are unusable without a zone.
+		if !a.IsLinkLocalUnicast() {
+			return a, true
+		}
+	}
+
+	ip, ok := b.sources[inst]
+	return ip, ok
+}
+
+// parseTXT parses key=value TXT record strings into a map.
+func parseTXT(txt []string) map[string]string {
+	m := make(map[string]string, len(txt))
+	for _, s := range txt {
+		k, v, _ := strings.Cut(s, "=")
+		if k == "" {
+			continue
+		}
+
+		m[strings.ToLower(k)] = v
+	}
+
+	return m
+}
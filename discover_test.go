@@ -0,0 +1,201 @@
+package keylight_test
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/keylight"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestDiscover(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	addr := testResponder(t, func(q dnsmessage.Question) []dnsmessage.Resource {
+		if diff := cmp.Diff("_elg._tcp.local.", q.Name.String()); diff != "" {
+			panicf("unexpected question name (-want +got):\n%s", diff)
+		}
+
+		if diff := cmp.Diff(dnsmessage.TypePTR, q.Type); diff != "" {
+			panicf("unexpected question type (-want +got):\n%s", diff)
+		}
+
+		var (
+			service = mustName("_elg._tcp.local.")
+			inst1   = mustName("Elgato Key Light 1A2B._elg._tcp.local.")
+			inst2   = mustName("Elgato Key Light Air 3C4D._elg._tcp.local.")
+			host1   = mustName("elgato-key-light-1a2b.local.")
+			host2   = mustName("elgato-key-light-air-3c4d.local.")
+		)
+
+		return []dnsmessage.Resource{
+			rr(service, &dnsmessage.PTRResource{PTR: inst1}),
+			rr(service, &dnsmessage.PTRResource{PTR: inst2}),
+			rr(inst1, &dnsmessage.SRVResource{Target: host1, Port: 9123}),
+			rr(inst1, &dnsmessage.TXTResource{TXT: []string{"mf=Elgato", "md=Elgato Key Light 20GAK9901", "id=3C:6A:9D:00:1A:2B"}}),
+			rr(host1, &dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}}),
+			// No address records for the second instance, so the source
+			// address of the response must be used.
+			rr(inst2, &dnsmessage.SRVResource{Target: host2, Port: 9123}),
+			rr(inst2, &dnsmessage.TXTResource{TXT: []string{"md=Elgato Key Light Air 20LAB9901"}}),
+			// Unrelated services must be ignored.
+			rr(mustName("_http._tcp.local."), &dnsmessage.PTRResource{PTR: mustName("printer._http._tcp.local.")}),
+		}
+	})
+
+	got, err := keylight.Discover(ctx, &keylight.DiscoverConfig{Addr: addr})
+	if err != nil {
+		t.Fatalf("failed to discover: %v", err)
+	}
+
+	want := []*keylight.Service{
+		{
+			Instance: "Elgato Key Light 1A2B",
+			Host:     "elgato-key-light-1a2b.local.",
+			Addr:     "http://192.0.2.1:9123",
+			AddrPort: netip.MustParseAddrPort("192.0.2.1:9123"),
+			TXT: map[string]string{
+				"mf": "Elgato",
+				"md": "Elgato Key Light 20GAK9901",
+				"id": "3C:6A:9D:00:1A:2B",
+			},
+		},
+		{
+			Instance: "Elgato Key Light Air 3C4D",
+			Host:     "elgato-key-light-air-3c4d.local.",
+			Addr:     "http://127.0.0.1:9123",
+			AddrPort: netip.MustParseAddrPort("127.0.0.1:9123"),
+			TXT: map[string]string{
+				"md": "Elgato Key Light Air 20LAB9901",
+			},
+		},
+	}
+
+	if diff := cmp.Diff(want, got, cmp.Comparer(func(x, y netip.AddrPort) bool {
+		return x == y
+	})); diff != "" {
+		t.Fatalf("unexpected services (-want +got):\n%s", diff)
+	}
+}
+
+func TestDiscoverNoResponses(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	addr := testResponder(t, func(_ dnsmessage.Question) []dnsmessage.Resource {
+		return nil
+	})
+
+	got, err := keylight.Discover(ctx, &keylight.DiscoverConfig{Addr: addr})
+	if err != nil {
+		t.Fatalf("failed to discover: %v", err)
+	}
+
+	if len(got) != 0 {
+		t.Fatalf("expected no services, but got: %v", got)
+	}
+}
+
+// testResponder starts an mDNS responder on loopback which answers the first
+// question of each query using fn. It returns the responder's address.
+func testResponder(t *testing.T, fn func(q dnsmessage.Question) []dnsmessage.Resource) string {
+	t.Helper()
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	done := make(chan struct{})
+	t.Cleanup(func() {
+		_ = conn.Close()
+		<-done
+	})
+
+	go func() {
+		defer close(done)
+
+		buf := make([]byte, 9000)
+		for {
+			n, src, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+
+			var q dnsmessage.Message
+			if err := q.Unpack(buf[:n]); err != nil {
+				panicf("failed to unpack query: %v", err)
+			}
+
+			if len(q.Questions) != 1 {
+				panicf("expected one question, but got %d", len(q.Questions))
+			}
+
+			rrs := fn(q.Questions[0])
+			if len(rrs) == 0 {
+				continue
+			}
+
+			// Send the PTR records as answers and the rest as additional
+			// records, as is typical for DNS-SD responders.
+			res := dnsmessage.Message{
+				Header: dnsmessage.Header{Response: true, Authoritative: true},
+			}
+			for _, rr := range rrs {
+				if rr.Header.Type == dnsmessage.TypePTR {
+					res.Answers = append(res.Answers, rr)
+				} else {
+					res.Additionals = append(res.Additionals, rr)
+				}
+			}
+
+			b, err := res.Pack()
+			if err != nil {
+				panicf("failed to pack response: %v", err)
+			}
+
+			if _, err := conn.WriteToUDP(b, src); err != nil {
+				panicf("failed to write response: %v", err)
+			}
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+func rr(name dnsmessage.Name, body dnsmessage.ResourceBody) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{
+			Name:  name,
+			Type:  rrType(body),
+			Class: dnsmessage.ClassINET,
+			TTL:   120,
+		},
+		Body: body,
+	}
+}
+
+func rrType(body dnsmessage.ResourceBody) dnsmessage.Type {
+	switch body.(type) {
+	case *dnsmessage.PTRResource:
+		return dnsmessage.TypePTR
+	case *dnsmessage.SRVResource:
+		return dnsmessage.TypeSRV
+	case *dnsmessage.TXTResource:
+		return dnsmessage.TypeTXT
+	case *dnsmessage.AResource:
+		return dnsmessage.TypeA
+	default:
+		panicf("unhandled resource body: %T", body)
+		return 0
+	}
+}
+
+func mustName(s string) dnsmessage.Name {
+	return dnsmessage.MustNewName(s)
+}
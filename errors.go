@@ -0,0 +1,110 @@
+package keylight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// Sentinel errors which may be checked using errors.Is.
+var (
+	// ErrTimeout indicates that a request did not complete before its context
+	// deadline or the HTTP client's timeout expired.
+	ErrTimeout = errors.New("keylight: request timed out")
+
+	// ErrUnreachable indicates that a request could not be delivered to a
+	// device or the device did not respond, such as when the device is
+	// powered off or the connection is reset.
+	ErrUnreachable = errors.New("keylight: device unreachable")
+
+	// ErrSceneNotFound indicates that a SceneStore does not contain a Scene
+	// with the requested name.
+	ErrSceneNotFound = errors.New("keylight: scene not found")
+)
+
+// An HTTPError is returned when a device responds with an unexpected HTTP
+// status.
+type HTTPError struct {
+	// StatusCode is the HTTP status code returned by the device.
+	StatusCode int
+
+	// Body contains the beginning of the response body, if any.
+	Body []byte
+}
+
+// Error implements error.
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("keylight: device returned HTTP %d", e.StatusCode)
+}
+
+// A RangeError is returned when a value is outside of the range accepted by a
+// device.
+type RangeError struct {
+	// Field is the name of the value, such as "temperature".
+	Field string
+
+	// Value is the invalid value and Min and Max are the inclusive bounds of
+	// the valid range.
+	Value, Min, Max float64
+}
+
+// Error implements error.
+func (e *RangeError) Error() string {
+	return fmt.Sprintf("%s (%v) out of range %v <= x <= %v", e.Field, e.Value, e.Min, e.Max)
+}
+
+// checkRange returns a *RangeError if v is outside the range min <= v <= max.
+func checkRange[T int | float64](field string, v, min, max T) error {
+	if v >= min && v <= max {
+		return nil
+	}
+
+	return &RangeError{
+		Field: field,
+		Value: float64(v),
+		Min:   float64(min),
+		Max:   float64(max),
+	}
+}
+
+// A LightCountError is returned when a caller attempts to configure a
+// different number of lights than are present on a device.
+type LightCountError struct {
+	// Configured is the number of lights the caller attempted to configure.
+	Configured int
+
+	// Present is the number of lights present on the device.
+	Present int
+}
+
+// Error implements error.
+func (e *LightCountError) Error() string {
+	return fmt.Sprintf("keylight: attempted to configure %d lights, but %d are present",
+		e.Configured, e.Present)
+}
+
+// A requestError wraps a transport error with a sentinel error which
+// classifies it.
+type requestError struct {
+	sentinel error
+	err      error
+}
+
+// classify wraps transport errors from an HTTP client with ErrTimeout or
+// ErrUnreachable. Cancelation by the caller is returned unmodified.
+func classify(err error) error {
+	var nerr net.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+		return err
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &nerr) && nerr.Timeout():
+		return &requestError{sentinel: ErrTimeout, err: err}
+	default:
+		return &requestError{sentinel: ErrUnreachable, err: err}
+	}
+}
+
+func (e *requestError) Error() string        { return fmt.Sprintf("%v: %v", e.sentinel, e.err) }
+func (e *requestError) Is(target error) bool { return target == e.sentinel }
+func (e *requestError) Unwrap() error        { return e.err }
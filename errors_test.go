@@ -0,0 +1,167 @@
+package keylight_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/keylight"
+)
+
+func TestClientHTTPError(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	c := testClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = io.WriteString(w, "internal error")
+	})
+
+	_, err := c.AccessoryInfo(ctx)
+
+	var herr *keylight.HTTPError
+	if !errors.As(err, &herr) {
+		t.Fatalf("expected HTTP error, but got: %v", err)
+	}
+
+	want := &keylight.HTTPError{
+		StatusCode: http.StatusInternalServerError,
+		Body:       []byte("internal error"),
+	}
+
+	if diff := cmp.Diff(want, herr); diff != "" {
+		t.Fatalf("unexpected HTTP error (-want +got):\n%s", diff)
+	}
+}
+
+func TestClientRangeError(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	c := testClient(t, func(_ http.ResponseWriter, _ *http.Request) {
+		panic("request should not be sent")
+	})
+
+	err := c.SetLights(ctx, []*keylight.Light{{Brightness: 50, Temperature: 7050}})
+
+	var rerr *keylight.RangeError
+	if !errors.As(err, &rerr) {
+		t.Fatalf("expected range error, but got: %v", err)
+	}
+
+	want := &keylight.RangeError{
+		Field: "temperature",
+		Value: 7050,
+		Min:   2900,
+		Max:   7000,
+	}
+
+	if diff := cmp.Diff(want, rerr); diff != "" {
+		t.Fatalf("unexpected range error (-want +got):\n%s", diff)
+	}
+}
+
+func TestClientLightCountError(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	c := testClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, `{"numberOfLights":1,"lights":[{"on":1,"brightness":20,"temperature":213}]}`)
+	})
+
+	light := &keylight.Light{Brightness: 20, Temperature: 5550}
+	err := c.SetLights(ctx, []*keylight.Light{light, light})
+
+	var lerr *keylight.LightCountError
+	if !errors.As(err, &lerr) {
+		t.Fatalf("expected light count error, but got: %v", err)
+	}
+
+	want := &keylight.LightCountError{Configured: 2, Present: 1}
+	if diff := cmp.Diff(want, lerr); diff != "" {
+		t.Fatalf("unexpected light count error (-want +got):\n%s", diff)
+	}
+}
+
+func TestClientErrTimeout(t *testing.T) {
+	tests := []struct {
+		name string
+		c    *http.Client
+	}{
+		{
+			name: "context deadline",
+			c:    nil,
+		},
+		{
+			name: "client timeout",
+			c:    &http.Client{Timeout: 20 * time.Millisecond},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			srv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				<-r.Context().Done()
+			}))
+			defer srv.Close()
+
+			c, err := keylight.NewClient(srv.URL, tt.c)
+			if err != nil {
+				t.Fatalf("failed to create client: %v", err)
+			}
+
+			_, err = c.AccessoryInfo(ctx)
+			if !errors.Is(err, keylight.ErrTimeout) {
+				t.Fatalf("expected timeout, but got: %v", err)
+			}
+
+			if errors.Is(err, keylight.ErrUnreachable) {
+				t.Fatalf("timeout must not be reported as unreachable: %v", err)
+			}
+		})
+	}
+}
+
+func TestClientErrUnreachable(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	// Start and immediately stop a server so that its address refuses
+	// connections.
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	c, err := keylight.NewClient(srv.URL, nil)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	_, err = c.Lights(ctx)
+	if !errors.Is(err, keylight.ErrUnreachable) {
+		t.Fatalf("expected unreachable, but got: %v", err)
+	}
+}
+
+func TestClientCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	c := testClient(t, nil)
+
+	_, err := c.Lights(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context canceled, but got: %v", err)
+	}
+
+	if errors.Is(err, keylight.ErrTimeout) || errors.Is(err, keylight.ErrUnreachable) {
+		t.Fatalf("cancelation must not be classified: %v", err)
+	}
+}
@@ -1,5 +1,7 @@
 package keylight
 
+import "time"
+
 // Constants exported for tests.
 const (
 	ContentBinary = contentBinary
@@ -10,3 +12,8 @@ const (
 func AESKey(boardType, firmwareBuildNumber int) []byte {
 	return aesKey(boardType, firmwareBuildNumber)
 }
+
+// WatchDelay exports watchDelay for tests.
+func WatchDelay(interval time.Duration, failures int) time.Duration {
+	return watchDelay(interval, failures)
+}
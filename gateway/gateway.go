@@ -0,0 +1,925 @@
+// Package gateway implements an HTTP/JSON REST gateway which aggregates many
+// Elgato Key Light devices behind a single API, so that clients do not need to
+// reach each device directly or handle the quirks of the Elgato API.
+//
+// Devices are addressed by serial number or display name. Errors are reported
+// using a consistent JSON format, and the gateway's API is described by an
+// OpenAPI document served at /openapi.json.
+package gateway
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mdlayher/keylight"
+)
+
+//go:embed openapi.json
+var openAPI []byte
+
+// Timeouts and limits applied by the gateway.
+const (
+	requestTimeout = 10 * time.Second
+	maxBody        = 64 << 10
+
+	// The device index is refreshed after indexTTL, or after errorTTL if any
+	// device could not be reached. Lookups of unknown devices force a refresh
+	// at most once per minRefresh, and each refresh may take up to
+	// indexTimeout.
+	indexTTL     = 30 * time.Second
+	errorTTL     = 5 * time.Second
+	minRefresh   = 5 * time.Second
+	indexTimeout = 5 * time.Second
+)
+
+// A Config configures a Server.
+type Config struct {
+	// Clients are the Clients for each device served by the gateway.
+	Clients []*keylight.Client
+
+	// Groups maps group names to the serial numbers or display names of the
+	// devices in each group.
+	Groups map[string][]string
+
+	// Scenes, if set, is the SceneStore which provides scenes for the
+	// /scenes endpoints. If nil, no scenes are available.
+	Scenes *keylight.SceneStore
+}
+
+// A Server is an http.Handler which serves the gateway API.
+type Server struct {
+	clients []*keylight.Client
+	groups  map[string][]string
+	scenes  *keylight.SceneStore
+
+	mu         sync.Mutex
+	index      []*indexEntry
+	indexed    time.Time
+	refreshing chan struct{}
+}
+
+// An indexEntry is the accessory information for a device, used to address
+// devices by serial number or display name. If the device could not be
+// reached, err is set and info is the accessory information from the last
+// successful refresh, if any.
+type indexEntry struct {
+	c    *keylight.Client
+	info *keylight.Device
+	err  error
+}
+
+// New creates a Server, as configured by cfg.
+func New(cfg Config) (*Server, error) {
+	for name, members := range cfg.Groups {
+		if name == "" {
+			return nil, errors.New("group name must not be empty")
+		}
+		if len(members) == 0 {
+			return nil, fmt.Errorf("group %q must contain at least one device", name)
+		}
+	}
+
+	return &Server{
+		clients: cfg.Clients,
+		groups:  cfg.Groups,
+		scenes:  cfg.Scenes,
+	}, nil
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	// Path segments, such as ["devices", "{id}", "lights"].
+	var parts []string
+	for _, p := range strings.Split(strings.Trim(r.URL.Path, "/"), "/") {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+
+	var err error
+	switch {
+	case len(parts) == 1 && parts[0] == "openapi.json":
+		err = s.handle(w, r, map[string]handlerFunc{
+			http.MethodGet: func(context.Context, *http.Request) (any, error) {
+				return json.RawMessage(openAPI), nil
+			},
+		})
+	case len(parts) >= 1 && parts[0] == "devices":
+		err = s.routeDevices(w, r, parts[1:])
+	case len(parts) >= 1 && parts[0] == "groups":
+		err = s.routeGroups(w, r, parts[1:])
+	case len(parts) >= 1 && parts[0] == "scenes":
+		err = s.routeScenes(w, r, parts[1:])
+	default:
+		err = errNotFound("no such endpoint")
+	}
+
+	if err != nil {
+		writeError(w, err)
+	}
+}
+
+// A handlerFunc handles a request and returns a value to be encoded as the
+// JSON response body.
+type handlerFunc func(ctx context.Context, r *http.Request) (any, error)
+
+// handle calls the handlerFunc for the request's method and writes its
+// response.
+func (s *Server) handle(w http.ResponseWriter, r *http.Request, methods map[string]handlerFunc) error {
+	fn, ok := methods[r.Method]
+	if !ok {
+		allow := make([]string, 0, len(methods))
+		for m := range methods {
+			allow = append(allow, m)
+		}
+		sort.Strings(allow)
+		w.Header().Set("Allow", strings.Join(allow, ", "))
+
+		return &Error{
+			status:  http.StatusMethodNotAllowed,
+			Code:    "method_not_allowed",
+			Message: fmt.Sprintf("method %s is not allowed", r.Method),
+		}
+	}
+
+	v, err := fn(r.Context(), r)
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusOK, v)
+	return nil
+}
+
+// routeDevices routes requests for /devices.
+func (s *Server) routeDevices(w http.ResponseWriter, r *http.Request, parts []string) error {
+	switch len(parts) {
+	case 0:
+		return s.handle(w, r, map[string]handlerFunc{
+			http.MethodGet: s.getDevices,
+		})
+	case 1:
+		return s.handle(w, r, map[string]handlerFunc{
+			http.MethodGet: func(ctx context.Context, _ *http.Request) (any, error) {
+				e, err := s.lookup(ctx, parts[0])
+				if err != nil {
+					return nil, err
+				}
+
+				return newDevice(ctx, e), nil
+			},
+		})
+	case 2:
+		if parts[1] != "lights" {
+			return errNotFound("no such endpoint")
+		}
+
+		return s.handle(w, r, map[string]handlerFunc{
+			http.MethodGet: func(ctx context.Context, _ *http.Request) (any, error) {
+				e, err := s.lookup(ctx, parts[0])
+				if err != nil {
+					return nil, err
+				}
+
+				lights, err := e.c.Lights(ctx)
+				if err != nil {
+					return nil, err
+				}
+
+				return newLights(lights), nil
+			},
+			http.MethodPut: func(ctx context.Context, r *http.Request) (any, error) {
+				e, err := s.lookup(ctx, parts[0])
+				if err != nil {
+					return nil, err
+				}
+
+				updates, err := decodeUpdates(r)
+				if err != nil {
+					return nil, err
+				}
+
+				lights, err := updates.apply(ctx, e.c)
+				if err != nil {
+					return nil, err
+				}
+
+				return newLights(lights), nil
+			},
+		})
+	default:
+		return errNotFound("no such endpoint")
+	}
+}
+
+// getDevices returns all devices and their lights.
+func (s *Server) getDevices(ctx context.Context, _ *http.Request) (any, error) {
+	index, err := s.devices(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	devices := make([]*Device, len(index))
+	var wg sync.WaitGroup
+	for i, e := range index {
+		wg.Add(1)
+		go func(i int, e *indexEntry) {
+			defer wg.Done()
+			devices[i] = newDevice(ctx, e)
+		}(i, e)
+	}
+	wg.Wait()
+
+	return devices, nil
+}
+
+// A Group is the JSON representation of a group of devices.
+type Group struct {
+	Name    string    `json:"name"`
+	Members []string  `json:"members"`
+	Devices []*Device `json:"devices,omitempty"`
+}
+
+// routeGroups routes requests for /groups.
+func (s *Server) routeGroups(w http.ResponseWriter, r *http.Request, parts []string) error {
+	switch len(parts) {
+	case 0:
+		return s.handle(w, r, map[string]handlerFunc{
+			http.MethodGet: func(context.Context, *http.Request) (any, error) {
+				groups := make([]*Group, 0, len(s.groups))
+				for name, members := range s.groups {
+					groups = append(groups, &Group{Name: name, Members: members})
+				}
+				sort.Slice(groups, func(i, j int) bool {
+					return groups[i].Name < groups[j].Name
+				})
+
+				return groups, nil
+			},
+		})
+	case 1:
+		name := parts[0]
+		return s.handle(w, r, map[string]handlerFunc{
+			http.MethodGet: func(ctx context.Context, _ *http.Request) (any, error) {
+				return s.updateGroup(ctx, name, nil)
+			},
+			http.MethodPut: func(ctx context.Context, r *http.Request) (any, error) {
+				updates, err := decodeUpdates(r)
+				if err != nil {
+					return nil, err
+				}
+				if updates.perLight != nil {
+					return nil, errBadRequest("group updates must be a single light update object")
+				}
+
+				return s.updateGroup(ctx, name, updates)
+			},
+		})
+	default:
+		return errNotFound("no such endpoint")
+	}
+}
+
+// updateGroup applies updates to each device in the group name concurrently,
+// and returns the group with the state of each device. If updates is nil, the
+// current state is returned.
+func (s *Server) updateGroup(ctx context.Context, name string, updates *updates) (*Group, error) {
+	members, ok := s.groups[name]
+	if !ok {
+		return nil, errNotFound(fmt.Sprintf("group %q not found", name))
+	}
+
+	entries := make([]*indexEntry, 0, len(members))
+	for _, m := range members {
+		e, err := s.lookup(ctx, m)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	g := &Group{Name: name, Members: members, Devices: make([]*Device, len(entries))}
+
+	var wg sync.WaitGroup
+	for i, e := range entries {
+		wg.Add(1)
+		go func(i int, e *indexEntry) {
+			defer wg.Done()
+
+			if updates == nil {
+				g.Devices[i] = newDevice(ctx, e)
+				return
+			}
+
+			d := describe(e)
+			lights, err := updates.apply(ctx, e.c)
+			if err != nil {
+				d.Error = toAPIError(err)
+			} else {
+				d.Lights = newLights(lights)
+			}
+			g.Devices[i] = d
+		}(i, e)
+	}
+	wg.Wait()
+
+	if updates == nil {
+		return g, nil
+	}
+
+	// Report the devices which failed, but only after every device has had
+	// the opportunity to apply the update.
+	var failed []*Device
+	for _, d := range g.Devices {
+		if d.Error != nil {
+			failed = append(failed, d)
+		}
+	}
+	if len(failed) > 0 {
+		return nil, &Error{
+			status:  http.StatusBadGateway,
+			Code:    "group_failed",
+			Message: fmt.Sprintf("%d of %d devices in group %q failed", len(failed), len(g.Devices), name),
+			Devices: failed,
+		}
+	}
+
+	return g, nil
+}
+
+// A Scene is the JSON representation of a keylight.Scene.
+type Scene struct {
+	Name    string              `json:"name"`
+	Devices map[string][]*Light `json:"devices"`
+}
+
+// routeScenes routes requests for /scenes.
+func (s *Server) routeScenes(w http.ResponseWriter, r *http.Request, parts []string) error {
+	if s.scenes == nil {
+		return errNotFound("scenes are not configured")
+	}
+
+	switch {
+	case len(parts) == 0:
+		return s.handle(w, r, map[string]handlerFunc{
+			http.MethodGet: func(context.Context, *http.Request) (any, error) {
+				scenes, err := s.scenes.List()
+				if err != nil {
+					return nil, errStore(err)
+				}
+
+				out := make([]*Scene, 0, len(scenes))
+				for _, sc := range scenes {
+					out = append(out, newScene(sc))
+				}
+
+				return out, nil
+			},
+		})
+	case len(parts) == 1:
+		return s.handle(w, r, map[string]handlerFunc{
+			http.MethodGet: func(context.Context, *http.Request) (any, error) {
+				sc, err := s.scenes.Get(parts[0])
+				if err != nil {
+					return nil, errStore(err)
+				}
+
+				return newScene(sc), nil
+			},
+		})
+	case len(parts) == 2 && parts[1] == "apply":
+		return s.handle(w, r, map[string]handlerFunc{
+			http.MethodPost: func(ctx context.Context, r *http.Request) (any, error) {
+				return s.applyScene(ctx, r, parts[0])
+			},
+		})
+	default:
+		return errNotFound("no such endpoint")
+	}
+}
+
+// applyScene applies the scene name to all devices.
+func (s *Server) applyScene(ctx context.Context, r *http.Request, name string) (any, error) {
+	var req struct {
+		// Duration is the duration of the transition to the scene, such as
+		// "1.5s".
+		Duration string `json:"duration"`
+	}
+	if err := decodeJSON(r, &req, true); err != nil {
+		return nil, err
+	}
+
+	var d time.Duration
+	if req.Duration != "" {
+		var err error
+		if d, err = time.ParseDuration(req.Duration); err != nil || d < 0 {
+			return nil, errBadRequest(fmt.Sprintf("invalid duration %q", req.Duration))
+		}
+	}
+
+	sc, err := s.scenes.Get(name)
+	if err != nil {
+		return nil, errStore(err)
+	}
+
+	index, err := s.devices(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only include devices which are part of the scene, so unrelated devices
+	// which are unreachable do not prevent the scene from being applied.
+	var (
+		clients []*keylight.Client
+		entries []*indexEntry
+	)
+
+	for _, e := range index {
+		if e.info == nil {
+			continue
+		}
+		if _, ok := sc.Lights[e.info.SerialNumber]; ok {
+			clients = append(clients, e.c)
+			entries = append(entries, e)
+		}
+	}
+
+	if len(clients) == 0 {
+		return nil, &Error{
+			status:  http.StatusConflict,
+			Code:    "no_devices",
+			Message: fmt.Sprintf("none of the devices in scene %q were found", name),
+		}
+	}
+
+	results, err := keylight.NewGroup(clients, nil).ApplyScene(ctx, sc, d)
+	if results == nil && err != nil {
+		// The scene itself is invalid, so the store is at fault.
+		return nil, errStore(err)
+	}
+
+	var (
+		devices    = make([]*Device, 0, len(results))
+		rolledBack int
+		unrestored []string
+	)
+
+	for i, res := range results {
+		dev := describe(entries[i])
+		dev.Lights = newLights(res.Lights)
+		dev.RolledBack = res.RolledBack
+		if res.Err != nil {
+			dev.Error = toAPIError(res.Err)
+		}
+		if res.RolledBack {
+			rolledBack++
+		}
+		if res.RollbackErr != nil {
+			dev.RollbackError = toAPIError(res.RollbackErr)
+			unrestored = append(unrestored, dev.Serial)
+		}
+		devices = append(devices, dev)
+	}
+
+	if err != nil {
+		msg := fmt.Sprintf("failed to apply scene %q", name)
+		switch {
+		case len(unrestored) > 0:
+			msg += fmt.Sprintf(", devices %s could not be restored to their previous state", strings.Join(unrestored, ", "))
+		case rolledBack > 0:
+			msg += ", devices were restored to their previous state"
+		default:
+			msg += ", no devices were changed"
+		}
+
+		return nil, &Error{
+			status:  http.StatusBadGateway,
+			Code:    "scene_failed",
+			Message: msg,
+			Devices: devices,
+		}
+	}
+
+	return devices, nil
+}
+
+// devices returns the index of all devices, refreshing it if it is stale or
+// if force is set and the index was not refreshed recently. Refreshes are
+// shared by concurrent callers and are not bound to ctx, so a caller which
+// gives up does not affect the result seen by others.
+func (s *Server) devices(ctx context.Context, force bool) ([]*indexEntry, error) {
+	s.mu.Lock()
+
+	age := time.Since(s.indexed)
+	ttl := indexTTL
+	for _, e := range s.index {
+		if e.err != nil {
+			ttl = errorTTL
+			break
+		}
+	}
+
+	if s.index != nil && age < ttl && (!force || age < minRefresh) {
+		index := s.index
+		s.mu.Unlock()
+		return index, nil
+	}
+
+	done := s.refreshing
+	if done == nil {
+		done = make(chan struct{})
+		s.refreshing = done
+		go s.refresh(s.index, done)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.index, nil
+}
+
+// refresh fetches the accessory information of all devices concurrently,
+// stores the new index, and closes done. Devices which cannot be reached keep
+// their accessory information from prev, so they remain addressable.
+func (s *Server) refresh(prev []*indexEntry, done chan struct{}) {
+	defer close(done)
+
+	ctx, cancel := context.WithTimeout(context.Background(), indexTimeout)
+	defer cancel()
+
+	index := make([]*indexEntry, len(s.clients))
+	var wg sync.WaitGroup
+	for i, c := range s.clients {
+		wg.Add(1)
+		go func(i int, c *keylight.Client) {
+			defer wg.Done()
+
+			info, err := c.AccessoryInfo(ctx)
+			if err != nil && prev != nil {
+				info = prev[i].info
+			}
+			index[i] = &indexEntry{c: c, info: info, err: err}
+		}(i, c)
+	}
+	wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.index, s.indexed, s.refreshing = index, time.Now(), nil
+}
+
+// lookup returns the device addressed by id, which is a serial number or
+// display name. If no device matches, the index is refreshed once in case a
+// device was renamed or was previously unreachable, unless it was refreshed
+// recently.
+func (s *Server) lookup(ctx context.Context, id string) (*indexEntry, error) {
+	for _, force := range []bool{false, true} {
+		index, err := s.devices(ctx, force)
+		if err != nil {
+			return nil, err
+		}
+
+		// Serial numbers are unique, so prefer them to display names.
+		for _, e := range index {
+			if e.info != nil && e.info.SerialNumber == id {
+				return e, nil
+			}
+		}
+
+		var matches []*indexEntry
+		for _, e := range index {
+			if e.info != nil && strings.EqualFold(e.info.DisplayName, id) {
+				matches = append(matches, e)
+			}
+		}
+
+		switch len(matches) {
+		case 0:
+		case 1:
+			return matches[0], nil
+		default:
+			return nil, &Error{
+				status:  http.StatusConflict,
+				Code:    "ambiguous_device",
+				Message: fmt.Sprintf("%d devices have display name %q, use a serial number instead", len(matches), id),
+			}
+		}
+	}
+
+	return nil, errNotFound(fmt.Sprintf("device %q not found", id))
+}
+
+// A Device is the JSON representation of a device served by the gateway.
+type Device struct {
+	Serial          string `json:"serial,omitempty"`
+	DisplayName     string `json:"displayName,omitempty"`
+	ProductName     string `json:"productName,omitempty"`
+	FirmwareVersion string `json:"firmwareVersion,omitempty"`
+
+	// Addr is the address of the device's HTTP API, as seen by the gateway.
+	Addr string `json:"addr"`
+
+	Lights []*Light `json:"lights,omitempty"`
+
+	// Error is set if the device could not be reached.
+	Error *Error `json:"error,omitempty"`
+
+	// RolledBack and RollbackError report whether the device was restored to
+	// its previous state after a scene failed to apply.
+	RolledBack    bool   `json:"rolledBack,omitempty"`
+	RollbackError *Error `json:"rollbackError,omitempty"`
+}
+
+// describe creates a Device for e without its lights.
+func describe(e *indexEntry) *Device {
+	d := &Device{Addr: e.c.Addr()}
+	if e.info != nil {
+		d.Serial = e.info.SerialNumber
+		d.DisplayName = e.info.DisplayName
+		d.ProductName = e.info.ProductName
+		d.FirmwareVersion = e.info.FirmwareVersion
+	}
+
+	return d
+}
+
+// newDevice creates a Device for e, fetching the state of its lights.
+func newDevice(ctx context.Context, e *indexEntry) *Device {
+	d := describe(e)
+	if e.info == nil {
+		// The device has never been reached, so don't wait for it again.
+		d.Error = toAPIError(e.err)
+		return d
+	}
+
+	lights, err := e.c.Lights(ctx)
+	if err != nil {
+		d.Error = toAPIError(err)
+		return d
+	}
+
+	d.Lights = newLights(lights)
+	return d
+}
+
+// Possible Light.Mode values.
+const (
+	modeTemperature   = "temperature"
+	modeHueSaturation = "hue_saturation"
+)
+
+// A Light is the JSON representation of the state of a light. Temperature is
+// set in temperature mode, and Hue and Saturation are set in hue_saturation
+// mode.
+type Light struct {
+	On          bool     `json:"on"`
+	Brightness  int      `json:"brightness"`
+	Mode        string   `json:"mode"`
+	Temperature int      `json:"temperature,omitempty"`
+	Hue         *float64 `json:"hue,omitempty"`
+	Saturation  *float64 `json:"saturation,omitempty"`
+}
+
+// newLights converts lights to their JSON representation.
+func newLights(lights []*keylight.Light) []*Light {
+	if lights == nil {
+		return nil
+	}
+
+	out := make([]*Light, 0, len(lights))
+	for _, l := range lights {
+		gl := &Light{On: l.On, Brightness: l.Brightness}
+		switch l.Mode {
+		case keylight.ColorModeHueSaturation:
+			hue, sat := l.Hue, l.Saturation
+			gl.Mode, gl.Hue, gl.Saturation = modeHueSaturation, &hue, &sat
+		default:
+			gl.Mode, gl.Temperature = modeTemperature, l.Temperature
+		}
+
+		out = append(out, gl)
+	}
+
+	return out
+}
+
+// newScene converts sc to its JSON representation.
+func newScene(sc *keylight.Scene) *Scene {
+	out := &Scene{Name: sc.Name, Devices: make(map[string][]*Light, len(sc.Lights))}
+	for serial, lights := range sc.Lights {
+		out.Devices[serial] = newLights(lights)
+	}
+
+	return out
+}
+
+// A LightUpdate is the JSON representation of a partial update to a light.
+// Fields which are omitted are unchanged.
+type LightUpdate struct {
+	On          *bool    `json:"on,omitempty"`
+	Brightness  *int     `json:"brightness,omitempty"`
+	Temperature *int     `json:"temperature,omitempty"`
+	Hue         *float64 `json:"hue,omitempty"`
+	Saturation  *float64 `json:"saturation,omitempty"`
+}
+
+// updates are the light updates decoded from a request body, which is either
+// a single LightUpdate applied to all lights or an array of LightUpdates
+// applied to each light by index.
+type updates struct {
+	all      *LightUpdate
+	perLight []*LightUpdate
+}
+
+// decodeUpdates decodes updates from the body of r.
+func decodeUpdates(r *http.Request) (*updates, error) {
+	b, err := io.ReadAll(io.LimitReader(r.Body, maxBody))
+	if err != nil {
+		return nil, errBadRequest(fmt.Sprintf("failed to read request body: %v", err))
+	}
+
+	var u updates
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+
+	if trimmed := bytes.TrimSpace(b); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = dec.Decode(&u.perLight)
+	} else {
+		err = dec.Decode(&u.all)
+	}
+	if err != nil {
+		return nil, errBadRequest(fmt.Sprintf("invalid light update: %v", err))
+	}
+
+	for _, lu := range append([]*LightUpdate{u.all}, u.perLight...) {
+		if lu != nil && lu.Temperature != nil && (lu.Hue != nil || lu.Saturation != nil) {
+			return nil, errBadRequest("invalid light update: temperature cannot be combined with hue or saturation")
+		}
+	}
+
+	return &u, nil
+}
+
+// apply applies the updates to the lights of the device controlled by c.
+func (u *updates) apply(ctx context.Context, c *keylight.Client) ([]*keylight.Light, error) {
+	var in []*LightUpdate
+	if u.all != nil {
+		// Apply the update to every light, so the number of lights must be
+		// known first.
+		lights, err := c.Lights(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		in = make([]*LightUpdate, len(lights))
+		for i := range in {
+			in[i] = u.all
+		}
+	} else {
+		in = u.perLight
+	}
+
+	updates := make([]*keylight.LightUpdate, 0, len(in))
+	for i, lu := range in {
+		if lu == nil {
+			// Null entries leave the light at their index unchanged.
+			continue
+		}
+
+		updates = append(updates, &keylight.LightUpdate{
+			Index:       i,
+			On:          lu.On,
+			Brightness:  lu.Brightness,
+			Temperature: lu.Temperature,
+			Hue:         lu.Hue,
+			Saturation:  lu.Saturation,
+		})
+	}
+
+	return c.UpdateLights(ctx, updates...)
+}
+
+// decodeJSON decodes the JSON body of r into v. If optional is set, an empty
+// body is permitted.
+func decodeJSON(r *http.Request, v any, optional bool) error {
+	b, err := io.ReadAll(io.LimitReader(r.Body, maxBody))
+	if err != nil {
+		return errBadRequest(fmt.Sprintf("failed to read request body: %v", err))
+	}
+	if optional && len(bytes.TrimSpace(b)) == 0 {
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return errBadRequest(fmt.Sprintf("invalid request body: %v", err))
+	}
+
+	return nil
+}
+
+// An Error is the JSON representation of an error returned by the gateway.
+// Error responses contain an object with a single "error" field holding an
+// Error.
+type Error struct {
+	status int
+
+	// Code is a stable, machine-readable identifier for the error, and
+	// Message is a human-readable description.
+	Code    string `json:"code"`
+	Message string `json:"message"`
+
+	// Devices reports the state of each device when an operation on many
+	// devices fails.
+	Devices []*Device `json:"devices,omitempty"`
+}
+
+// Error implements error.
+func (e *Error) Error() string { return e.Message }
+
+func errBadRequest(msg string) error {
+	return &Error{status: http.StatusBadRequest, Code: "bad_request", Message: msg}
+}
+
+func errNotFound(msg string) error {
+	return &Error{status: http.StatusNotFound, Code: "not_found", Message: msg}
+}
+
+// errStore converts an error from the SceneStore to an Error. Missing scenes
+// are reported as not found, and other failures such as a malformed scenes
+// file are internal errors.
+func errStore(err error) error {
+	if errors.Is(err, keylight.ErrSceneNotFound) {
+		return err
+	}
+
+	return &Error{status: http.StatusInternalServerError, Code: "internal_error", Message: err.Error()}
+}
+
+// toAPIError converts err to an Error, classifying errors returned by
+// keylight.Client. Requests are validated before they reach a device, so
+// errors which are not otherwise classified are failures communicating with
+// a device, such as malformed responses.
+func toAPIError(err error) *Error {
+	var (
+		aerr *Error
+		herr *keylight.HTTPError
+		rerr *keylight.RangeError
+		lerr *keylight.LightCountError
+	)
+
+	switch {
+	case errors.As(err, &aerr):
+		return aerr
+	case errors.Is(err, keylight.ErrSceneNotFound):
+		return &Error{status: http.StatusNotFound, Code: "not_found", Message: err.Error()}
+	case errors.As(err, &rerr):
+		return &Error{status: http.StatusBadRequest, Code: "out_of_range", Message: err.Error()}
+	case errors.As(err, &lerr):
+		return &Error{status: http.StatusBadRequest, Code: "light_count", Message: err.Error()}
+	case errors.Is(err, keylight.ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		return &Error{status: http.StatusGatewayTimeout, Code: "device_timeout", Message: err.Error()}
+	case errors.Is(err, keylight.ErrUnreachable):
+		return &Error{status: http.StatusBadGateway, Code: "device_unreachable", Message: err.Error()}
+	case errors.As(err, &herr):
+		return &Error{status: http.StatusBadGateway, Code: "device_error", Message: err.Error()}
+	default:
+		return &Error{status: http.StatusBadGateway, Code: "device_error", Message: err.Error()}
+	}
+}
+
+// writeError writes err as a JSON error response.
+func writeError(w http.ResponseWriter, err error) {
+	aerr := toAPIError(err)
+	writeJSON(w, aerr.status, struct {
+		Error *Error `json:"error"`
+	}{Error: aerr})
+}
+
+// writeJSON writes v as a JSON response with status.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,544 @@
+package gateway_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/keylight"
+	"github.com/mdlayher/keylight/gateway"
+	"github.com/mdlayher/keylight/keylighttest"
+)
+
+func TestGatewayDevices(t *testing.T) {
+	devices, srv := testGateway(t, 2, nil)
+	devices[1].InjectFault(keylighttest.Fault{
+		Method:     http.MethodGet,
+		Path:       "/elgato/lights",
+		StatusCode: http.StatusInternalServerError,
+	})
+
+	var got []*gateway.Device
+	do(t, srv, http.MethodGet, "/devices", "", http.StatusOK, &got)
+
+	if diff := cmp.Diff(2, len(got)); diff != "" {
+		t.Fatalf("unexpected number of devices (-want +got):\n%s", diff)
+	}
+
+	want := &gateway.Device{
+		Serial:      "SN0",
+		DisplayName: "Desk 0",
+		ProductName: "Elgato Key Light",
+		Addr:        got[0].Addr,
+		Lights:      []*gateway.Light{{Brightness: 20, Mode: "temperature", Temperature: 5550}},
+	}
+	if diff := cmp.Diff(want, got[0]); diff != "" {
+		t.Fatalf("unexpected device (-want +got):\n%s", diff)
+	}
+
+	// Devices which fail are reported with an error.
+	if got[1].Error == nil || got[1].Error.Code != "device_error" {
+		t.Fatalf("expected device error, but got: %+v", got[1].Error)
+	}
+
+	// Devices are addressed by serial or by display name.
+	for _, id := range []string{"SN0", "Desk%200", "desk%200"} {
+		var d gateway.Device
+		do(t, srv, http.MethodGet, "/devices/"+id, "", http.StatusOK, &d)
+
+		if diff := cmp.Diff("SN0", d.Serial); diff != "" {
+			t.Fatalf("%s: unexpected serial (-want +got):\n%s", id, diff)
+		}
+	}
+}
+
+func TestGatewayLights(t *testing.T) {
+	devices, srv := testGateway(t, 1, &keylighttest.Config{
+		Profile: &keylighttest.LightStrip,
+		Lights: []*keylight.Light{
+			{Brightness: 20, Temperature: 5000},
+			{Brightness: 20, Temperature: 5000},
+		},
+	})
+
+	tests := []struct {
+		name, body string
+		want       []*gateway.Light
+	}{
+		{
+			name: "all lights",
+			body: `{"on": true, "brightness": 40}`,
+			want: []*gateway.Light{
+				{On: true, Brightness: 40, Mode: "temperature", Temperature: 5000},
+				{On: true, Brightness: 40, Mode: "temperature", Temperature: 5000},
+			},
+		},
+		{
+			name: "by index",
+			body: `[null, {"temperature": 3000}]`,
+			want: []*gateway.Light{
+				{On: true, Brightness: 40, Mode: "temperature", Temperature: 5000},
+				{On: true, Brightness: 40, Mode: "temperature", Temperature: 3000},
+			},
+		},
+		{
+			name: "color",
+			body: `[{"hue": 120, "saturation": 50}]`,
+			want: []*gateway.Light{
+				{On: true, Brightness: 40, Mode: "hue_saturation", Hue: floatp(120), Saturation: floatp(50)},
+				{On: true, Brightness: 40, Mode: "temperature", Temperature: 3000},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []*gateway.Light
+			do(t, srv, http.MethodPut, "/devices/SN0/lights", tt.body, http.StatusOK, &got)
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Fatalf("unexpected lights (-want +got):\n%s", diff)
+			}
+
+			do(t, srv, http.MethodGet, "/devices/SN0/lights", "", http.StatusOK, &got)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Fatalf("unexpected lights after update (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	if !devices[0].Lights()[1].On {
+		t.Fatal("light was not turned on")
+	}
+}
+
+func TestGatewayErrors(t *testing.T) {
+	devices, srv := testGateway(t, 3, nil)
+
+	// Devices 1 and 2 share a display name.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := keylightClient(t, devices[2]).SetDisplayName(ctx, "Desk 1"); err != nil {
+		t.Fatalf("failed to set display name: %v", err)
+	}
+
+	// Device 1 returns malformed light state.
+	devices[1].InjectFault(keylighttest.Fault{Method: http.MethodGet, Path: "/elgato/lights", Truncate: true})
+
+	tests := []struct {
+		name, method, path, body string
+		status                   int
+		code                     string
+	}{
+		{name: "unknown endpoint", method: http.MethodGet, path: "/nope", status: http.StatusNotFound, code: "not_found"},
+		{name: "unknown device", method: http.MethodGet, path: "/devices/nope", status: http.StatusNotFound, code: "not_found"},
+		{name: "ambiguous device", method: http.MethodGet, path: "/devices/Desk%201", status: http.StatusConflict, code: "ambiguous_device"},
+		{name: "method", method: http.MethodDelete, path: "/devices/SN0/lights", status: http.StatusMethodNotAllowed, code: "method_not_allowed"},
+		{name: "bad JSON", method: http.MethodPut, path: "/devices/SN0/lights", body: `{"on": 1}`, status: http.StatusBadRequest, code: "bad_request"},
+		{name: "unknown field", method: http.MethodPut, path: "/devices/SN0/lights", body: `{"power": true}`, status: http.StatusBadRequest, code: "bad_request"},
+		{name: "out of range", method: http.MethodPut, path: "/devices/SN0/lights", body: `{"brightness": 101}`, status: http.StatusBadRequest, code: "out_of_range"},
+		{name: "invalid combination", method: http.MethodPut, path: "/devices/SN0/lights", body: `{"temperature": 3000, "hue": 10}`, status: http.StatusBadRequest, code: "bad_request"},
+		{name: "light count", method: http.MethodPut, path: "/devices/SN0/lights", body: `[{}, {"on": true}]`, status: http.StatusBadRequest, code: "light_count"},
+		{name: "unknown group", method: http.MethodGet, path: "/groups/nope", status: http.StatusNotFound, code: "not_found"},
+		{name: "no scenes", method: http.MethodGet, path: "/scenes", status: http.StatusNotFound, code: "not_found"},
+		{name: "malformed response", method: http.MethodGet, path: "/devices/SN1/lights", status: http.StatusBadGateway, code: "device_error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got struct {
+				Error *gateway.Error `json:"error"`
+			}
+			do(t, srv, tt.method, tt.path, tt.body, tt.status, &got)
+
+			if got.Error == nil || got.Error.Message == "" {
+				t.Fatalf("expected an error message, but got: %+v", got.Error)
+			}
+			if diff := cmp.Diff(tt.code, got.Error.Code); diff != "" {
+				t.Fatalf("unexpected error code (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGatewayGroups(t *testing.T) {
+	devices, srv := testGateway(t, 3, nil)
+
+	s, err := gateway.New(gateway.Config{
+		Clients: clients(t, devices),
+		Groups: map[string][]string{
+			"studio": {"SN0", "Desk 1"},
+			"all":    {"SN0", "SN1", "SN2"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create gateway: %v", err)
+	}
+	srv.Config.Handler = s
+
+	var groups []*gateway.Group
+	do(t, srv, http.MethodGet, "/groups", "", http.StatusOK, &groups)
+
+	want := []*gateway.Group{
+		{Name: "all", Members: []string{"SN0", "SN1", "SN2"}},
+		{Name: "studio", Members: []string{"SN0", "Desk 1"}},
+	}
+	if diff := cmp.Diff(want, groups); diff != "" {
+		t.Fatalf("unexpected groups (-want +got):\n%s", diff)
+	}
+
+	var g gateway.Group
+	do(t, srv, http.MethodPut, "/groups/studio", `{"on": true, "temperature": 3000}`, http.StatusOK, &g)
+
+	var on []string
+	for _, d := range g.Devices {
+		if d.Lights[0].On && d.Lights[0].Temperature == 3000 {
+			on = append(on, d.Serial)
+		}
+	}
+	if diff := cmp.Diff([]string{"SN0", "SN1"}, on); diff != "" {
+		t.Fatalf("unexpected devices updated (-want +got):\n%s", diff)
+	}
+	if devices[2].Lights()[0].On {
+		t.Fatal("device outside of group was turned on")
+	}
+
+	// A failing device is reported, and the others are still updated.
+	devices[1].InjectFault(keylighttest.Fault{
+		Method:     http.MethodPut,
+		Path:       "/elgato/lights",
+		StatusCode: http.StatusInternalServerError,
+	})
+
+	var failed struct {
+		Error *gateway.Error `json:"error"`
+	}
+	do(t, srv, http.MethodPut, "/groups/all", `{"on": false}`, http.StatusBadGateway, &failed)
+
+	if diff := cmp.Diff("group_failed", failed.Error.Code); diff != "" {
+		t.Fatalf("unexpected error code (-want +got):\n%s", diff)
+	}
+
+	var errs []string
+	for _, d := range failed.Error.Devices {
+		if d.Error != nil {
+			errs = append(errs, d.Serial+": "+d.Error.Code)
+		}
+	}
+	if diff := cmp.Diff([]string{"SN1: device_error"}, errs); diff != "" {
+		t.Fatalf("unexpected device errors (-want +got):\n%s", diff)
+	}
+	if devices[0].Lights()[0].On {
+		t.Fatal("working device was not turned off")
+	}
+}
+
+func TestGatewayScenes(t *testing.T) {
+	devices, srv := testGateway(t, 2, nil)
+
+	storePath := filepath.Join(t.TempDir(), "scenes.json")
+	store := keylight.NewSceneStore(storePath)
+	s, err := gateway.New(gateway.Config{Clients: clients(t, devices), Scenes: store})
+	if err != nil {
+		t.Fatalf("failed to create gateway: %v", err)
+	}
+	srv.Config.Handler = s
+
+	err = store.Save(&keylight.Scene{
+		Name: "recording",
+		Lights: map[string][]*keylight.Light{
+			"SN1": {{On: true, Brightness: 60, Temperature: 4000}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to save scene: %v", err)
+	}
+
+	var scenes []*gateway.Scene
+	do(t, srv, http.MethodGet, "/scenes", "", http.StatusOK, &scenes)
+
+	want := []*gateway.Scene{{
+		Name: "recording",
+		Devices: map[string][]*gateway.Light{
+			"SN1": {{On: true, Brightness: 60, Mode: "temperature", Temperature: 4000}},
+		},
+	}}
+	if diff := cmp.Diff(want, scenes); diff != "" {
+		t.Fatalf("unexpected scenes (-want +got):\n%s", diff)
+	}
+
+	var applied []*gateway.Device
+	do(t, srv, http.MethodPost, "/scenes/recording/apply", "", http.StatusOK, &applied)
+
+	if len(applied) != 1 || applied[0].Serial != "SN1" {
+		t.Fatalf("unexpected applied devices: %+v", applied)
+	}
+	if diff := cmp.Diff(want[0].Devices["SN1"], applied[0].Lights); diff != "" {
+		t.Fatalf("unexpected applied lights (-want +got):\n%s", diff)
+	}
+	if !devices[1].Lights()[0].On || devices[0].Lights()[0].On {
+		t.Fatal("scene was not applied to only its device")
+	}
+
+	var failed struct {
+		Error *gateway.Error `json:"error"`
+	}
+	do(t, srv, http.MethodPost, "/scenes/nope/apply", `{"duration": "1s"}`, http.StatusNotFound, &failed)
+	do(t, srv, http.MethodPost, "/scenes/recording/apply", `{"duration": "soon"}`, http.StatusBadRequest, &failed)
+
+	for _, sc := range []*keylight.Scene{
+		{
+			Name: "both",
+			Lights: map[string][]*keylight.Light{
+				"SN0": {{On: true, Brightness: 80, Temperature: 3000}},
+				"SN1": {{On: true, Brightness: 80, Temperature: 3000}},
+			},
+		},
+		{
+			Name:   "missing",
+			Lights: map[string][]*keylight.Light{"SN9": {{On: true, Brightness: 80, Temperature: 3000}}},
+		},
+	} {
+		if err := store.Save(sc); err != nil {
+			t.Fatalf("failed to save scene: %v", err)
+		}
+	}
+
+	// When one device fails, the other is restored and reports it.
+	devices[1].InjectFault(keylighttest.Fault{Method: http.MethodPut, Path: "/elgato/lights", StatusCode: http.StatusInternalServerError})
+	do(t, srv, http.MethodPost, "/scenes/both/apply", "", http.StatusBadGateway, &failed)
+
+	if !strings.Contains(failed.Error.Message, "restored") {
+		t.Fatalf("unexpected error message: %q", failed.Error.Message)
+	}
+	for _, d := range failed.Error.Devices {
+		if d.Serial == "SN0" && (!d.RolledBack || d.RollbackError != nil) {
+			t.Fatalf("device was not rolled back: %+v", d)
+		}
+	}
+	if devices[0].Lights()[0].On {
+		t.Fatal("device was not restored to its previous state")
+	}
+
+	do(t, srv, http.MethodPost, "/scenes/missing/apply", "", http.StatusConflict, &failed)
+	if diff := cmp.Diff("no_devices", failed.Error.Code); diff != "" {
+		t.Fatalf("unexpected error code (-want +got):\n%s", diff)
+	}
+
+	// A scenes file which cannot be parsed is the fault of the gateway, not
+	// the request.
+	if err := os.WriteFile(storePath, []byte("{"), 0o644); err != nil {
+		t.Fatalf("failed to corrupt scenes file: %v", err)
+	}
+
+	do(t, srv, http.MethodGet, "/scenes", "", http.StatusInternalServerError, &failed)
+	if diff := cmp.Diff("internal_error", failed.Error.Code); diff != "" {
+		t.Fatalf("unexpected error code (-want +got):\n%s", diff)
+	}
+}
+
+func TestGatewayIndex(t *testing.T) {
+	d := keylighttest.NewDevice(&keylighttest.Config{
+		Device: &keylight.Device{SerialNumber: "SN0", DisplayName: "Desk"},
+	})
+
+	var infos atomic.Int32
+	dsrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/elgato/accessory-info" {
+			infos.Add(1)
+		}
+		d.ServeHTTP(w, r)
+	}))
+	defer dsrv.Close()
+
+	c, err := keylight.New(dsrv.URL)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	s, err := gateway.New(gateway.Config{Clients: []*keylight.Client{c}})
+	if err != nil {
+		t.Fatalf("failed to create gateway: %v", err)
+	}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	// A client which gives up while the index is being built does not cause
+	// an error to be cached for other clients.
+	d.InjectFault(keylighttest.Fault{Path: "/elgato/accessory-info", Delay: 200 * time.Millisecond})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/devices", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	if _, err := srv.Client().Do(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, but got: %v", err)
+	}
+
+	var got []*gateway.Device
+	do(t, srv, http.MethodGet, "/devices", "", http.StatusOK, &got)
+	if len(got) != 1 || got[0].Error != nil {
+		t.Fatalf("expected healthy device, but got: %+v", got[0].Error)
+	}
+
+	// Lookups of unknown devices refresh the index at most once in a short
+	// period.
+	for i := 0; i < 5; i++ {
+		var res struct{ Error *gateway.Error }
+		do(t, srv, http.MethodGet, "/devices/nope", "", http.StatusNotFound, &res)
+	}
+	if diff := cmp.Diff(int32(1), infos.Load()); diff != "" {
+		t.Fatalf("unexpected number of accessory info requests (-want +got):\n%s", diff)
+	}
+}
+
+func TestGatewayOpenAPI(t *testing.T) {
+	_, srv := testGateway(t, 1, nil)
+
+	var doc struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	do(t, srv, http.MethodGet, "/openapi.json", "", http.StatusOK, &doc)
+
+	if diff := cmp.Diff("3.0.3", doc.OpenAPI); diff != "" {
+		t.Fatalf("unexpected OpenAPI version (-want +got):\n%s", diff)
+	}
+
+	// Every operation served by the gateway is described.
+	var got []string
+	for path, item := range doc.Paths {
+		for method := range item {
+			if method != "parameters" {
+				got = append(got, strings.ToUpper(method)+" "+path)
+			}
+		}
+	}
+	sort.Strings(got)
+
+	want := []string{
+		"GET /devices",
+		"GET /devices/{device}",
+		"GET /devices/{device}/lights",
+		"GET /groups",
+		"GET /groups/{group}",
+		"GET /openapi.json",
+		"GET /scenes",
+		"GET /scenes/{scene}",
+		"POST /scenes/{scene}/apply",
+		"PUT /devices/{device}/lights",
+		"PUT /groups/{group}",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected operations (-want +got):\n%s", diff)
+	}
+}
+
+// testGateway creates n devices named "Desk N" with serials SN0..SNn-1, and a
+// gateway server for them.
+func testGateway(t *testing.T, n int, cfg *keylighttest.Config) ([]*keylighttest.Device, *httptest.Server) {
+	t.Helper()
+
+	var devices []*keylighttest.Device
+	for i := 0; i < n; i++ {
+		c := keylighttest.Config{}
+		if cfg != nil {
+			c = *cfg
+		}
+		c.Device = &keylight.Device{
+			ProductName:  "Elgato Key Light",
+			SerialNumber: fmt.Sprintf("SN%d", i),
+			DisplayName:  fmt.Sprintf("Desk %d", i),
+		}
+
+		devices = append(devices, keylighttest.NewDevice(&c))
+	}
+
+	s, err := gateway.New(gateway.Config{Clients: clients(t, devices)})
+	if err != nil {
+		t.Fatalf("failed to create gateway: %v", err)
+	}
+
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+
+	return devices, srv
+}
+
+// clients serves devices and returns a Client for each.
+func clients(t *testing.T, devices []*keylighttest.Device) []*keylight.Client {
+	t.Helper()
+
+	var cs []*keylight.Client
+	for _, d := range devices {
+		cs = append(cs, keylightClient(t, d))
+	}
+
+	return cs
+}
+
+// keylightClient serves d and returns a Client for it.
+func keylightClient(t *testing.T, d *keylighttest.Device) *keylight.Client {
+	t.Helper()
+
+	srv := httptest.NewServer(d)
+	t.Cleanup(srv.Close)
+
+	c, err := keylight.New(srv.URL)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	return c
+}
+
+// do performs an HTTP request against srv, checks its status, and decodes the
+// JSON response into out.
+func do(t *testing.T, srv *httptest.Server, method, path, body string, status int, out any) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+
+	res, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("failed to perform request: %v", err)
+	}
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("failed to read body: %v", err)
+	}
+
+	if res.StatusCode != status {
+		t.Fatalf("%s %s: unexpected status %d, want %d: %s", method, path, res.StatusCode, status, b)
+	}
+	if ct := res.Header.Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("unexpected content type: %q", ct)
+	}
+
+	if err := json.Unmarshal(b, out); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+}
+
+func floatp(f float64) *float64 { return &f }
@@ -1,5 +1,15 @@
 module github.com/mdlayher/keylight
 
-go 1.19
+go 1.21
 
 require github.com/google/go-cmp v0.5.9
+
+require (
+	github.com/eclipse/paho.mqtt.golang v1.5.0
+	golang.org/x/net v0.35.0
+)
+
+require (
+	github.com/gorilla/websocket v1.5.3 // indirect
+	golang.org/x/sync v0.7.0 // indirect
+)
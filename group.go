@@ -0,0 +1,294 @@
+package keylight
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rollbackTimeout bounds the restoration of devices after a failed update,
+// which proceeds even if the caller's context is done.
+const rollbackTimeout = 5 * time.Second
+
+// A Group controls many Key Light devices as one by applying operations to
+// each device concurrently.
+type Group struct {
+	clients     []*Client
+	parallelism int
+	rollback    bool
+}
+
+// A GroupConfig configures a Group. A nil *GroupConfig applies default
+// settings.
+type GroupConfig struct {
+	// Parallelism is the maximum number of devices which are operated on
+	// concurrently. If zero, all devices are operated on concurrently.
+	Parallelism int
+
+	// Rollback enables all-or-nothing updates: if updating the lights of any
+	// device fails, each device is restored to its previous light state. This
+	// includes failed devices, which may have applied an update before the
+	// failure occurred.
+	Rollback bool
+}
+
+// NewGroup creates a Group which controls the devices of clients.
+func NewGroup(clients []*Client, cfg *GroupConfig) *Group {
+	if cfg == nil {
+		cfg = &GroupConfig{}
+	}
+
+	p := cfg.Parallelism
+	if p <= 0 || p > len(clients) {
+		p = len(clients)
+	}
+
+	return &Group{
+		clients:     clients,
+		parallelism: p,
+		rollback:    cfg.Rollback,
+	}
+}
+
+// A GroupResult is the result of a Group operation for a single device.
+type GroupResult struct {
+	// Client is the Client for the device.
+	Client *Client
+
+	// Lights is the state of the device's lights as reported by the device
+	// after the operation, for operations which modify lights.
+	Lights []*Light
+
+	// Err is the error which occurred for this device, if any.
+	Err error
+
+	// RolledBack reports whether the device was restored to its previous
+	// light state after another device failed.
+	RolledBack bool
+
+	// RollbackErr is the error which occurred while attempting to restore the
+	// device's previous light state, if any.
+	RollbackErr error
+}
+
+// A GroupError is returned when a Group operation fails for one or more
+// devices.
+type GroupError struct {
+	// Results contains the results for each device which failed.
+	Results []*GroupResult
+}
+
+// Error implements error.
+func (e *GroupError) Error() string {
+	ss := make([]string, 0, len(e.Results))
+	for _, r := range e.Results {
+		ss = append(ss, fmt.Sprintf("%s: %v", r.Client.Addr(), r.Err))
+	}
+
+	return fmt.Sprintf("keylight: %d devices failed: %s", len(e.Results), strings.Join(ss, "; "))
+}
+
+// Unwrap returns the errors of each device which failed, so errors.Is and
+// errors.As may be used to inspect them.
+func (e *GroupError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Results))
+	for _, r := range e.Results {
+		errs = append(errs, r.Err)
+	}
+
+	return errs
+}
+
+// SetLights configures the state of all lights on each device in the Group
+// to lights. It returns a result for each device in the order of the Group's
+// clients, and a *GroupError if any device failed.
+func (g *Group) SetLights(ctx context.Context, lights []*Light) ([]*GroupResult, error) {
+	if err := validateLights(lights); err != nil {
+		return nil, err
+	}
+
+	return g.update(ctx, g.rollback, func(ctx context.Context, _ int, c *Client, _ []*Light) ([]*Light, error) {
+		return c.ApplyLights(ctx, lights)
+	})
+}
+
+// UpdateLights applies the partial update u to all lights on each device in
+// the Group, ignoring u.Index. As with Client.UpdateLights, only the fields
+// set in u are changed. It returns a result for each device in the order of
+// the Group's clients, and a *GroupError if any device failed.
+func (g *Group) UpdateLights(ctx context.Context, u *LightUpdate) ([]*GroupResult, error) {
+	all := *u
+	all.Index = 0
+	if err := all.validate(); err != nil {
+		return nil, err
+	}
+
+	return g.update(ctx, g.rollback, func(ctx context.Context, _ int, c *Client, prev []*Light) ([]*Light, error) {
+		if len(prev) == 0 {
+			return nil, nil
+		}
+
+		updates := make([]*LightUpdate, 0, len(prev))
+		for i := range prev {
+			lu := all
+			lu.Index = i
+			updates = append(updates, &lu)
+		}
+
+		return c.UpdateLights(ctx, updates...)
+	})
+}
+
+// An Adjustment is a relative change to the state of lights.
+type Adjustment struct {
+	// Brightness and Temperature are added to the current brightness
+	// percentage and color temperature in Kelvin of each light. Results are
+	// clamped to their valid ranges.
+	Brightness, Temperature int
+
+	// On, if set, turns each light on or off.
+	On *bool
+}
+
+// Adjust applies a relative Adjustment to all lights on each device in the
+// Group. Lights in ColorModeHueSaturation only have their brightness and
+// power state adjusted. It returns a result for each device in the order of
+// the Group's clients, and a *GroupError if any device failed.
+func (g *Group) Adjust(ctx context.Context, a Adjustment) ([]*GroupResult, error) {
+	return g.update(ctx, g.rollback, func(ctx context.Context, _ int, c *Client, prev []*Light) ([]*Light, error) {
+		lights := make([]*Light, 0, len(prev))
+		for _, p := range prev {
+			l := *p
+			l.Brightness = max(BrightnessMin, min(l.Brightness+a.Brightness, BrightnessMax))
+			if l.Mode == ColorModeTemperature {
+				l.Temperature = max(TemperatureMin, min(l.Temperature+a.Temperature, TemperatureMax))
+			}
+			if a.On != nil {
+				l.On = *a.On
+			}
+
+			lights = append(lights, &l)
+		}
+
+		return c.ApplyLights(ctx, lights)
+	})
+}
+
+// Identify informs each device in the Group to flash its light. It returns a
+// result for each device in the order of the Group's clients, and a
+// *GroupError if any device failed.
+func (g *Group) Identify(ctx context.Context) ([]*GroupResult, error) {
+	results := g.each(ctx, func(ctx context.Context, _ int, c *Client, r *GroupResult) {
+		r.Err = c.Identify(ctx)
+	})
+
+	return results, groupError(results)
+}
+
+// update fetches the lights of each device and calls fn to apply a new state,
+// rolling back all devices on failure if rollback is set. fn returns the state
+// of the lights reported by the device, or nil lights and a nil error if it
+// left the device unchanged.
+func (g *Group) update(
+	ctx context.Context,
+	rollback bool,
+	fn func(ctx context.Context, i int, c *Client, prev []*Light) ([]*Light, error),
+) ([]*GroupResult, error) {
+	prev := make([][]*Light, len(g.clients))
+	results := g.each(ctx, func(ctx context.Context, i int, c *Client, r *GroupResult) {
+		p, err := c.Lights(ctx)
+		if err != nil {
+			r.Err = err
+			return
+		}
+
+		lights, err := fn(ctx, i, c, p)
+		if lights == nil && err == nil {
+			// No update was attempted.
+			r.Lights = p
+			return
+		}
+		prev[i] = p
+
+		if err != nil {
+			r.Err = err
+			return
+		}
+
+		r.Lights = lights
+	})
+
+	err := groupError(results)
+	if err == nil || !rollback {
+		return results, err
+	}
+
+	// At least one device failed, restore all devices to their previous state.
+	// The failure may have been the caller's deadline expiring, so don't let
+	// it prevent the rollback.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+	defer cancel()
+
+	g.each(ctx, func(ctx context.Context, i int, c *Client, _ *GroupResult) {
+		r := results[i]
+		if prev[i] == nil {
+			// Unable to fetch the previous state, or no update was attempted.
+			return
+		}
+
+		lights, err := c.ApplyLights(ctx, prev[i])
+		if err != nil {
+			r.RollbackErr = err
+			return
+		}
+
+		r.Lights = lights
+		r.RolledBack = true
+	})
+
+	return results, err
+}
+
+// each calls fn concurrently for each client, limited by the Group's
+// parallelism, and returns the results in order.
+func (g *Group) each(ctx context.Context, fn func(ctx context.Context, i int, c *Client, r *GroupResult)) []*GroupResult {
+	results := make([]*GroupResult, len(g.clients))
+	sem := make(chan struct{}, g.parallelism)
+
+	var wg sync.WaitGroup
+	for i, c := range g.clients {
+		results[i] = &GroupResult{Client: c}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, c *Client, r *GroupResult) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			fn(ctx, i, c, r)
+		}(i, c, results[i])
+	}
+
+	wg.Wait()
+	return results
+}
+
+// groupError returns a *GroupError if any of results failed.
+func groupError(results []*GroupResult) error {
+	var failed []*GroupResult
+	for _, r := range results {
+		if r.Err != nil {
+			failed = append(failed, r)
+		}
+	}
+
+	if len(failed) == 0 {
+		return nil
+	}
+
+	return &GroupError{Results: failed}
+}
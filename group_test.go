@@ -0,0 +1,269 @@
+package keylight_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/keylight"
+	"github.com/mdlayher/keylight/keylighttest"
+)
+
+func TestGroupSetLights(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	devices, g := testGroup(t, 6, &keylight.GroupConfig{Parallelism: 2})
+
+	want := []*keylight.Light{{On: true, Brightness: 40, Temperature: 4500}}
+	results, err := g.SetLights(ctx, want)
+	if err != nil {
+		t.Fatalf("failed to set lights: %v", err)
+	}
+
+	if diff := cmp.Diff(6, len(results)); diff != "" {
+		t.Fatalf("unexpected number of results (-want +got):\n%s", diff)
+	}
+
+	for i, d := range devices {
+		if results[i].Err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, results[i].Err)
+		}
+
+		if diff := cmp.Diff(want, d.Lights(), ignoreRaw); diff != "" {
+			t.Fatalf("%d: unexpected lights (-want +got):\n%s", i, diff)
+		}
+	}
+}
+
+func TestGroupAdjust(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	devices, g := testGroup(t, 2, nil)
+
+	on := true
+	_, err := g.Adjust(ctx, keylight.Adjustment{Brightness: 90, Temperature: -100, On: &on})
+	if err != nil {
+		t.Fatalf("failed to adjust lights: %v", err)
+	}
+
+	// Brightness is clamped to the valid range.
+	want := []*keylight.Light{{On: true, Brightness: 100, Temperature: 5450}}
+	for i, d := range devices {
+		if diff := cmp.Diff(want, d.Lights(), ignoreRaw); diff != "" {
+			t.Fatalf("%d: unexpected lights (-want +got):\n%s", i, diff)
+		}
+	}
+}
+
+func TestGroupUpdateLights(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	devices, g := testGroup(t, 2, nil)
+
+	// Only the fields which are set are changed.
+	b := 60
+	if _, err := g.UpdateLights(ctx, &keylight.LightUpdate{Index: 5, Brightness: &b}); err != nil {
+		t.Fatalf("failed to update lights: %v", err)
+	}
+
+	want := []*keylight.Light{{Brightness: 60, Temperature: 5550}}
+	for i, d := range devices {
+		if diff := cmp.Diff(want, d.Lights(), ignoreRaw); diff != "" {
+			t.Fatalf("%d: unexpected lights (-want +got):\n%s", i, diff)
+		}
+	}
+
+	var rerr *keylight.RangeError
+	b = 101
+	if _, err := g.UpdateLights(ctx, &keylight.LightUpdate{Brightness: &b}); !errors.As(err, &rerr) {
+		t.Fatalf("expected range error, but got: %v", err)
+	}
+}
+
+func TestGroupIdentify(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	devices, g := testGroup(t, 3, nil)
+	devices[2].InjectFault(keylighttest.Fault{StatusCode: http.StatusInternalServerError})
+
+	results, err := g.Identify(ctx)
+
+	var gerr *keylight.GroupError
+	if !errors.As(err, &gerr) {
+		t.Fatalf("expected group error, but got: %v", err)
+	}
+
+	if diff := cmp.Diff(1, len(gerr.Results)); diff != "" {
+		t.Fatalf("unexpected number of failures (-want +got):\n%s", diff)
+	}
+
+	// Errors for individual devices can be inspected through the GroupError.
+	var herr *keylight.HTTPError
+	if !errors.As(err, &herr) {
+		t.Fatalf("expected HTTP error, but got: %v", err)
+	}
+
+	for i, d := range devices {
+		want := 1
+		if i == 2 {
+			want = 0
+		}
+
+		if diff := cmp.Diff(want, d.Identified()); diff != "" {
+			t.Fatalf("%d: unexpected identify count (-want +got):\n%s", i, diff)
+		}
+
+		if diff := cmp.Diff(i == 2, results[i].Err != nil); diff != "" {
+			t.Fatalf("%d: unexpected error state (-want +got):\n%s", i, diff)
+		}
+	}
+}
+
+func TestGroupRollback(t *testing.T) {
+	tests := []struct {
+		name     string
+		rollback bool
+	}{
+		{name: "no rollback"},
+		{name: "rollback", rollback: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			devices, g := testGroup(t, 3, &keylight.GroupConfig{Rollback: tt.rollback})
+			devices[1].InjectFault(keylighttest.Fault{
+				Method:     http.MethodPut,
+				StatusCode: http.StatusServiceUnavailable,
+			})
+
+			prev := devices[0].Lights()
+
+			target := []*keylight.Light{{On: true, Brightness: 80, Temperature: 3000}}
+			results, err := g.SetLights(ctx, target)
+			if err == nil {
+				t.Fatal("an error was expected, but none occurred")
+			}
+
+			want := target
+			if tt.rollback {
+				want = prev
+			}
+
+			for _, i := range []int{0, 2} {
+				if diff := cmp.Diff(want, devices[i].Lights(), ignoreRaw); diff != "" {
+					t.Fatalf("%d: unexpected lights (-want +got):\n%s", i, diff)
+				}
+
+				if diff := cmp.Diff(tt.rollback, results[i].RolledBack); diff != "" {
+					t.Fatalf("%d: unexpected rollback state (-want +got):\n%s", i, diff)
+				}
+			}
+
+			if diff := cmp.Diff(prev, devices[1].Lights(), ignoreRaw); diff != "" {
+				t.Fatalf("unexpected lights on failed device (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGroupRollbackDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	devices, g := testGroup(t, 3, &keylight.GroupConfig{Rollback: true})
+	prev := devices[0].Lights()
+
+	// The caller's deadline expires while a device is updating, but devices
+	// which were already updated are still restored.
+	devices[1].InjectFault(keylighttest.Fault{
+		Method: http.MethodPut,
+		Delay:  time.Second,
+	})
+
+	target := []*keylight.Light{{On: true, Brightness: 80, Temperature: 3000}}
+	results, err := g.SetLights(ctx, target)
+	if err == nil {
+		t.Fatal("an error was expected, but none occurred")
+	}
+
+	for i, d := range devices {
+		if diff := cmp.Diff(prev, d.Lights(), ignoreRaw); diff != "" {
+			t.Fatalf("%d: unexpected lights (-want +got):\n%s", i, diff)
+		}
+
+		if err := results[i].RollbackErr; err != nil {
+			t.Fatalf("%d: failed to roll back: %v", i, err)
+		}
+	}
+}
+
+func TestGroupParallelism(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var inflight, max int32
+	clients := make([]*keylight.Client, 0, 8)
+	for i := 0; i < 8; i++ {
+		d := keylighttest.NewDevice(nil)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt32(&inflight, 1)
+			defer atomic.AddInt32(&inflight, -1)
+
+			for {
+				m := atomic.LoadInt32(&max)
+				if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+					break
+				}
+			}
+
+			time.Sleep(5 * time.Millisecond)
+			d.ServeHTTP(w, r)
+		}))
+		t.Cleanup(srv.Close)
+
+		c, err := keylight.NewClient(srv.URL, nil)
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		clients = append(clients, c)
+	}
+
+	g := keylight.NewGroup(clients, &keylight.GroupConfig{Parallelism: 3})
+	if _, err := g.Identify(ctx); err != nil {
+		t.Fatalf("failed to identify: %v", err)
+	}
+
+	if m := atomic.LoadInt32(&max); m > 3 {
+		t.Fatalf("too many concurrent requests: %d", m)
+	}
+}
+
+// testGroup creates a Group of n emulated devices configured by cfg.
+func testGroup(t *testing.T, n int, cfg *keylight.GroupConfig) ([]*keylighttest.Device, *keylight.Group) {
+	t.Helper()
+
+	var (
+		devices []*keylighttest.Device
+		clients []*keylight.Client
+	)
+
+	for i := 0; i < n; i++ {
+		d, c := testDeviceClient(t)
+		devices = append(devices, d)
+		clients = append(clients, c)
+	}
+
+	return devices, keylight.NewGroup(clients, cfg)
+}
@@ -0,0 +1,75 @@
+// Package cmdconfig implements the configuration and device discovery shared by
+// the keylight_exporter, keylight_gateway, and keylight_mqtt commands.
+package cmdconfig
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mdlayher/keylight"
+)
+
+// discoverTimeout is the duration for which devices are discovered.
+const discoverTimeout = 2 * time.Second
+
+// Load parses the JSON configuration file at path into v. If path is empty,
+// v is unchanged.
+func Load(path string, v any) error {
+	if path == "" {
+		return nil
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read configuration: %w", err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("failed to parse configuration: %w", err)
+	}
+
+	return nil
+}
+
+// Clients creates a Client with opts for each device address in addrs and,
+// if discover is set, each device discovered on the local network. Devices
+// which are both configured and discovered are only included once. It
+// returns an error if there are no devices.
+func Clients(ctx context.Context, addrs []string, discover bool, opts ...keylight.Option) ([]*keylight.Client, error) {
+	if discover {
+		dctx, cancel := context.WithTimeout(ctx, discoverTimeout)
+		ss, err := keylight.Discover(dctx, nil)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("failed to discover devices: %w", err)
+		}
+
+		for _, s := range ss {
+			addrs = append(addrs, s.Addr)
+		}
+	}
+
+	if len(addrs) == 0 {
+		return nil, errors.New("no devices configured, use -c or -discover")
+	}
+
+	seen := make(map[string]bool, len(addrs))
+	var clients []*keylight.Client
+	for _, addr := range addrs {
+		if seen[addr] {
+			continue
+		}
+		seen[addr] = true
+
+		c, err := keylight.New(addr, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Key Light client: %w", err)
+		}
+		clients = append(clients, c)
+	}
+
+	return clients, nil
+}
@@ -0,0 +1,79 @@
+package cmdconfig_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/keylight/internal/cmdconfig"
+)
+
+func TestLoad(t *testing.T) {
+	type config struct {
+		Devices []string `json:"devices"`
+	}
+
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.json")
+	if err := os.WriteFile(good, []byte(`{"devices": ["http://keylight:9123"]}`), 0o644); err != nil {
+		t.Fatalf("failed to write configuration: %v", err)
+	}
+	bad := filepath.Join(dir, "bad.json")
+	if err := os.WriteFile(bad, []byte(`{`), 0o644); err != nil {
+		t.Fatalf("failed to write configuration: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want config
+		ok   bool
+	}{
+		{name: "no file", ok: true},
+		{name: "OK", path: good, want: config{Devices: []string{"http://keylight:9123"}}, ok: true},
+		{name: "missing", path: filepath.Join(dir, "missing.json")},
+		{name: "bad JSON", path: bad},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got config
+			err := cmdconfig.Load(tt.path, &got)
+			if tt.ok && err != nil {
+				t.Fatalf("failed to load configuration: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Fatalf("unexpected configuration (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestClients(t *testing.T) {
+	ctx := context.Background()
+
+	clients, err := cmdconfig.Clients(ctx, []string{"http://a:9123", "http://b:9123", "http://a:9123"}, false)
+	if err != nil {
+		t.Fatalf("failed to create clients: %v", err)
+	}
+
+	var got []string
+	for _, c := range clients {
+		got = append(got, c.Addr())
+	}
+
+	// Duplicate devices are only included once.
+	if diff := cmp.Diff([]string{"http://a:9123", "http://b:9123"}, got); diff != "" {
+		t.Fatalf("unexpected clients (-want +got):\n%s", diff)
+	}
+
+	if _, err := cmdconfig.Clients(ctx, nil, false); err == nil {
+		t.Fatal("expected an error for no devices, but none occurred")
+	}
+}
@@ -0,0 +1,145 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultSocket returns the default path of the daemon's Unix socket, in
+// $XDG_RUNTIME_DIR if set, or the system's temporary directory otherwise.
+func DefaultSocket() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "keylightd.sock")
+	}
+
+	return filepath.Join(os.TempDir(), fmt.Sprintf("keylightd-%d.sock", os.Getuid()))
+}
+
+// HTTPClient returns an HTTP client which sends requests through the daemon
+// listening on socket, for use with keylight.NewClient. It returns nil if no
+// daemon is listening on socket, or if socket is not owned by the current
+// user, in which case devices should be contacted directly.
+func HTTPClient(socket string) *http.Client {
+	if socket == "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	c, err := dial(ctx, socket)
+	if err != nil {
+		return nil
+	}
+	_ = c.Close()
+
+	return &http.Client{
+		// Requests may wait behind others for the same device.
+		Timeout: 5 * time.Second,
+		Transport: &transport{rt: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dial(ctx, socket)
+			},
+		}},
+	}
+}
+
+// dial connects to the daemon on socket after checking that the socket
+// belongs to the current user. The check is repeated for each connection in
+// case the daemon exits and another user creates a socket in its place.
+func dial(ctx context.Context, socket string) (net.Conn, error) {
+	if err := checkSocket(socket); err != nil {
+		return nil, err
+	}
+
+	var d net.Dialer
+	return d.DialContext(ctx, "unix", socket)
+}
+
+// A noCacheKey is the context key for NoCache.
+type noCacheKey struct{}
+
+// NoCache returns a context which causes reads through an HTTP client created
+// by HTTPClient to bypass the daemon's cache. It should be used for reads
+// which precede a write based on the current state of a device, such as
+// toggling its lights, since cached state may be outdated.
+func NoCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+// A transport is an http.RoundTripper which converts the daemon's reports of
+// failures to contact a device into errors, so that keylight.Client reports
+// them as ErrTimeout or ErrUnreachable.
+type transport struct {
+	rt http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == http.MethodGet && req.Context().Value(noCacheKey{}) != nil {
+		// A RoundTripper must not modify the caller's request.
+		req = req.Clone(req.Context())
+		req.Header.Set("Cache-Control", "no-cache")
+	}
+
+	res, err := t.rt.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	kind := res.Header.Get(errorHeader)
+	if kind == "" {
+		return res, nil
+	}
+	defer res.Body.Close()
+
+	b, _ := io.ReadAll(io.LimitReader(res.Body, maxBody))
+	return nil, &deviceError{
+		timeout: kind == "timeout",
+		msg:     strings.TrimSpace(string(b)),
+	}
+}
+
+// A deviceError is a net.Error for a device the daemon failed to contact.
+type deviceError struct {
+	timeout bool
+	msg     string
+}
+
+func (e *deviceError) Error() string   { return "keylightd: " + e.msg }
+func (e *deviceError) Timeout() bool   { return e.timeout }
+func (e *deviceError) Temporary() bool { return false }
+
+// Devices fetches the status of each device known to the daemon using an
+// HTTP client created by HTTPClient.
+func Devices(ctx context.Context, c *http.Client) ([]*DeviceStatus, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://keylightd/keylightd/devices", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("daemon returned HTTP %d", res.StatusCode)
+	}
+
+	var ds []*DeviceStatus
+	if err := json.NewDecoder(res.Body).Decode(&ds); err != nil {
+		return nil, err
+	}
+
+	return ds, nil
+}
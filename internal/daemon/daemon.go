@@ -0,0 +1,556 @@
+// Package daemon implements the keylightd daemon, which owns the connections
+// to Elgato Key Light devices on behalf of short-lived clients such as the
+// keylight CLI.
+//
+// The daemon serves HTTP over a Unix socket. Requests for the Elgato API,
+// under /elgato/, are forwarded to the device identified by the request's
+// Host, so any keylight.Client can use the daemon by dialing its socket in
+// place of the device. Device state is cached by the daemon, unless a request
+// carries a "Cache-Control: no-cache" header, and requests to each device are
+// serialized. The daemon's own API is served under /keylightd/.
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mdlayher/keylight"
+)
+
+// Paths of the Elgato API which are cached by the daemon.
+const (
+	pathAccessoryInfo = "/elgato/accessory-info"
+	pathLights        = "/elgato/lights"
+	pathSettings      = "/elgato/lights/settings"
+)
+
+// maxBody is the maximum size of a request or response body forwarded by the
+// daemon. Elgato API payloads are only a few hundred bytes.
+const maxBody = 64 << 10
+
+// errorHeader is set on responses to requests which could not be forwarded to
+// a device, to "timeout" or "unreachable", so that clients using HTTPClient
+// can classify the failure as if they had contacted the device directly.
+const errorHeader = "Keylightd-Error"
+
+// A Config configures a Server.
+type Config struct {
+	// Devices maps device names to the addresses of their HTTP APIs. Clients
+	// may address a device by name, such as http://desk, or by address.
+	Devices map[string]string
+
+	// Discover enables periodic discovery of devices on the local network
+	// using multicast DNS.
+	Discover bool
+
+	// Refresh is the interval at which the state of each device's lights is
+	// refreshed in the background, so that changes made by other controllers
+	// are visible. If zero, 5 seconds is used.
+	Refresh time.Duration
+
+	// MaxAge is the maximum age of cached accessory information and light
+	// settings. If zero, one minute is used.
+	MaxAge time.Duration
+
+	// Idle is the time after which a device which was added on demand by a
+	// client's request, rather than configured or discovered, is removed if
+	// no client has used it. If zero, 10 minutes is used.
+	Idle time.Duration
+
+	// HTTPClient is the HTTP client used to communicate with devices. If nil,
+	// a client with a 2 second timeout is used.
+	HTTPClient *http.Client
+
+	// Logger, if set, logs the daemon's activity.
+	Logger *slog.Logger
+}
+
+// A Server is the keylightd daemon. Use ServeHTTP with an http.Server to
+// serve requests and Run to refresh device state.
+type Server struct {
+	c        *http.Client
+	refresh  time.Duration
+	maxAge   time.Duration
+	idle     time.Duration
+	discover bool
+	ll       *slog.Logger
+
+	mu      sync.Mutex
+	devices []*device
+}
+
+// NewServer creates a Server, as configured by cfg.
+func NewServer(cfg Config) (*Server, error) {
+	if cfg.Refresh <= 0 {
+		cfg.Refresh = 5 * time.Second
+	}
+	if cfg.MaxAge <= 0 {
+		cfg.MaxAge = time.Minute
+	}
+	if cfg.Idle <= 0 {
+		cfg.Idle = 10 * time.Minute
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 2 * time.Second}
+	}
+
+	s := &Server{
+		c:        cfg.HTTPClient,
+		refresh:  cfg.Refresh,
+		maxAge:   cfg.MaxAge,
+		idle:     cfg.Idle,
+		discover: cfg.Discover,
+		ll:       cfg.Logger,
+	}
+
+	for name, addr := range cfg.Devices {
+		if _, err := s.add(name, addr, false); err != nil {
+			return nil, fmt.Errorf("device %q: %w", name, err)
+		}
+	}
+
+	return s, nil
+}
+
+// Run refreshes the state of each device, discovers new devices if enabled,
+// and removes idle devices which were added on demand, until ctx is canceled,
+// at which point it returns ctx.Err().
+func (s *Server) Run(ctx context.Context) error {
+	t := time.NewTicker(s.refresh)
+	defer t.Stop()
+
+	var lastDiscover time.Time
+	for {
+		if s.discover && time.Since(lastDiscover) >= time.Minute {
+			s.discoverDevices(ctx)
+			lastDiscover = time.Now()
+		}
+
+		s.expireDevices()
+		s.refreshDevices(ctx)
+
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/keylightd/devices":
+		s.serveDevices(w, r)
+	case strings.HasPrefix(r.URL.Path, "/elgato/"):
+		d, err := s.lookup(r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		d.serveHTTP(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// A DeviceStatus is the state of a device known to the daemon, as reported by
+// the /keylightd/devices endpoint.
+type DeviceStatus struct {
+	// Name is the name of the device, from the daemon's configuration or
+	// discovery. Addr is the address of its HTTP API.
+	Name string `json:"name"`
+	Addr string `json:"addr"`
+
+	// Device and Lights are the cached accessory information and light
+	// state of the device, if known.
+	Device *keylight.Device  `json:"device,omitempty"`
+	Lights []*keylight.Light `json:"lights,omitempty"`
+
+	// Updated is the time at which the light state was last fetched.
+	Updated time.Time `json:"updated"`
+}
+
+// serveDevices serves the status of each device known to the daemon.
+func (s *Server) serveDevices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.Lock()
+	devices := append([]*device(nil), s.devices...)
+	s.mu.Unlock()
+
+	statuses := make([]*DeviceStatus, 0, len(devices))
+	for _, d := range devices {
+		ds := &DeviceStatus{Name: d.name, Addr: d.u.String()}
+
+		if e, ok := d.cached(pathAccessoryInfo, 0); ok {
+			_ = json.Unmarshal(e.body, &ds.Device)
+		}
+		if e, ok := d.cached(pathLights, 0); ok {
+			var body struct {
+				Lights []*keylight.Light `json:"lights"`
+			}
+			if err := json.Unmarshal(e.body, &body); err == nil {
+				ds.Lights = body.Lights
+				ds.Updated = e.fetched
+			}
+		}
+
+		statuses = append(statuses, ds)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(statuses)
+}
+
+// lookup returns the device for host, the Host of a client's request. A
+// device is matched by the host of its address or by its name. Requests for
+// unknown hosts add a new device on demand so that the daemon can serve any
+// device a client would otherwise contact directly. Such devices are removed
+// by Run once they are idle.
+func (s *Server) lookup(host string) (*device, error) {
+	if host == "" {
+		return nil, errors.New("request must specify the device as its host")
+	}
+
+	name, _, err := net.SplitHostPort(host)
+	if err != nil {
+		name = host
+	}
+
+	s.mu.Lock()
+	for _, d := range s.devices {
+		if d.u.Host == host || d.name == host || d.name == name {
+			d.used = time.Now()
+			s.mu.Unlock()
+			return d, nil
+		}
+	}
+	s.mu.Unlock()
+
+	return s.add(host, "http://"+host, true)
+}
+
+// add adds a device named name with address addr, or returns the existing
+// device with the same address. If onDemand is false, the device is
+// configured or discovered and is never removed.
+func (s *Server) add(name, addr string, onDemand bool) (*device, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" || u.Host == "" {
+		return nil, fmt.Errorf("address %q must be an HTTP URL", addr)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, d := range s.devices {
+		if d.u.Host == u.Host {
+			if !onDemand {
+				// A device used by a client was later discovered.
+				d.onDemand = false
+			}
+			return d, nil
+		}
+	}
+
+	d := &device{
+		name:      name,
+		u:         u,
+		onDemand:  onDemand,
+		used:      time.Now(),
+		c:         s.c,
+		lightsAge: 2 * s.refresh,
+		maxAge:    s.maxAge,
+		sem:       make(chan struct{}, 1),
+		cache:     make(map[string]*entry),
+	}
+	s.devices = append(s.devices, d)
+
+	if s.ll != nil {
+		s.ll.Info("added device", slog.String("name", name), slog.String("addr", u.String()))
+	}
+
+	return d, nil
+}
+
+// discoverDevices adds devices discovered on the local network.
+func (s *Server) discoverDevices(ctx context.Context) {
+	dctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	ss, err := keylight.Discover(dctx, nil)
+	if err != nil {
+		if s.ll != nil {
+			s.ll.Warn("failed to discover devices", slog.String("error", err.Error()))
+		}
+		return
+	}
+
+	for _, sv := range ss {
+		_, _ = s.add(sv.Instance, sv.Addr, false)
+	}
+}
+
+// expireDevices removes devices which were added on demand and have not been
+// used by a client for the idle timeout, so they are no longer refreshed.
+func (s *Server) expireDevices() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	devices := make([]*device, 0, len(s.devices))
+	for _, d := range s.devices {
+		if d.onDemand && time.Since(d.used) > s.idle {
+			if s.ll != nil {
+				s.ll.Info("removed idle device", slog.String("name", d.name), slog.String("addr", d.u.String()))
+			}
+			continue
+		}
+
+		devices = append(devices, d)
+	}
+
+	s.devices = devices
+}
+
+// refreshDevices fetches the light state of each device concurrently.
+func (s *Server) refreshDevices(ctx context.Context) {
+	s.mu.Lock()
+	devices := append([]*device(nil), s.devices...)
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, d := range devices {
+		wg.Add(1)
+		go func(d *device) {
+			defer wg.Done()
+
+			if _, err := d.fetch(ctx, pathLights); err != nil && s.ll != nil {
+				s.ll.Warn("failed to refresh device", slog.String("name", d.name), slog.String("error", err.Error()))
+			}
+		}(d)
+	}
+	wg.Wait()
+}
+
+// A device is a Key Light device served by the daemon.
+type device struct {
+	name string
+	u    *url.URL
+	c    *http.Client
+
+	// onDemand reports whether the device was added by a client's request,
+	// and used is the time of the last such request. Both are guarded by the
+	// Server's mutex.
+	onDemand bool
+	used     time.Time
+
+	// lightsAge and maxAge are the maximum ages of cached light state and
+	// other cached responses.
+	lightsAge, maxAge time.Duration
+
+	// sem serializes requests to the device, because Key Light firmware is
+	// known to drop connections under concurrent load.
+	sem chan struct{}
+
+	mu    sync.Mutex
+	cache map[string]*entry
+}
+
+// An entry is a cached response from a device.
+type entry struct {
+	body    []byte
+	fetched time.Time
+}
+
+// serveHTTP serves a client's request for the Elgato API of d.
+func (d *device) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	cacheable := r.URL.Path == pathAccessoryInfo || r.URL.Path == pathLights || r.URL.Path == pathSettings
+
+	if r.Method == http.MethodGet && cacheable {
+		maxAge := d.maxAge
+		if r.URL.Path == pathLights {
+			// Lights are kept current by the refresh loop, but are fetched
+			// on demand if it falls behind or is not running.
+			maxAge = d.lightsAge
+		}
+
+		// Clients which are about to modify the device based on its current
+		// state ask for a fresh response, which also refreshes the cache.
+		if r.Header.Get("Cache-Control") != "no-cache" {
+			if e, ok := d.cached(r.URL.Path, maxAge); ok {
+				writeJSON(w, http.StatusOK, e.body)
+				return
+			}
+		}
+
+		e, err := d.fetch(r.Context(), r.URL.Path)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, e.body)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBody))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res, err := d.do(r.Context(), r.Method, r.URL.RequestURI(), r.Header.Get("Content-Type"), body)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if cacheable {
+		d.mu.Lock()
+		if r.Method == http.MethodPut && r.URL.Path == pathLights && res.status == http.StatusOK {
+			// The device reports the state of all lights after an update.
+			d.cache[pathLights] = &entry{body: res.body, fetched: time.Now()}
+		} else if r.Method != http.MethodGet {
+			delete(d.cache, r.URL.Path)
+		}
+		d.mu.Unlock()
+	}
+
+	if res.contentType != "" {
+		w.Header().Set("Content-Type", res.contentType)
+	}
+	w.WriteHeader(res.status)
+	_, _ = w.Write(res.body)
+}
+
+// cached returns the cached response for path if it is no older than maxAge.
+// If maxAge is zero, a response of any age is returned.
+func (d *device) cached(path string, maxAge time.Duration) (*entry, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	e, ok := d.cache[path]
+	if !ok || (maxAge > 0 && time.Since(e.fetched) > maxAge) {
+		return nil, false
+	}
+
+	return e, true
+}
+
+// fetch fetches path from the device and caches the response.
+func (d *device) fetch(ctx context.Context, path string) (*entry, error) {
+	res, err := d.do(ctx, http.MethodGet, path, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	if res.status != http.StatusOK {
+		return nil, &keylight.HTTPError{StatusCode: res.status, Body: res.body}
+	}
+
+	e := &entry{body: res.body, fetched: time.Now()}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.cache[path] = e
+
+	return e, nil
+}
+
+// A response is a response from a device.
+type response struct {
+	status      int
+	contentType string
+	body        []byte
+}
+
+// do performs a single request to the device.
+func (d *device) do(ctx context.Context, method, uri, contentType string, body []byte) (*response, error) {
+	select {
+	case d.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-d.sem }()
+
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, d.u.Scheme+"://"+d.u.Host+uri, r)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	res, err := d.c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(res.Body, maxBody))
+	if err != nil {
+		return nil, err
+	}
+
+	return &response{
+		status:      res.StatusCode,
+		contentType: res.Header.Get("Content-Type"),
+		body:        b,
+	}, nil
+}
+
+// writeJSON writes a JSON response body b with status.
+func writeJSON(w http.ResponseWriter, status int, b []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(b)
+}
+
+// writeError writes a response for an error which occurred while contacting
+// a device.
+func writeError(w http.ResponseWriter, err error) {
+	var herr *keylight.HTTPError
+	if errors.As(err, &herr) {
+		// Pass through errors reported by the device.
+		w.WriteHeader(herr.StatusCode)
+		_, _ = w.Write(herr.Body)
+		return
+	}
+
+	status, kind := http.StatusBadGateway, "unreachable"
+	var nerr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &nerr) && nerr.Timeout() {
+		status, kind = http.StatusGatewayTimeout, "timeout"
+	}
+
+	w.Header().Set(errorHeader, kind)
+	http.Error(w, err.Error(), status)
+}
@@ -0,0 +1,352 @@
+package daemon_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/mdlayher/keylight"
+	"github.com/mdlayher/keylight/internal/daemon"
+	"github.com/mdlayher/keylight/keylighttest"
+)
+
+func TestServerCache(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	d, addr, requests := testDevice(t)
+	hc := testServer(t, daemon.Config{Devices: map[string]string{"desk": addr}})
+
+	c, err := keylight.NewClient("http://desk", hc)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.AccessoryInfo(ctx); err != nil {
+			t.Fatalf("failed to get accessory info: %v", err)
+		}
+		if _, err := c.Lights(ctx); err != nil {
+			t.Fatalf("failed to get lights: %v", err)
+		}
+	}
+
+	// Partial updates are forwarded unmodified, and the reported state is
+	// cached for the next read.
+	b := 80
+	if _, err := c.UpdateLights(ctx, &keylight.LightUpdate{Brightness: &b}); err != nil {
+		t.Fatalf("failed to update lights: %v", err)
+	}
+
+	lights, err := c.Lights(ctx)
+	if err != nil {
+		t.Fatalf("failed to get lights: %v", err)
+	}
+
+	want := []*keylight.Light{{Brightness: 80, Temperature: 5550}}
+	if diff := cmp.Diff(want, lights, ignoreRaw); diff != "" {
+		t.Fatalf("unexpected lights (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(want, d.Lights(), ignoreRaw); diff != "" {
+		t.Fatalf("unexpected device lights (-want +got):\n%s", diff)
+	}
+
+	// Reads which precede a write may bypass the cache.
+	if _, err := c.Lights(daemon.NoCache(ctx)); err != nil {
+		t.Fatalf("failed to get fresh lights: %v", err)
+	}
+
+	// Writes to other endpoints invalidate the cache.
+	if err := c.SetDisplayName(ctx, "Desk"); err != nil {
+		t.Fatalf("failed to set display name: %v", err)
+	}
+	info, err := c.AccessoryInfo(ctx)
+	if err != nil {
+		t.Fatalf("failed to get accessory info: %v", err)
+	}
+	if diff := cmp.Diff("Desk", info.DisplayName); diff != "" {
+		t.Fatalf("unexpected display name (-want +got):\n%s", diff)
+	}
+
+	wantRequests := []string{
+		"GET /elgato/accessory-info",
+		"GET /elgato/lights",
+		"PUT /elgato/lights",
+		"GET /elgato/lights",
+		"PUT /elgato/accessory-info",
+		"GET /elgato/accessory-info",
+	}
+	if diff := cmp.Diff(wantRequests, requests()); diff != "" {
+		t.Fatalf("unexpected device requests (-want +got):\n%s", diff)
+	}
+}
+
+func TestServerDevices(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, desk, _ := testDevice(t)
+	_, other, _ := testDevice(t)
+	hc := testServer(t, daemon.Config{Devices: map[string]string{"desk": desk}})
+
+	// Devices which are not configured are added on demand by address.
+	c, err := keylight.NewClient(other, hc)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	if _, err := c.Lights(ctx); err != nil {
+		t.Fatalf("failed to get lights: %v", err)
+	}
+
+	ds, err := daemon.Devices(ctx, hc)
+	if err != nil {
+		t.Fatalf("failed to get devices: %v", err)
+	}
+
+	if diff := cmp.Diff(2, len(ds)); diff != "" {
+		t.Fatalf("unexpected number of devices (-want +got):\n%s", diff)
+	}
+
+	// Sorted by name, and the new device is named by its host.
+	if diff := cmp.Diff(other, "http://"+ds[0].Name); diff != "" {
+		t.Fatalf("unexpected device name (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff("desk", ds[1].Name); diff != "" {
+		t.Fatalf("unexpected device name (-want +got):\n%s", diff)
+	}
+
+	// Only the device which was used has cached state.
+	want := []*keylight.Light{{Brightness: 20, Temperature: 5550}}
+	if diff := cmp.Diff(want, ds[0].Lights, ignoreRaw); diff != "" {
+		t.Fatalf("unexpected lights (-want +got):\n%s", diff)
+	}
+	if ds[1].Lights != nil {
+		t.Fatalf("unexpected lights for unused device: %v", ds[1].Lights)
+	}
+}
+
+func TestServerExpireIdle(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, desk, _ := testDevice(t)
+	_, other, _ := testDevice(t)
+
+	s, err := daemon.NewServer(daemon.Config{
+		Devices: map[string]string{"desk": desk},
+		Refresh: 10 * time.Millisecond,
+		Idle:    50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	hc := serve(t, s)
+
+	rctx, rcancel := context.WithCancel(ctx)
+	errC := make(chan error, 1)
+	go func() { errC <- s.Run(rctx) }()
+	defer func() {
+		rcancel()
+		<-errC
+	}()
+
+	c, err := keylight.NewClient(other, hc)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	if _, err := c.Lights(ctx); err != nil {
+		t.Fatalf("failed to get lights: %v", err)
+	}
+
+	// The device added on demand is removed once it is idle, but the
+	// configured device is kept.
+	for {
+		ds, err := daemon.Devices(ctx, hc)
+		if err != nil {
+			t.Fatalf("failed to get devices: %v", err)
+		}
+
+		if len(ds) == 1 {
+			if diff := cmp.Diff("desk", ds[0].Name); diff != "" {
+				t.Fatalf("unexpected device name (-want +got):\n%s", diff)
+			}
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for idle device to be removed: %d devices", len(ds))
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	d, addr, _ := testDevice(t)
+	d.InjectFault(keylighttest.Fault{
+		Method:     http.MethodGet,
+		Path:       "/elgato/lights",
+		StatusCode: http.StatusServiceUnavailable,
+	})
+
+	// Reserve an address with nothing listening.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	down := "http://" + l.Addr().String()
+	_ = l.Close()
+
+	slow, slowAddr, _ := testDevice(t)
+	slow.InjectFault(keylighttest.Fault{
+		Method: http.MethodGet,
+		Path:   "/elgato/lights",
+		Delay:  time.Second,
+	})
+
+	hc := testServer(t, daemon.Config{
+		Devices:    map[string]string{"desk": addr, "down": down, "slow": slowAddr},
+		HTTPClient: &http.Client{Timeout: 50 * time.Millisecond},
+	})
+
+	tests := []struct {
+		name   string
+		addr   string
+		status int
+		err    error
+	}{
+		{name: "device error", addr: "http://desk", status: http.StatusServiceUnavailable},
+		{name: "unreachable", addr: "http://down", err: keylight.ErrUnreachable},
+		{name: "timeout", addr: "http://slow", err: keylight.ErrTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := keylight.NewClient(tt.addr, hc)
+			if err != nil {
+				t.Fatalf("failed to create client: %v", err)
+			}
+
+			_, err = c.Lights(ctx)
+
+			if tt.err != nil {
+				// Failures to contact a device are classified as if the
+				// client had contacted it directly.
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("expected %v, but got: %v", tt.err, err)
+				}
+				return
+			}
+
+			var herr *keylight.HTTPError
+			if !errors.As(err, &herr) {
+				t.Fatalf("expected HTTP error, but got: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.status, herr.StatusCode); diff != "" {
+				t.Fatalf("unexpected status (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHTTPClientNoDaemon(t *testing.T) {
+	if hc := daemon.HTTPClient(filepath.Join(t.TempDir(), "keylightd.sock")); hc != nil {
+		t.Fatal("expected no HTTP client without a daemon")
+	}
+}
+
+func TestHTTPClientNotOwned(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "keylightd.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("skipping, failed to listen on Unix socket: %v", err)
+	}
+	defer l.Close()
+
+	// Only possible with sufficient privileges.
+	if err := os.Lchown(socket, os.Getuid()+1, -1); err != nil {
+		t.Skipf("skipping, failed to change socket owner: %v", err)
+	}
+
+	if hc := daemon.HTTPClient(socket); hc != nil {
+		t.Fatal("expected no HTTP client for a socket owned by another user")
+	}
+}
+
+var ignoreRaw = cmpopts.IgnoreFields(keylight.Light{}, "RawTemperature")
+
+// testDevice starts an emulated device and returns its address and a function
+// which reports the requests it received.
+func testDevice(t *testing.T) (*keylighttest.Device, string, func() []string) {
+	t.Helper()
+
+	var (
+		mu       sync.Mutex
+		requests []string
+	)
+
+	d := keylighttest.NewDevice(nil)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+
+		d.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	return d, srv.URL, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return append([]string(nil), requests...)
+	}
+}
+
+// testServer serves a daemon configured by cfg on a Unix socket and returns
+// an HTTP client which uses it.
+func testServer(t *testing.T, cfg daemon.Config) *http.Client {
+	t.Helper()
+
+	s, err := daemon.NewServer(cfg)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	return serve(t, s)
+}
+
+// serve serves s on a Unix socket and returns an HTTP client which uses it.
+func serve(t *testing.T, s *daemon.Server) *http.Client {
+	t.Helper()
+
+	socket := filepath.Join(t.TempDir(), "keylightd.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("skipping, failed to listen on Unix socket: %v", err)
+	}
+
+	srv := &http.Server{Handler: s}
+	go func() { _ = srv.Serve(l) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	hc := daemon.HTTPClient(socket)
+	if hc == nil {
+		t.Fatal("failed to create HTTP client for daemon")
+	}
+
+	return hc
+}
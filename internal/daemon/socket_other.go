@@ -0,0 +1,23 @@
+//go:build !unix
+
+package daemon
+
+import (
+	"fmt"
+	"os"
+)
+
+// checkSocket verifies that path is a Unix socket. Ownership cannot be
+// checked, but the default socket lives in a per-user directory.
+func checkSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+
+	if fi.Mode().Type() != os.ModeSocket {
+		return fmt.Errorf("%s is not a Unix socket", path)
+	}
+
+	return nil
+}
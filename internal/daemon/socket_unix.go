@@ -0,0 +1,30 @@
+//go:build unix
+
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// checkSocket verifies that path is a Unix socket owned by the current user.
+// The default socket may live in a directory shared by all users, where
+// another user could otherwise create a socket to intercept requests.
+func checkSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+
+	if fi.Mode().Type() != os.ModeSocket {
+		return fmt.Errorf("%s is not a Unix socket", path)
+	}
+
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok || int(st.Uid) != os.Getuid() {
+		return fmt.Errorf("%s is not owned by the current user", path)
+	}
+
+	return nil
+}
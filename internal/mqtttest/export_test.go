@@ -0,0 +1,6 @@
+package mqtttest
+
+// Match exports match for tests.
+func Match(filter, topic string) bool {
+	return match(filter, topic)
+}
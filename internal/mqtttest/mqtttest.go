@@ -0,0 +1,347 @@
+// Package mqtttest implements a minimal in-memory MQTT 3.1.1 broker which
+// supports QoS 0 messages, retained messages, and wills, for use in tests.
+package mqtttest
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+)
+
+// A Broker is an in-memory MQTT broker which delivers QoS 0 messages and
+// stores retained messages. It is intended for embedding in tests.
+type Broker struct {
+	ln net.Listener
+	wg sync.WaitGroup
+
+	mu       sync.Mutex
+	retained map[string]*Message
+	sessions map[*session]struct{}
+}
+
+// A session is a client connected to a Broker.
+type session struct {
+	conn net.Conn
+	will *Message
+
+	wmu     sync.Mutex
+	mu      sync.Mutex
+	filters []string
+}
+
+// NewBroker creates a Broker which listens on a random port on the loopback
+// interface.
+func NewBroker() (*Broker, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	return newBroker(ln), nil
+}
+
+// NewTLSBroker creates a Broker which listens for TLS connections configured
+// by cfg on a random port on the loopback interface.
+func NewTLSBroker(cfg *tls.Config) (*Broker, error) {
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return newBroker(ln), nil
+}
+
+// newBroker creates a Broker which accepts connections from ln.
+func newBroker(ln net.Listener) *Broker {
+	b := &Broker{
+		ln:       ln,
+		retained: make(map[string]*Message),
+		sessions: make(map[*session]struct{}),
+	}
+
+	b.wg.Add(1)
+	go b.serve()
+
+	return b
+}
+
+// Addr returns the address of the Broker, such as "127.0.0.1:1883".
+func (b *Broker) Addr() string {
+	return b.ln.Addr().String()
+}
+
+// Close stops the Broker and disconnects all of its clients.
+func (b *Broker) Close() error {
+	err := b.ln.Close()
+	b.Drop()
+	b.wg.Wait()
+	return err
+}
+
+// Drop closes the connections of all clients as if the network failed, which
+// publishes their wills.
+func (b *Broker) Drop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for s := range b.sessions {
+		_ = s.conn.Close()
+	}
+}
+
+// Retained returns the retained message for topic, or nil if there is none.
+func (b *Broker) Retained(topic string) *Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	m, ok := b.retained[topic]
+	if !ok {
+		return nil
+	}
+
+	return &Message{
+		Topic:   m.Topic,
+		Payload: append([]byte(nil), m.Payload...),
+		Retain:  true,
+	}
+}
+
+// serve accepts connections until the listener is closed.
+func (b *Broker) serve() {
+	defer b.wg.Done()
+
+	for {
+		conn, err := b.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		b.wg.Add(1)
+		go func() {
+			defer b.wg.Done()
+			b.handle(conn)
+		}()
+	}
+}
+
+// handle serves a client connection.
+func (b *Broker) handle(conn net.Conn) {
+	defer conn.Close()
+
+	br := bufio.NewReader(conn)
+	s, err := b.connect(conn, br)
+	if err != nil {
+		return
+	}
+
+	b.mu.Lock()
+	b.sessions[s] = struct{}{}
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		delete(b.sessions, s)
+		b.mu.Unlock()
+
+		if s.will != nil {
+			b.publish(s.will)
+		}
+	}()
+
+	for {
+		typ, flags, body, err := readPacket(br)
+		if err != nil {
+			return
+		}
+
+		switch typ {
+		case typePublish:
+			if (flags>>1)&0x03 != 0 {
+				// Only QoS 0 is supported.
+				return
+			}
+
+			m, err := parsePublish(flags, body)
+			if err != nil {
+				return
+			}
+			b.publish(m)
+		case typeSubscribe:
+			if err := b.subscribe(s, body); err != nil {
+				return
+			}
+		case typePingreq:
+			_ = s.write(typePingresp, 0, nil)
+		case typeDisconnect:
+			s.will = nil
+			return
+		default:
+			return
+		}
+	}
+}
+
+// connect performs the CONNECT handshake for a new session.
+func (b *Broker) connect(conn net.Conn, br *bufio.Reader) (*session, error) {
+	typ, _, body, err := readPacket(br)
+	if err != nil {
+		return nil, err
+	}
+	if typ != typeConnect {
+		return nil, errors.New("mqtt: expected CONNECT")
+	}
+
+	proto, body, err := readString(body)
+	if err != nil {
+		return nil, err
+	}
+	if proto != "MQTT" || len(body) < 4 || body[0] != 4 {
+		_ = writePacket(conn, typeConnack, 0, []byte{0, 1})
+		return nil, errors.New("mqtt: unacceptable protocol version")
+	}
+
+	flags := body[1]
+	body = body[4:]
+
+	// The client identifier is not used.
+	if _, body, err = readString(body); err != nil {
+		return nil, err
+	}
+
+	s := &session{conn: conn}
+	if flags&flagWill != 0 {
+		topic, rest, err := readString(body)
+		if err != nil {
+			return nil, err
+		}
+		payload, _, err := readBytes(rest)
+		if err != nil {
+			return nil, err
+		}
+
+		s.will = &Message{
+			Topic:   topic,
+			Payload: payload,
+			Retain:  flags&flagWillRetain != 0,
+		}
+	}
+
+	// Credentials, if any, are accepted without verification.
+	if err := s.write(typeConnack, 0, []byte{0, 0}); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// publish stores m if it is retained and delivers it to all matching
+// sessions.
+func (b *Broker) publish(m *Message) {
+	b.mu.Lock()
+	if m.Retain {
+		if len(m.Payload) == 0 {
+			delete(b.retained, m.Topic)
+		} else {
+			b.retained[m.Topic] = m
+		}
+	}
+
+	var subs []*session
+	for s := range b.sessions {
+		if s.matches(m.Topic) {
+			subs = append(subs, s)
+		}
+	}
+	b.mu.Unlock()
+
+	// Messages delivered to existing subscriptions are never marked retained.
+	for _, s := range subs {
+		_ = s.publish(&Message{Topic: m.Topic, Payload: m.Payload})
+	}
+}
+
+// subscribe adds the subscriptions in a SUBSCRIBE packet to s and delivers
+// matching retained messages.
+func (b *Broker) subscribe(s *session, body []byte) error {
+	if len(body) < 2 {
+		return errors.New("mqtt: malformed SUBSCRIBE")
+	}
+
+	id, rest := []byte{body[0], body[1]}, body[2:]
+
+	var filters []string
+	for len(rest) > 0 {
+		f, r, err := readString(rest)
+		if err != nil || len(r) < 1 {
+			return errors.New("mqtt: malformed SUBSCRIBE")
+		}
+
+		filters = append(filters, f)
+		rest = r[1:]
+	}
+
+	s.mu.Lock()
+	s.filters = append(s.filters, filters...)
+	s.mu.Unlock()
+
+	if err := s.write(typeSuback, 0, append(id, make([]byte, len(filters))...)); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	var retained []*Message
+	for topic, m := range b.retained {
+		for _, f := range filters {
+			if match(f, topic) {
+				retained = append(retained, m)
+				break
+			}
+		}
+	}
+	b.mu.Unlock()
+
+	for _, m := range retained {
+		if err := s.publish(m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// matches reports whether s is subscribed to topic.
+func (s *session) matches(topic string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, f := range s.filters {
+		if match(f, topic) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// publish delivers m to s.
+func (s *session) publish(m *Message) error {
+	var flags byte
+	if m.Retain {
+		flags = 0x01
+	}
+
+	b := appendString(nil, m.Topic)
+	b = append(b, m.Payload...)
+
+	return s.write(typePublish, flags, b)
+}
+
+// write writes a packet to s.
+func (s *session) write(typ, flags byte, body []byte) error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	return writePacket(s.conn, typ, flags, body)
+}
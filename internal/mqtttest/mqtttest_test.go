@@ -0,0 +1,207 @@
+package mqtttest_test
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/keylight/internal/mqtttest"
+)
+
+func TestBrokerPublishSubscribe(t *testing.T) {
+	b := testBroker(t)
+
+	pub := dial(t, b, mqtt.NewClientOptions())
+	publish(t, pub, "a/b", "retained", true)
+	waitRetained(t, b, "a/b")
+
+	type message struct {
+		Topic, Payload string
+		Retained       bool
+	}
+
+	msgs := make(chan message, 10)
+	sub := dial(t, b, mqtt.NewClientOptions())
+	st := sub.Subscribe("a/+", 0, func(_ mqtt.Client, m mqtt.Message) {
+		msgs <- message{Topic: m.Topic(), Payload: string(m.Payload()), Retained: m.Retained()}
+	})
+	if !st.WaitTimeout(5*time.Second) || st.Error() != nil {
+		t.Fatalf("failed to subscribe: %v", st.Error())
+	}
+
+	// Retained messages are delivered on subscription, then live messages
+	// which match the filter.
+	publish(t, pub, "c/d", "ignored", false)
+	publish(t, pub, "a/c", "live", false)
+
+	want := []message{
+		{Topic: "a/b", Payload: "retained", Retained: true},
+		{Topic: "a/c", Payload: "live"},
+	}
+
+	var got []message
+	for range want {
+		select {
+		case m := <-msgs:
+			got = append(got, m)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for messages, got: %v", got)
+		}
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected messages (-want +got):\n%s", diff)
+	}
+}
+
+func TestBrokerWill(t *testing.T) {
+	b := testBroker(t)
+
+	opts := func() *mqtt.ClientOptions {
+		return mqtt.NewClientOptions().
+			SetBinaryWill("status", []byte("offline"), 0, true).
+			SetAutoReconnect(false)
+	}
+
+	// A client which disconnects cleanly does not publish its will.
+	c := dial(t, b, opts())
+	c.Disconnect(250)
+	if m := b.Retained("status"); m != nil {
+		t.Fatalf("unexpected will published: %v", m)
+	}
+
+	// A client whose connection fails does.
+	lost := make(chan error, 1)
+	_ = dial(t, b, opts().SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+		lost <- err
+	}))
+	b.Drop()
+
+	select {
+	case <-lost:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for connection to be lost")
+	}
+
+	waitRetained(t, b, "status")
+	want := &mqtttest.Message{Topic: "status", Payload: []byte("offline"), Retain: true}
+	if diff := cmp.Diff(want, b.Retained("status")); diff != "" {
+		t.Fatalf("unexpected will (-want +got):\n%s", diff)
+	}
+}
+
+func TestBrokerTLS(t *testing.T) {
+	// Borrow the certificate of a test HTTPS server, which is valid for the
+	// loopback interface.
+	srv := httptest.NewTLSServer(nil)
+	defer srv.Close()
+
+	b, err := mqtttest.NewTLSBroker(&tls.Config{Certificates: srv.TLS.Certificates})
+	if err != nil {
+		t.Fatalf("failed to create broker: %v", err)
+	}
+	t.Cleanup(func() { _ = b.Close() })
+
+	// A client which does not trust the broker fails to connect.
+	c := mqtt.NewClient(mqtt.NewClientOptions().
+		AddBroker("tls://" + b.Addr()).
+		SetTLSConfig(&tls.Config{}).
+		SetConnectTimeout(5 * time.Second))
+	if ct := c.Connect(); ct.Wait() && ct.Error() == nil {
+		c.Disconnect(0)
+		t.Fatal("expected an error for an untrusted broker, but none occurred")
+	}
+
+	rootCAs := srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+	c = dial(t, b, mqtt.NewClientOptions().
+		AddBroker("tls://"+b.Addr()).
+		SetUsername("keylight").
+		SetPassword("secret").
+		SetTLSConfig(&tls.Config{RootCAs: rootCAs}))
+
+	publish(t, c, "a/b", "secure", true)
+	waitRetained(t, b, "a/b")
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		filter, topic string
+		ok            bool
+	}{
+		{filter: "a/b", topic: "a/b", ok: true},
+		{filter: "a/b", topic: "a/c"},
+		{filter: "a/+", topic: "a/b", ok: true},
+		{filter: "a/+", topic: "a/b/c"},
+		{filter: "a/+/c", topic: "a/b/c", ok: true},
+		{filter: "a/#", topic: "a", ok: true},
+		{filter: "a/#", topic: "a/b/c", ok: true},
+		{filter: "#", topic: "a/b", ok: true},
+		{filter: "#", topic: "$SYS/uptime"},
+		{filter: "+/uptime", topic: "$SYS/uptime"},
+		{filter: "$SYS/#", topic: "$SYS/uptime", ok: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filter+" "+tt.topic, func(t *testing.T) {
+			if diff := cmp.Diff(tt.ok, mqtttest.Match(tt.filter, tt.topic)); diff != "" {
+				t.Fatalf("unexpected match (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func testBroker(t *testing.T) *mqtttest.Broker {
+	t.Helper()
+
+	b, err := mqtttest.NewBroker()
+	if err != nil {
+		t.Fatalf("failed to create broker: %v", err)
+	}
+	t.Cleanup(func() { _ = b.Close() })
+
+	return b
+}
+
+// dial connects a client configured by opts to b. If opts specifies no
+// broker, b is dialed without TLS.
+func dial(t *testing.T, b *mqtttest.Broker, opts *mqtt.ClientOptions) mqtt.Client {
+	t.Helper()
+
+	if len(opts.Servers) == 0 {
+		opts.AddBroker("tcp://" + b.Addr())
+	}
+
+	c := mqtt.NewClient(opts.SetConnectTimeout(5 * time.Second))
+	if ct := c.Connect(); ct.Wait() && ct.Error() != nil {
+		t.Fatalf("failed to dial: %v", ct.Error())
+	}
+	t.Cleanup(func() { c.Disconnect(0) })
+
+	return c
+}
+
+// publish publishes a message from c.
+func publish(t *testing.T, c mqtt.Client, topic, payload string, retain bool) {
+	t.Helper()
+
+	if pt := c.Publish(topic, 0, retain, payload); pt.Wait() && pt.Error() != nil {
+		t.Fatalf("failed to publish: %v", pt.Error())
+	}
+}
+
+// waitRetained waits for the broker to retain a message on topic.
+func waitRetained(t *testing.T, b *mqtttest.Broker, topic string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for b.Retained(topic) == nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for retained message on %q", topic)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
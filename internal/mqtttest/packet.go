@@ -0,0 +1,174 @@
+package mqtttest
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Control packet types.
+const (
+	typeConnect    = 1
+	typeConnack    = 2
+	typePublish    = 3
+	typeSubscribe  = 8
+	typeSuback     = 9
+	typePingreq    = 12
+	typePingresp   = 13
+	typeDisconnect = 14
+)
+
+// CONNECT flags.
+const (
+	flagWill       = 0x04
+	flagWillRetain = 0x20
+)
+
+// maxPacket is the maximum size of a packet accepted by a Broker.
+const maxPacket = 1 << 20
+
+// A Message is an application message published to a topic.
+type Message struct {
+	Topic   string
+	Payload []byte
+
+	// Retain reports whether the Broker retains the Message for future
+	// subscribers.
+	Retain bool
+}
+
+// match reports whether topic matches filter, which may contain the "+"
+// single-level and "#" multi-level wildcards.
+func match(filter, topic string) bool {
+	fs := strings.Split(filter, "/")
+	ts := strings.Split(topic, "/")
+
+	// Topics beginning with "$" are reserved and never match wildcards at the
+	// first level.
+	if strings.HasPrefix(topic, "$") && (fs[0] == "+" || fs[0] == "#") {
+		return false
+	}
+
+	for i, f := range fs {
+		if f == "#" {
+			return true
+		}
+		if i >= len(ts) {
+			return false
+		}
+		if f != "+" && f != ts[i] {
+			return false
+		}
+	}
+
+	return len(fs) == len(ts)
+}
+
+// parsePublish parses the body of a QoS 0 PUBLISH packet.
+func parsePublish(flags byte, body []byte) (*Message, error) {
+	topic, rest, err := readString(body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		Topic:   topic,
+		Payload: rest,
+		Retain:  flags&0x01 != 0,
+	}, nil
+}
+
+// writePacket writes a control packet with the specified type, flags, and
+// body to w.
+func writePacket(w io.Writer, typ, flags byte, body []byte) error {
+	b := []byte{typ<<4 | flags}
+
+	// Remaining length is encoded 7 bits at a time, least significant first.
+	n := len(body)
+	for {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if n == 0 {
+			break
+		}
+	}
+
+	_, err := w.Write(append(b, body...))
+	return err
+}
+
+// readPacket reads a control packet from r.
+func readPacket(r *bufio.Reader) (typ, flags byte, body []byte, err error) {
+	h, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	var n, shift int
+	for {
+		if shift > 21 {
+			return 0, 0, nil, errors.New("mqtt: malformed remaining length")
+		}
+
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, 0, nil, err
+		}
+
+		n |= int(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	if n > maxPacket {
+		return 0, 0, nil, fmt.Errorf("mqtt: packet size %d exceeds maximum of %d", n, maxPacket)
+	}
+
+	body = make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, 0, nil, err
+	}
+
+	return h >> 4, h & 0x0f, body, nil
+}
+
+// appendString appends a length-prefixed UTF-8 string to b.
+func appendString(b []byte, s string) []byte {
+	return appendBytes(b, []byte(s))
+}
+
+// appendBytes appends length-prefixed binary data to b.
+func appendBytes(b, data []byte) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(data)))
+	return append(b, data...)
+}
+
+// readString reads a length-prefixed string from b and returns the remaining
+// bytes.
+func readString(b []byte) (string, []byte, error) {
+	s, rest, err := readBytes(b)
+	return string(s), rest, err
+}
+
+// readBytes reads length-prefixed binary data from b and returns the
+// remaining bytes.
+func readBytes(b []byte) ([]byte, []byte, error) {
+	if len(b) < 2 {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+
+	return b[2 : 2+n], b[2+n:], nil
+}
@@ -0,0 +1,136 @@
+package keylighttest
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+// A Fault is an error condition which a Device injects when responding to a
+// matching request.
+type Fault struct {
+	// Method and Path match the HTTP method and URL path of requests. Empty
+	// values match any request.
+	Method, Path string
+
+	// Times is the number of matching requests which are affected by the
+	// Fault. If zero, only the next matching request is affected.
+	Times int
+
+	// Delay delays the response to the request. It may be combined with the
+	// other fault conditions.
+	Delay time.Duration
+
+	// StatusCode, if set, is returned instead of handling the request.
+	StatusCode int
+
+	// Truncate handles the request but truncates the response body halfway
+	// through, producing malformed JSON.
+	Truncate bool
+
+	// Reset closes the connection without sending a response.
+	Reset bool
+}
+
+// InjectFault schedules Fault f for matching requests. Faults are applied in
+// the order in which they were injected, and at most one Fault applies to a
+// request.
+func (d *Device) InjectFault(f Fault) {
+	if f.Times == 0 {
+		f.Times = 1
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.faults = append(d.faults, &f)
+}
+
+// Faults returns the number of injected faults which have not yet been
+// applied to a request.
+func (d *Device) Faults() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var n int
+	for _, f := range d.faults {
+		n += f.Times
+	}
+
+	return n
+}
+
+// nextFault returns the first pending Fault which matches r, if any.
+func (d *Device) nextFault(r *http.Request) (Fault, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for i, f := range d.faults {
+		if (f.Method != "" && f.Method != r.Method) || (f.Path != "" && f.Path != r.URL.Path) {
+			continue
+		}
+
+		f.Times--
+		if f.Times == 0 {
+			d.faults = append(d.faults[:i], d.faults[i+1:]...)
+		}
+
+		return *f, true
+	}
+
+	return Fault{}, false
+}
+
+// serveFault serves r while applying Fault f.
+func (d *Device) serveFault(w http.ResponseWriter, r *http.Request, f Fault) {
+	if f.Delay > 0 {
+		t := time.NewTimer(f.Delay)
+		defer t.Stop()
+
+		select {
+		case <-t.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	switch {
+	case f.Reset:
+		reset(w)
+	case f.StatusCode != 0:
+		http.Error(w, http.StatusText(f.StatusCode), f.StatusCode)
+	case f.Truncate:
+		rec := httptest.NewRecorder()
+		d.mux.ServeHTTP(rec, r)
+
+		for k, v := range rec.Header() {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(rec.Code)
+
+		b := rec.Body.Bytes()
+		_, _ = w.Write(b[:len(b)/2])
+	default:
+		d.mux.ServeHTTP(w, r)
+	}
+}
+
+// reset abruptly closes the connection underlying w.
+func reset(w http.ResponseWriter) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		panic("keylighttest: cannot reset connection which does not support hijacking")
+	}
+
+	c, _, err := hj.Hijack()
+	if err != nil {
+		panic("keylighttest: failed to hijack connection: " + err.Error())
+	}
+
+	// Discard any unsent data so the peer receives a TCP RST.
+	if tc, ok := c.(*net.TCPConn); ok {
+		_ = tc.SetLinger(0)
+	}
+	_ = c.Close()
+}
@@ -0,0 +1,143 @@
+package keylighttest_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/keylight"
+	"github.com/mdlayher/keylight/keylighttest"
+)
+
+func TestDeviceFaults(t *testing.T) {
+	tests := []struct {
+		name  string
+		fault keylighttest.Fault
+		check func(t *testing.T, err error)
+	}{
+		{
+			name:  "delay",
+			fault: keylighttest.Fault{Delay: 500 * time.Millisecond},
+			check: func(t *testing.T, err error) {
+				if !errors.Is(err, context.DeadlineExceeded) {
+					t.Fatalf("expected context deadline exceeded, but got: %v", err)
+				}
+			},
+		},
+		{
+			name:  "HTTP 500",
+			fault: keylighttest.Fault{StatusCode: http.StatusInternalServerError},
+			check: func(t *testing.T, err error) {
+				if err == nil || !strings.Contains(err.Error(), "HTTP 500") {
+					t.Fatalf("error text did not contain HTTP 500: %v", err)
+				}
+			},
+		},
+		{
+			name:  "truncated",
+			fault: keylighttest.Fault{Truncate: true},
+			check: func(t *testing.T, err error) {
+				if !errors.Is(err, io.ErrUnexpectedEOF) {
+					t.Fatalf("expected unexpected EOF, but got: %v", err)
+				}
+			},
+		},
+		{
+			name:  "reset",
+			fault: keylighttest.Fault{Reset: true},
+			check: func(t *testing.T, err error) {
+				if !errors.Is(err, keylight.ErrUnreachable) {
+					t.Fatalf("expected unreachable, but got: %v", err)
+				}
+			},
+		},
+		{
+			name: "no match",
+			fault: keylighttest.Fault{
+				Method:     http.MethodPut,
+				Path:       "/elgato/lights",
+				StatusCode: http.StatusInternalServerError,
+			},
+			check: func(t *testing.T, err error) {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			d, c := testDevice(t, nil)
+			d.InjectFault(tt.fault)
+
+			_, err := c.Lights(ctx)
+			tt.check(t, err)
+		})
+	}
+}
+
+func TestDeviceFaultsScript(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	d, c := testDevice(t, nil)
+
+	d.InjectFault(keylighttest.Fault{
+		Path:       "/elgato/lights",
+		StatusCode: http.StatusServiceUnavailable,
+		Times:      2,
+	})
+	d.InjectFault(keylighttest.Fault{Truncate: true})
+
+	if diff := cmp.Diff(3, d.Faults()); diff != "" {
+		t.Fatalf("unexpected number of faults (-want +got):\n%s", diff)
+	}
+
+	// The first fault does not match, so the second applies.
+	if _, err := c.AccessoryInfo(ctx); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected truncated response, but got: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.Lights(ctx); err == nil || !strings.Contains(err.Error(), "HTTP 503") {
+			t.Fatalf("%d: error text did not contain HTTP 503: %v", i, err)
+		}
+	}
+
+	if diff := cmp.Diff(0, d.Faults()); diff != "" {
+		t.Fatalf("unexpected number of faults (-want +got):\n%s", diff)
+	}
+
+	if _, err := c.Lights(ctx); err != nil {
+		t.Fatalf("failed to fetch lights: %v", err)
+	}
+}
+
+func TestDeviceFaultsClientTimeout(t *testing.T) {
+	d := keylighttest.NewDevice(nil)
+	d.InjectFault(keylighttest.Fault{Delay: 3 * time.Second})
+
+	srv := httptest.NewServer(d)
+	defer srv.Close()
+
+	// The default client timeout is 2 seconds, so use a shorter one to keep
+	// the test fast while exercising the same code path.
+	c, err := keylight.NewClient(srv.URL, &http.Client{Timeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	if _, err := c.Lights(context.Background()); !errors.Is(err, keylight.ErrTimeout) {
+		t.Fatalf("expected timeout error, but got: %v", err)
+	}
+}
@@ -0,0 +1,553 @@
+// Package keylighttest provides an in-process emulator of Elgato Key Light
+// devices for testing code which uses package keylight.
+//
+// A Device emulates a model described by a Profile, and can inject Faults to
+// exercise error handling.
+package keylighttest
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/mdlayher/keylight"
+)
+
+// A Config configures a Device. A nil *Config applies default settings.
+type Config struct {
+	// Profile is the device model emulated by the Device. If nil, KeyLight is
+	// used.
+	Profile *Profile
+
+	// Device is the accessory information reported by the Device. If nil, the
+	// values from Profile are used.
+	Device *keylight.Device
+
+	// Lights is the initial state of the Device's lights, and also determines
+	// the number of lights present. If nil, the Device has the number of
+	// lights specified by Profile, all of which are turned off.
+	Lights []*keylight.Light
+
+	// Settings is the initial state of the Device's light settings. If nil,
+	// the power on behavior restores the previous light state.
+	Settings *keylight.LightSettings
+
+	// Battery is the initial battery status of a Device whose Profile has a
+	// battery. If nil, the battery is fully charged and discharging.
+	Battery *keylight.BatteryInfo
+}
+
+// A Device is a stateful emulator of an Elgato Key Light device which
+// implements http.Handler. Use httptest.NewServer to serve a Device and
+// keylight.NewClient to connect to it.
+//
+// Like the device firmware, a Device clamps out of range values to the nearest
+// valid value and ignores configuration for lights which are not present.
+type Device struct {
+	mu              sync.Mutex
+	profile         Profile
+	info            keylight.Device
+	lights          []rawLight
+	settings        json.RawMessage
+	battery         keylight.BatteryInfo
+	batterySettings json.RawMessage
+	wifi            *keylight.WiFiInfo
+	identify        int
+	faults          []*Fault
+
+	mux *http.ServeMux
+}
+
+var _ http.Handler = &Device{}
+
+// NewDevice creates a Device configured by cfg.
+func NewDevice(cfg *Config) *Device {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	profile := KeyLight
+	if cfg.Profile != nil {
+		profile = *cfg.Profile
+	}
+
+	info := profile.device("BW00A1A00001")
+	if cfg.Device != nil {
+		info = *cfg.Device
+	}
+
+	lights := cfg.Lights
+	if lights == nil {
+		for i := 0; i < profile.Lights; i++ {
+			lights = append(lights, &keylight.Light{Brightness: 20, Temperature: 5550})
+		}
+	}
+
+	settings := cfg.Settings
+	if settings == nil {
+		settings = &keylight.LightSettings{
+			PowerOnBehavior:    keylight.PowerOnRestore,
+			PowerOnBrightness:  20,
+			PowerOnTemperature: 5550,
+		}
+	}
+
+	battery := cfg.Battery
+	if battery == nil {
+		battery = &keylight.BatteryInfo{
+			PowerSource: keylight.PowerSourceBattery,
+			Level:       100,
+			Status:      keylight.BatteryDischarging,
+			Voltage:     4200,
+		}
+	}
+
+	d := &Device{
+		profile:  profile,
+		info:     info,
+		lights:   make([]rawLight, len(lights)),
+		settings: mustMarshal(settings),
+		battery:  *battery,
+		batterySettings: mustMarshal(&keylight.BatterySettings{
+			MinimumBatteryLevel: 15,
+			Brightness:          10,
+		}),
+	}
+
+	// Store state using the device's own units so that values round-trip
+	// exactly as they would with a real device.
+	for i, l := range lights {
+		if err := json.Unmarshal(mustMarshal(l), &d.lights[i]); err != nil {
+			panic(err)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/elgato/accessory-info", d.accessoryInfo)
+	mux.HandleFunc("/elgato/identify", d.identifyHandler)
+	mux.HandleFunc("/elgato/lights", d.lightsHandler)
+	mux.HandleFunc("/elgato/lights/settings", d.settingsHandler)
+	mux.HandleFunc("/elgato/wifi-info", d.wifiInfo)
+	if profile.Battery {
+		mux.HandleFunc("/elgato/battery-info", d.batteryInfo)
+		mux.HandleFunc("/elgato/battery/settings", d.batterySettingsHandler)
+	}
+	d.mux = mux
+
+	return d
+}
+
+// ServeHTTP implements http.Handler.
+func (d *Device) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if f, ok := d.nextFault(r); ok {
+		d.serveFault(w, r, f)
+		return
+	}
+
+	d.mux.ServeHTTP(w, r)
+}
+
+// AccessoryInfo returns the Device's current accessory information.
+func (d *Device) AccessoryInfo() *keylight.Device {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var info keylight.Device
+	mustUnmarshal(mustMarshal(d.info), &info)
+	return &info
+}
+
+// Lights returns the current state of the Device's lights.
+func (d *Device) Lights() []*keylight.Light {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var lights []*keylight.Light
+	mustUnmarshal(mustMarshal(d.lights), &lights)
+	return lights
+}
+
+// Settings returns the Device's current light settings.
+func (d *Device) Settings() *keylight.LightSettings {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var s keylight.LightSettings
+	mustUnmarshal(d.settings, &s)
+	return &s
+}
+
+// BatteryInfo returns the Device's current battery status.
+func (d *Device) BatteryInfo() *keylight.BatteryInfo {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	b := d.battery
+	return &b
+}
+
+// SetBatteryInfo updates the Device's battery status, such as to simulate a
+// draining battery.
+func (d *Device) SetBatteryInfo(b *keylight.BatteryInfo) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.battery = *b
+}
+
+// BatterySettings returns the Device's current battery settings.
+func (d *Device) BatterySettings() *keylight.BatterySettings {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var s keylight.BatterySettings
+	mustUnmarshal(d.batterySettings, &s)
+	return &s
+}
+
+// WiFiInfo returns the decrypted Wi-Fi configuration most recently sent to
+// the Device, or nil if none has been sent.
+func (d *Device) WiFiInfo() *keylight.WiFiInfo {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.wifi == nil {
+		return nil
+	}
+
+	wifi := *d.wifi
+	return &wifi
+}
+
+// Identified returns the number of identify requests the Device has received.
+func (d *Device) Identified() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.identify
+}
+
+func (d *Device) accessoryInfo(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var v struct {
+			DisplayName *string `json:"displayName"`
+		}
+		if !decode(w, r, &v) {
+			return
+		}
+
+		if v.DisplayName != nil {
+			d.info.DisplayName = *v.DisplayName
+		}
+	default:
+		methodNotAllowed(w)
+		return
+	}
+
+	write(w, d.info)
+}
+
+func (d *Device) identifyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.identify++
+}
+
+// A rawLight is the JSON representation of a light as stored by the firmware.
+type rawLight struct {
+	On          *int     `json:"on,omitempty"`
+	Brightness  *int     `json:"brightness,omitempty"`
+	Temperature *int     `json:"temperature,omitempty"`
+	Hue         *float64 `json:"hue,omitempty"`
+	Saturation  *float64 `json:"saturation,omitempty"`
+}
+
+// A lightsBody is the JSON API container for light information.
+type lightsBody struct {
+	NumberOfLights int        `json:"numberOfLights"`
+	Lights         []rawLight `json:"lights"`
+}
+
+func (d *Device) lightsHandler(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var body lightsBody
+		if !decode(w, r, &body) {
+			return
+		}
+
+		for i, l := range body.Lights {
+			if i >= len(d.lights) {
+				// The firmware ignores lights which are not present.
+				break
+			}
+
+			if !d.profile.Color {
+				// Devices without color support ignore these values.
+				l.Hue, l.Saturation = nil, nil
+			}
+
+			d.lights[i].apply(l)
+		}
+	default:
+		methodNotAllowed(w)
+		return
+	}
+
+	write(w, lightsBody{
+		NumberOfLights: len(d.lights),
+		Lights:         d.lights,
+	})
+}
+
+// apply applies the fields set in l to the light, clamping values to their
+// valid ranges.
+func (rl *rawLight) apply(l rawLight) {
+	if l.On != nil {
+		on := max(0, min(*l.On, 1))
+		rl.On = &on
+	}
+	if l.Brightness != nil {
+		b := max(keylight.BrightnessMin, min(*l.Brightness, keylight.BrightnessMax))
+		rl.Brightness = &b
+	}
+
+	// Setting a temperature switches a light out of hue and saturation mode,
+	// and vice versa.
+	if l.Temperature != nil {
+		t := max(keylight.RawTemperatureMin, min(*l.Temperature, keylight.RawTemperatureMax))
+		rl.Temperature = &t
+		rl.Hue, rl.Saturation = nil, nil
+	}
+	if l.Hue != nil || l.Saturation != nil {
+		var h, s float64
+		if rl.Hue != nil {
+			h = *rl.Hue
+		}
+		if rl.Saturation != nil {
+			s = *rl.Saturation
+		}
+		if l.Hue != nil {
+			h = max(keylight.HueMin, min(*l.Hue, keylight.HueMax))
+		}
+		if l.Saturation != nil {
+			s = max(keylight.SaturationMin, min(*l.Saturation, keylight.SaturationMax))
+		}
+
+		rl.Hue, rl.Saturation = &h, &s
+		rl.Temperature = nil
+	}
+}
+
+func (d *Device) settingsHandler(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var v map[string]json.RawMessage
+		if !decode(w, r, &v) {
+			return
+		}
+
+		// Merge the provided fields into the existing settings.
+		var cur map[string]json.RawMessage
+		mustUnmarshal(d.settings, &cur)
+		for k, val := range v {
+			cur[k] = val
+		}
+
+		var s struct {
+			PowerOnBehavior       int `json:"powerOnBehavior"`
+			PowerOnBrightness     int `json:"powerOnBrightness"`
+			PowerOnTemperature    int `json:"powerOnTemperature"`
+			SwitchOnDurationMs    int `json:"switchOnDurationMs"`
+			SwitchOffDurationMs   int `json:"switchOffDurationMs"`
+			ColorChangeDurationMs int `json:"colorChangeDurationMs"`
+		}
+		if err := json.Unmarshal(mustMarshal(cur), &s); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		s.PowerOnBehavior = max(1, min(s.PowerOnBehavior, 2))
+		s.PowerOnBrightness = max(keylight.BrightnessMin, min(s.PowerOnBrightness, keylight.BrightnessMax))
+		s.PowerOnTemperature = max(keylight.RawTemperatureMin, min(s.PowerOnTemperature, keylight.RawTemperatureMax))
+		for _, ms := range []*int{&s.SwitchOnDurationMs, &s.SwitchOffDurationMs, &s.ColorChangeDurationMs} {
+			if *ms < 0 {
+				*ms = 0
+			}
+		}
+
+		d.settings = mustMarshal(s)
+	default:
+		methodNotAllowed(w)
+		return
+	}
+
+	writeRaw(w, d.settings)
+}
+
+func (d *Device) batteryInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	write(w, d.battery)
+}
+
+func (d *Device) batterySettingsHandler(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var s keylight.BatterySettings
+		if !decode(w, r, &s) {
+			return
+		}
+
+		s.MinimumBatteryLevel = max(0, min(s.MinimumBatteryLevel, 100))
+		s.Brightness = max(keylight.BrightnessMin, min(s.Brightness, keylight.BrightnessMax))
+		d.batterySettings = mustMarshal(&s)
+	default:
+		methodNotAllowed(w)
+		return
+	}
+
+	writeRaw(w, d.batterySettings)
+}
+
+func (d *Device) wifiInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		methodNotAllowed(w)
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	wifi, err := decrypt(b, aesKey(d.info.HardwareBoardType, d.info.FirmwareBuildNumber))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	d.wifi = wifi
+}
+
+// decrypt decrypts a Wi-Fi configuration encrypted by keylight.Client.
+func decrypt(ciphertext, key []byte) (*keylight.WiFiInfo, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < aes.BlockSize {
+		return nil, errors.New("keylighttest: Wi-Fi ciphertext is shorter than one block")
+	}
+
+	iv := ciphertext[:aes.BlockSize]
+	ciphertext = ciphertext[aes.BlockSize:]
+
+	if len(ciphertext)%aes.BlockSize != 0 {
+		return nil, errors.New("keylighttest: Wi-Fi ciphertext is not a multiple of the block size")
+	}
+
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+
+	// The plaintext is zero padded.
+	plaintext = bytes.TrimRight(plaintext, "\x00")
+
+	var wifi keylight.WiFiInfo
+	if err := json.Unmarshal(plaintext, &wifi); err != nil {
+		return nil, err
+	}
+
+	return &wifi, nil
+}
+
+// aesKey returns the AES key based on the device's board type and firmware
+// build number. It must match the key derived by package keylight.
+func aesKey(boardType, firmwareBuildNumber int) []byte {
+	return []byte{
+		76, 180, byte(boardType >> 0), byte(boardType >> 8),
+		176, 234, 221, 238,
+		235, 42, 3, 138,
+		49, byte(firmwareBuildNumber >> 0), byte(firmwareBuildNumber >> 8), 86,
+	}
+}
+
+// decode decodes a JSON request body into v, writing an HTTP 400 response and
+// returning false on failure.
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
+
+// write writes v as a JSON response body.
+func write(w http.ResponseWriter, v interface{}) {
+	writeRaw(w, mustMarshal(v))
+}
+
+// writeRaw writes b as a JSON response body.
+func writeRaw(w http.ResponseWriter, b []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
+
+func methodNotAllowed(w http.ResponseWriter) {
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+}
+
+func mustMarshal(v interface{}) []byte {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+
+	return b
+}
+
+func mustUnmarshal(b []byte, v interface{}) {
+	if err := json.Unmarshal(b, v); err != nil {
+		panic(err)
+	}
+}
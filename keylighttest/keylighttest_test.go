@@ -0,0 +1,249 @@
+package keylighttest_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/mdlayher/keylight"
+	"github.com/mdlayher/keylight/keylighttest"
+)
+
+// ignoreRaw ignores raw temperatures when comparing lights and settings, for
+// tests which only deal with temperatures in Kelvin.
+var ignoreRaw = cmp.Options{
+	cmpopts.IgnoreFields(keylight.Light{}, "RawTemperature"),
+	cmpopts.IgnoreFields(keylight.LightSettings{}, "PowerOnRawTemperature"),
+}
+
+func TestDeviceLights(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	d, c := testDevice(t, &keylighttest.Config{
+		Lights: []*keylight.Light{
+			{Brightness: 10, Temperature: 2900},
+			{Brightness: 20, Temperature: 7000},
+		},
+	})
+
+	want := []*keylight.Light{
+		{On: true, Brightness: 50, Temperature: 4000},
+		{On: false, Brightness: 3, Temperature: 2900},
+	}
+
+	if err := c.SetLights(ctx, want); err != nil {
+		t.Fatalf("failed to set lights: %v", err)
+	}
+
+	got, err := c.Lights(ctx)
+	if err != nil {
+		t.Fatalf("failed to fetch lights: %v", err)
+	}
+
+	if diff := cmp.Diff(want, got, ignoreRaw); diff != "" {
+		t.Fatalf("unexpected lights (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(want, d.Lights(), ignoreRaw); diff != "" {
+		t.Fatalf("unexpected device lights (-want +got):\n%s", diff)
+	}
+
+	// The device ignores the extra light, which the client reports as an
+	// error.
+	err = c.SetLights(ctx, append(want, want[0]))
+	if err == nil || !strings.Contains(err.Error(), "attempted to configure 3 lights, but 2 are present") {
+		t.Fatalf("expected light count error, but got: %v", err)
+	}
+}
+
+func TestDeviceLightsClamp(t *testing.T) {
+	d, _ := testDevice(t, nil)
+
+	// Bypass the client's validation to send out of range values.
+	srv := httptest.NewServer(d)
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodPut, srv.URL+"/elgato/lights",
+		strings.NewReader(`{"lights":[{"on":1,"brightness":101,"temperature":100}]}`))
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to perform request: %v", err)
+	}
+	_ = res.Body.Close()
+
+	want := []*keylight.Light{{On: true, Brightness: 100, Temperature: 7000}}
+	if diff := cmp.Diff(want, d.Lights(), ignoreRaw); diff != "" {
+		t.Fatalf("unexpected device lights (-want +got):\n%s", diff)
+	}
+}
+
+func TestDeviceHueSaturation(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	d, c := testDevice(t, &keylighttest.Config{Profile: &keylighttest.LightStrip})
+
+	want := []*keylight.Light{{
+		On:         true,
+		Brightness: 30,
+		Mode:       keylight.ColorModeHueSaturation,
+		Hue:        120,
+		Saturation: 80,
+	}}
+
+	if err := c.SetLights(ctx, want); err != nil {
+		t.Fatalf("failed to set lights: %v", err)
+	}
+
+	if diff := cmp.Diff(want, d.Lights(), ignoreRaw); diff != "" {
+		t.Fatalf("unexpected device lights (-want +got):\n%s", diff)
+	}
+}
+
+func TestDeviceAccessoryInfo(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	d, c := testDevice(t, nil)
+
+	if err := c.SetDisplayName(ctx, "Office"); err != nil {
+		t.Fatalf("failed to set display name: %v", err)
+	}
+
+	got, err := c.AccessoryInfo(ctx)
+	if err != nil {
+		t.Fatalf("failed to fetch accessory info: %v", err)
+	}
+
+	if diff := cmp.Diff(d.AccessoryInfo(), got); diff != "" {
+		t.Fatalf("unexpected accessory info (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff("Office", got.DisplayName); diff != "" {
+		t.Fatalf("unexpected display name (-want +got):\n%s", diff)
+	}
+
+	if !got.Supports(keylight.FeatureLights) {
+		t.Fatal("device does not support lights")
+	}
+}
+
+func TestDeviceSettings(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	d, c := testDevice(t, nil)
+
+	want := &keylight.LightSettings{
+		PowerOnBehavior:     keylight.PowerOnDefaults,
+		PowerOnBrightness:   40,
+		PowerOnTemperature:  4500,
+		SwitchOnDuration:    500 * time.Millisecond,
+		SwitchOffDuration:   time.Second,
+		ColorChangeDuration: 250 * time.Millisecond,
+	}
+
+	if err := c.SetSettings(ctx, want); err != nil {
+		t.Fatalf("failed to set settings: %v", err)
+	}
+
+	got, err := c.Settings(ctx)
+	if err != nil {
+		t.Fatalf("failed to fetch settings: %v", err)
+	}
+
+	if diff := cmp.Diff(want, got, ignoreRaw); diff != "" {
+		t.Fatalf("unexpected settings (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(want, d.Settings(), ignoreRaw); diff != "" {
+		t.Fatalf("unexpected device settings (-want +got):\n%s", diff)
+	}
+}
+
+func TestDeviceIdentify(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	d, c := testDevice(t, nil)
+
+	for i := 0; i < 2; i++ {
+		if err := c.Identify(ctx); err != nil {
+			t.Fatalf("failed to identify: %v", err)
+		}
+	}
+
+	if diff := cmp.Diff(2, d.Identified()); diff != "" {
+		t.Fatalf("unexpected identify count (-want +got):\n%s", diff)
+	}
+}
+
+func TestDeviceWiFiInfo(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	d, c := testDevice(t, &keylighttest.Config{
+		Device: &keylight.Device{
+			ProductName:         "Elgato Key Light",
+			HardwareBoardType:   42,
+			FirmwareBuildNumber: 300,
+		},
+	})
+
+	if d.WiFiInfo() != nil {
+		t.Fatal("Wi-Fi info should not be set")
+	}
+
+	info, err := c.AccessoryInfo(ctx)
+	if err != nil {
+		t.Fatalf("failed to fetch accessory info: %v", err)
+	}
+
+	want := &keylight.WiFiInfo{
+		SSID:         "Elgato SSID",
+		Passphrase:   "Elgato",
+		SecurityType: keylight.WPA,
+	}
+
+	if err := c.SetWiFiInfo(ctx, want, info); err != nil {
+		t.Fatalf("failed to set Wi-Fi info: %v", err)
+	}
+
+	if diff := cmp.Diff(want, d.WiFiInfo()); diff != "" {
+		t.Fatalf("unexpected Wi-Fi info (-want +got):\n%s", diff)
+	}
+
+	// Encrypting with the wrong key must fail.
+	info.FirmwareBuildNumber++
+	if err := c.SetWiFiInfo(ctx, want, info); err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+}
+
+// testDevice creates a Device configured by cfg and a client which is
+// connected to it.
+func testDevice(t *testing.T, cfg *keylighttest.Config) (*keylighttest.Device, *keylight.Client) {
+	t.Helper()
+
+	d := keylighttest.NewDevice(cfg)
+
+	srv := httptest.NewServer(d)
+	t.Cleanup(srv.Close)
+
+	c, err := keylight.NewClient(srv.URL, nil)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	return d, c
+}
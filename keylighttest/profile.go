@@ -0,0 +1,78 @@
+package keylighttest
+
+import "github.com/mdlayher/keylight"
+
+// A Profile describes the hardware and firmware of an Elgato device model.
+type Profile struct {
+	// Accessory information reported by the device.
+	ProductName         string
+	HardwareBoardType   int
+	FirmwareBuildNumber int
+	FirmwareVersion     string
+	Features            []keylight.Feature
+
+	// Lights is the number of lights present on the device.
+	Lights int
+
+	// Color reports whether the device supports hue and saturation. Devices
+	// without color support ignore hue and saturation values.
+	Color bool
+
+	// Battery reports whether the device has a battery and serves the battery
+	// endpoints.
+	Battery bool
+}
+
+// Profiles for Elgato device models.
+var (
+	KeyLight = Profile{
+		ProductName:         "Elgato Key Light",
+		HardwareBoardType:   53,
+		FirmwareBuildNumber: 218,
+		FirmwareVersion:     "1.0.3",
+		Features:            []keylight.Feature{keylight.FeatureLights},
+		Lights:              1,
+	}
+
+	KeyLightAir = Profile{
+		ProductName:         "Elgato Key Light Air",
+		HardwareBoardType:   200,
+		FirmwareBuildNumber: 218,
+		FirmwareVersion:     "1.0.3",
+		Features:            []keylight.Feature{keylight.FeatureLights},
+		Lights:              1,
+	}
+
+	KeyLightMini = Profile{
+		ProductName:         "Elgato Key Light Mini",
+		HardwareBoardType:   207,
+		FirmwareBuildNumber: 229,
+		FirmwareVersion:     "1.0.2",
+		Features:            []keylight.Feature{keylight.FeatureLights},
+		Lights:              1,
+		Battery:             true,
+	}
+
+	LightStrip = Profile{
+		ProductName:         "Elgato Light Strip",
+		HardwareBoardType:   70,
+		FirmwareBuildNumber: 211,
+		FirmwareVersion:     "1.0.4",
+		Features:            []keylight.Feature{keylight.FeatureLights},
+		Lights:              1,
+		Color:               true,
+	}
+)
+
+// device produces the accessory information for a device using Profile p.
+func (p *Profile) device(serial string) keylight.Device {
+	return keylight.Device{
+		ProductName:         p.ProductName,
+		HardwareBoardType:   p.HardwareBoardType,
+		FirmwareBuildNumber: p.FirmwareBuildNumber,
+		FirmwareVersion:     p.FirmwareVersion,
+		SerialNumber:        serial,
+		MACAddress:          "3C:6A:9D:00:00:01",
+		Features:            append([]keylight.Feature(nil), p.Features...),
+	}
+}
@@ -0,0 +1,125 @@
+package keylighttest_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/keylight"
+	"github.com/mdlayher/keylight/keylighttest"
+)
+
+func TestProfiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile keylighttest.Profile
+	}{
+		{name: "Key Light", profile: keylighttest.KeyLight},
+		{name: "Key Light Air", profile: keylighttest.KeyLightAir},
+		{name: "Key Light Mini", profile: keylighttest.KeyLightMini},
+		{name: "Light Strip", profile: keylighttest.LightStrip},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+			defer cancel()
+
+			_, c := testDevice(t, &keylighttest.Config{Profile: &tt.profile})
+
+			d, err := c.AccessoryInfo(ctx)
+			if err != nil {
+				t.Fatalf("failed to fetch accessory info: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.profile.ProductName, d.ProductName); diff != "" {
+				t.Fatalf("unexpected product name (-want +got):\n%s", diff)
+			}
+
+			lights, err := c.Lights(ctx)
+			if err != nil {
+				t.Fatalf("failed to fetch lights: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.profile.Lights, len(lights)); diff != "" {
+				t.Fatalf("unexpected number of lights (-want +got):\n%s", diff)
+			}
+
+			// Only devices with a battery serve the battery endpoints.
+			_, err = c.BatteryInfo(ctx)
+			if tt.profile.Battery && err != nil {
+				t.Fatalf("failed to fetch battery info: %v", err)
+			}
+			if !tt.profile.Battery && (err == nil || !strings.Contains(err.Error(), "HTTP 404")) {
+				t.Fatalf("expected HTTP 404, but got: %v", err)
+			}
+
+			// Only devices with color support apply hue and saturation.
+			err = c.SetLights(ctx, []*keylight.Light{{
+				On:         true,
+				Brightness: 50,
+				Mode:       keylight.ColorModeHueSaturation,
+				Hue:        180,
+				Saturation: 100,
+			}})
+			if err != nil {
+				t.Fatalf("failed to set lights: %v", err)
+			}
+
+			lights, err = c.Lights(ctx)
+			if err != nil {
+				t.Fatalf("failed to fetch lights: %v", err)
+			}
+
+			want := keylight.ColorModeTemperature
+			if tt.profile.Color {
+				want = keylight.ColorModeHueSaturation
+			}
+
+			if diff := cmp.Diff(want, lights[0].Mode); diff != "" {
+				t.Fatalf("unexpected color mode (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDeviceBattery(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	d, c := testDevice(t, &keylighttest.Config{Profile: &keylighttest.KeyLightMini})
+
+	want := &keylight.BatteryInfo{
+		PowerSource: keylight.PowerSourceBattery,
+		Level:       4.5,
+		Status:      keylight.BatteryDischarging,
+		Voltage:     3300,
+	}
+	d.SetBatteryInfo(want)
+
+	got, err := c.BatteryInfo(ctx)
+	if err != nil {
+		t.Fatalf("failed to fetch battery info: %v", err)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected battery info (-want +got):\n%s", diff)
+	}
+
+	settings := &keylight.BatterySettings{
+		EnergySaving:        true,
+		MinimumBatteryLevel: 20,
+		AdjustBrightness:    true,
+		Brightness:          15,
+	}
+
+	if err := c.SetBatterySettings(ctx, settings); err != nil {
+		t.Fatalf("failed to set battery settings: %v", err)
+	}
+
+	if diff := cmp.Diff(settings, d.BatterySettings()); diff != "" {
+		t.Fatalf("unexpected battery settings (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,440 @@
+// Package metrics exports the state and health of Elgato Key Light devices as
+// Prometheus metrics.
+//
+// An Exporter polls each of its devices when it is scraped and writes metrics
+// in the Prometheus text exposition format. Every metric has a "device" label
+// containing the address of the device's HTTP API, which may be joined with
+// the keylight_device_info metric to select devices by serial number or
+// display name.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mdlayher/keylight"
+)
+
+// latencyBuckets are the upper bounds in seconds of the request latency
+// histogram buckets.
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// A Config configures an Exporter. A nil *Config applies default settings.
+type Config struct {
+	// Timeout is the maximum duration of a scrape. If zero, 5 seconds is
+	// used.
+	Timeout time.Duration
+}
+
+// An Exporter is an http.Handler which serves metrics for Key Light devices.
+type Exporter struct {
+	timeout time.Duration
+
+	mu        sync.Mutex
+	clients   []*keylight.Client
+	battery   map[string]bool
+	errors    map[string]uint64
+	latencies map[requestKey]*histogram
+}
+
+// NewExporter creates an Exporter, as configured by cfg. Use AddDevice to add
+// devices to the Exporter.
+func NewExporter(cfg *Config) *Exporter {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	return &Exporter{
+		timeout:   timeout,
+		battery:   make(map[string]bool),
+		errors:    make(map[string]uint64),
+		latencies: make(map[requestKey]*histogram),
+	}
+}
+
+// AddDevice adds the device controlled by c to the Exporter. To record request
+// latency, c should be created with keylight.WithMiddleware(e.Middleware()).
+func (e *Exporter) AddDevice(c *keylight.Client) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.clients = append(e.clients, c)
+}
+
+// Middleware returns a keylight.Middleware which records the latency of each
+// request made by a keylight.Client.
+func (e *Exporter) Middleware() keylight.Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return keylight.RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			start := time.Now()
+			res, err := next.RoundTrip(r)
+
+			code := "error"
+			if err == nil {
+				code = strconv.Itoa(res.StatusCode)
+			}
+
+			e.observe(requestKey{
+				device: deviceLabel(r.URL),
+				method: r.Method,
+				path:   r.URL.Path,
+				code:   code,
+			}, time.Since(start))
+
+			return res, err
+		})
+	}
+}
+
+// A requestKey identifies the latency histogram for a request.
+type requestKey struct {
+	device, method, path, code string
+}
+
+// A histogram is a cumulative histogram of request latency in seconds.
+type histogram struct {
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+// observe records the latency d of a request identified by k.
+func (e *Exporter) observe(k requestKey, d time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	h, ok := e.latencies[k]
+	if !ok {
+		h = &histogram{buckets: make([]uint64, len(latencyBuckets))}
+		e.latencies[k] = h
+	}
+
+	s := d.Seconds()
+	for i, b := range latencyBuckets {
+		if s <= b {
+			h.buckets[i]++
+		}
+	}
+	h.sum += s
+	h.count++
+}
+
+// ServeHTTP implements http.Handler.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), e.timeout)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = e.collect(ctx).write(w)
+}
+
+// A deviceState is the state of a device collected during a scrape.
+type deviceState struct {
+	device   string
+	info     *keylight.Device
+	lights   []*keylight.Light
+	battery  *keylight.BatteryInfo
+	duration time.Duration
+	err      error
+
+	// batteryErr is reported separately from err, because the device is
+	// otherwise usable without its battery information.
+	batteryErr error
+}
+
+// A scrape holds the metric families collected by a single scrape.
+type scrape struct {
+	families []*family
+}
+
+// collect polls each device concurrently and returns the resulting metrics.
+func (e *Exporter) collect(ctx context.Context) *scrape {
+	e.mu.Lock()
+	clients := append([]*keylight.Client(nil), e.clients...)
+	e.mu.Unlock()
+
+	states := make([]*deviceState, len(clients))
+	var wg sync.WaitGroup
+	for i, c := range clients {
+		wg.Add(1)
+		go func(i int, c *keylight.Client) {
+			defer wg.Done()
+			states[i] = e.poll(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// Record every device so that its error counter is reported from the
+	// first scrape.
+	for _, s := range states {
+		n := e.errors[s.device]
+		if s.err != nil {
+			n++
+		}
+		e.errors[s.device] = n
+	}
+
+	return e.metrics(states)
+}
+
+// poll fetches the state of the device controlled by c.
+func (e *Exporter) poll(ctx context.Context, c *keylight.Client) *deviceState {
+	start := time.Now()
+	s := &deviceState{device: c.Addr()}
+	if u, err := url.Parse(c.Addr()); err == nil {
+		s.device = deviceLabel(u)
+	}
+	defer func() { s.duration = time.Since(start) }()
+
+	if s.info, s.err = c.AccessoryInfo(ctx); s.err != nil {
+		return s
+	}
+	if s.lights, s.err = c.Lights(ctx); s.err != nil {
+		return s
+	}
+
+	e.mu.Lock()
+	battery, known := e.battery[s.device]
+	e.mu.Unlock()
+	if known && !battery {
+		return s
+	}
+
+	b, err := c.BatteryInfo(ctx)
+	var herr *keylight.HTTPError
+	switch {
+	case errors.As(err, &herr) && herr.StatusCode == http.StatusNotFound:
+		// The device has no battery, so don't ask again.
+		e.mu.Lock()
+		e.battery[s.device] = false
+		e.mu.Unlock()
+	case err != nil:
+		s.batteryErr = err
+	default:
+		e.mu.Lock()
+		e.battery[s.device] = true
+		e.mu.Unlock()
+		s.battery = b
+	}
+
+	return s
+}
+
+// metrics builds the metrics for states. e.mu must be held.
+func (e *Exporter) metrics(states []*deviceState) *scrape {
+	var (
+		up       = newFamily("keylight_up", "gauge", "Whether the last scrape of the device succeeded.")
+		duration = newFamily("keylight_scrape_duration_seconds", "gauge", "Duration of the last scrape of the device.")
+		errs     = newFamily("keylight_scrape_errors_total", "counter", "Total number of failed scrapes of the device.")
+		info     = newFamily("keylight_device_info", "gauge", "Information about the device, including its firmware.")
+		rssi     = newFamily("keylight_wifi_rssi_dbm", "gauge", "Received signal strength of the device's Wi-Fi connection.")
+		on       = newFamily("keylight_light_on", "gauge", "Whether the light is on.")
+		bright   = newFamily("keylight_light_brightness_percent", "gauge", "Brightness of the light.")
+		temp     = newFamily("keylight_light_temperature_kelvin", "gauge", "Color temperature of the light, when in temperature mode.")
+		batUp    = newFamily("keylight_battery_up", "gauge", "Whether the last fetch of the device's battery information succeeded.")
+		level    = newFamily("keylight_battery_level_percent", "gauge", "Charge level of the device's battery.")
+		external = newFamily("keylight_battery_external_power", "gauge", "Whether the device is powered by an external power source.")
+		latency  = newFamily("keylight_request_duration_seconds", "histogram", "Latency of requests to the device's HTTP API.")
+	)
+
+	for _, s := range states {
+		device := label{"device", s.device}
+
+		up.add(boolFloat(s.err == nil), device)
+		duration.add(s.duration.Seconds(), device)
+
+		if s.info != nil {
+			info.add(1, device,
+				label{"serial", s.info.SerialNumber},
+				label{"name", s.info.DisplayName},
+				label{"product", s.info.ProductName},
+				label{"firmware_version", s.info.FirmwareVersion},
+				label{"firmware_build", strconv.Itoa(s.info.FirmwareBuildNumber)},
+			)
+
+			if s.info.WiFi != nil && s.info.WiFi.RSSI != 0 {
+				rssi.add(float64(s.info.WiFi.RSSI), device, label{"ssid", s.info.WiFi.SSID})
+			}
+		}
+
+		for i, l := range s.lights {
+			light := label{"light", strconv.Itoa(i)}
+
+			on.add(boolFloat(l.On), device, light)
+			bright.add(float64(l.Brightness), device, light)
+			if l.Mode == keylight.ColorModeTemperature {
+				temp.add(float64(l.Temperature), device, light)
+			}
+		}
+
+		if s.battery != nil || s.batteryErr != nil {
+			batUp.add(boolFloat(s.batteryErr == nil), device)
+		}
+		if s.battery != nil {
+			level.add(s.battery.Level, device)
+			external.add(boolFloat(s.battery.PowerSource == keylight.PowerSourceExternal), device)
+		}
+	}
+
+	// Report errors for all devices which have been scraped, sorted for
+	// stable output.
+	devices := make([]string, 0, len(e.errors))
+	for d := range e.errors {
+		devices = append(devices, d)
+	}
+	sort.Strings(devices)
+	for _, d := range devices {
+		errs.add(float64(e.errors[d]), label{"device", d})
+	}
+
+	keys := make([]requestKey, 0, len(e.latencies))
+	for k := range e.latencies {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		return a.device+" "+a.path+" "+a.method+" "+a.code < b.device+" "+b.path+" "+b.method+" "+b.code
+	})
+
+	for _, k := range keys {
+		h := e.latencies[k]
+		labels := []label{{"device", k.device}, {"method", k.method}, {"path", k.path}, {"code", k.code}}
+
+		for i, b := range latencyBuckets {
+			latency.addSuffix("_bucket", float64(h.buckets[i]), append(labels, label{"le", formatFloat(b)})...)
+		}
+		latency.addSuffix("_bucket", float64(h.count), append(labels, label{"le", "+Inf"})...)
+		latency.addSuffix("_sum", h.sum, labels...)
+		latency.addSuffix("_count", float64(h.count), labels...)
+	}
+
+	return &scrape{families: []*family{
+		up, duration, errs, info, rssi, on, bright, temp, batUp, level, external, latency,
+	}}
+}
+
+// write writes the metrics to w in the Prometheus text exposition format.
+func (m *scrape) write(w io.Writer) error {
+	var b strings.Builder
+	for _, f := range m.families {
+		if len(f.samples) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&b, "# HELP %s %s\n", f.name, escape(f.help, false))
+		fmt.Fprintf(&b, "# TYPE %s %s\n", f.name, f.typ)
+
+		for _, s := range f.samples {
+			b.WriteString(f.name)
+			b.WriteString(s.suffix)
+
+			if len(s.labels) > 0 {
+				b.WriteByte('{')
+				for i, l := range s.labels {
+					if i > 0 {
+						b.WriteByte(',')
+					}
+					fmt.Fprintf(&b, "%s=\"%s\"", l.name, escape(l.value, true))
+				}
+				b.WriteByte('}')
+			}
+
+			fmt.Fprintf(&b, " %s\n", formatFloat(s.value))
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// A family is a metric family with a name, type, and samples.
+type family struct {
+	name, typ, help string
+	samples         []sample
+}
+
+// A sample is a single value of a metric family.
+type sample struct {
+	suffix string
+	labels []label
+	value  float64
+}
+
+// A label is a metric label name and value.
+type label struct {
+	name, value string
+}
+
+func newFamily(name, typ, help string) *family {
+	return &family{name: name, typ: typ, help: help}
+}
+
+// add adds a sample with value v and labels to the family.
+func (f *family) add(v float64, labels ...label) {
+	f.addSuffix("", v, labels...)
+}
+
+// addSuffix adds a sample with a name suffix, such as "_bucket" for
+// histograms.
+func (f *family) addSuffix(suffix string, v float64, labels ...label) {
+	f.samples = append(f.samples, sample{
+		suffix: suffix,
+		labels: append([]label(nil), labels...),
+		value:  v,
+	})
+}
+
+// deviceLabel returns the device label value for the device at u.
+func deviceLabel(u *url.URL) string {
+	return u.Scheme + "://" + u.Host
+}
+
+// escape escapes s for use in a HELP line or, if label is set, a label value.
+func escape(s string, label bool) string {
+	r := strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	if label {
+		r = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	}
+
+	return r.Replace(s)
+}
+
+// formatFloat formats v as a sample value.
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+func boolFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,159 @@
+package metrics_test
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/keylight"
+	"github.com/mdlayher/keylight/keylighttest"
+	"github.com/mdlayher/keylight/metrics"
+)
+
+func TestExporter(t *testing.T) {
+	e := metrics.NewExporter(nil)
+
+	mini := httptest.NewServer(keylighttest.NewDevice(&keylighttest.Config{
+		Profile: &keylighttest.KeyLightMini,
+		Device: &keylight.Device{
+			ProductName:         "Elgato Key Light Mini",
+			FirmwareBuildNumber: 229,
+			FirmwareVersion:     "1.0.3",
+			SerialNumber:        "SN0",
+			DisplayName:         `Desk "Mini"`,
+			WiFi:                &keylight.WiFiStatus{SSID: "home", RSSI: -52},
+		},
+		Lights:  []*keylight.Light{{On: true, Brightness: 40, Temperature: 4500}},
+		Battery: &keylight.BatteryInfo{PowerSource: keylight.PowerSourceExternal, Level: 87.5},
+	}))
+	defer mini.Close()
+
+	light := httptest.NewServer(keylighttest.NewDevice(nil))
+	defer light.Close()
+
+	// A device whose battery information cannot be fetched is still up.
+	flaky := keylighttest.NewDevice(&keylighttest.Config{Profile: &keylighttest.KeyLightMini})
+	flaky.InjectFault(keylighttest.Fault{Path: "/elgato/battery-info", StatusCode: http.StatusInternalServerError, Times: 2})
+	battery := httptest.NewServer(flaky)
+	defer battery.Close()
+
+	// An address which refuses connections.
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	addrs := map[string]string{
+		"mini":    mini.URL,
+		"light":   light.URL,
+		"battery": battery.URL,
+		"down":    down.URL,
+	}
+	for _, addr := range addrs {
+		c, err := keylight.New(addr, keylight.WithMiddleware(e.Middleware()))
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+
+		e.AddDevice(c)
+	}
+
+	// Error counters are reported for every device from the first scrape.
+	first := scrape(t, e)
+	for name, addr := range addrs {
+		want := "0"
+		if name == "down" {
+			want = "1"
+		}
+
+		k := `keylight_scrape_errors_total{device="` + addr + `"}`
+		if diff := cmp.Diff(want, first[k]); diff != "" {
+			t.Errorf("unexpected value for %s (-want +got):\n%s", k, diff)
+		}
+	}
+
+	// Scrape again to accumulate errors and latency observations.
+	got := scrape(t, e)
+
+	want := map[string]string{
+		`keylight_up{device="%[mini]"}`:                                                                                      "1",
+		`keylight_up{device="%[light]"}`:                                                                                     "1",
+		`keylight_up{device="%[battery]"}`:                                                                                   "1",
+		`keylight_up{device="%[down]"}`:                                                                                      "0",
+		`keylight_scrape_errors_total{device="%[mini]"}`:                                                                     "0",
+		`keylight_scrape_errors_total{device="%[down]"}`:                                                                     "2",
+		`keylight_light_on{device="%[mini]",light="0"}`:                                                                      "1",
+		`keylight_light_on{device="%[light]",light="0"}`:                                                                     "0",
+		`keylight_light_brightness_percent{device="%[mini]",light="0"}`:                                                      "40",
+		`keylight_light_temperature_kelvin{device="%[mini]",light="0"}`:                                                      "4500",
+		`keylight_battery_up{device="%[mini]"}`:                                                                              "1",
+		`keylight_battery_up{device="%[battery]"}`:                                                                           "0",
+		`keylight_battery_level_percent{device="%[mini]"}`:                                                                   "87.5",
+		`keylight_battery_external_power{device="%[mini]"}`:                                                                  "1",
+		`keylight_wifi_rssi_dbm{device="%[mini]",ssid="home"}`:                                                               "-52",
+		`keylight_request_duration_seconds_count{device="%[mini]",method="GET",path="/elgato/battery-info",code="200"}`:      "2",
+		`keylight_request_duration_seconds_bucket{device="%[mini]",method="GET",path="/elgato/lights",code="200",le="+Inf"}`: "2",
+		`keylight_device_info{device="%[mini]",serial="SN0",name="Desk \"Mini\"",product="Elgato Key Light Mini",firmware_version="1.0.3",firmware_build="229"}`: "1",
+	}
+
+	for k, v := range want {
+		for name, addr := range addrs {
+			k = strings.ReplaceAll(k, "%["+name+"]", addr)
+		}
+
+		if diff := cmp.Diff(v, got[k]); diff != "" {
+			t.Errorf("unexpected value for %s (-want +got):\n%s", k, diff)
+		}
+	}
+
+	// Devices without a battery are only asked once, and are not reported.
+	for k := range got {
+		if strings.Contains(k, "path=\"/elgato/battery-info\"") && strings.Contains(k, light.URL) &&
+			strings.HasPrefix(k, "keylight_request_duration_seconds_count") {
+			if diff := cmp.Diff("1", got[k]); diff != "" {
+				t.Errorf("unexpected battery requests (-want +got):\n%s", diff)
+			}
+		}
+
+		if strings.HasPrefix(k, "keylight_battery_") && strings.Contains(k, light.URL) {
+			t.Errorf("unexpected battery metric for device without a battery: %s", k)
+		}
+		if strings.HasPrefix(k, "keylight_battery_level_percent") && strings.Contains(k, battery.URL) {
+			t.Errorf("unexpected battery metric for failed fetch: %s", k)
+		}
+	}
+}
+
+// scrape scrapes e and returns each sample's value by its name and labels.
+func scrape(t *testing.T, e *metrics.Exporter) map[string]string {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if diff := cmp.Diff(http.StatusOK, rec.Code); diff != "" {
+		t.Fatalf("unexpected status code (-want +got):\n%s", diff)
+	}
+
+	samples := make(map[string]string)
+	s := bufio.NewScanner(rec.Body)
+	for s.Scan() {
+		line := s.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		i := strings.LastIndex(line, " ")
+		if i == -1 {
+			t.Fatalf("malformed sample: %q", line)
+		}
+
+		samples[line[:i]] = line[i+1:]
+	}
+	if err := s.Err(); err != nil {
+		t.Fatalf("failed to scan metrics: %v", err)
+	}
+
+	return samples
+}
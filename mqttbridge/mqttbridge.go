@@ -0,0 +1,623 @@
+// Package mqttbridge bridges Elgato Key Light devices to an MQTT broker, with
+// support for Home Assistant MQTT discovery.
+//
+// The state of each light is published to retained topics under a base topic,
+// by default "keylight", where SERIAL is the device's serial number and N is
+// the index of the light:
+//
+//	keylight/bridge/availability       "online" or "offline"
+//	keylight/SERIAL/availability       "online" or "offline"
+//	keylight/SERIAL/N/state            "ON" or "OFF"
+//	keylight/SERIAL/N/brightness       brightness percentage, 3-100
+//	keylight/SERIAL/N/color_temp       color temperature in mireds
+//
+// Lights are controlled by publishing to the same topics with a "/set"
+// suffix, such as "keylight/SERIAL/0/brightness/set".
+package mqttbridge
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/mdlayher/keylight"
+)
+
+// The range of color temperatures in mireds supported by Key Light devices,
+// as converted from their native units by keylight.RawToMireds.
+const (
+	minMireds = 143
+	maxMireds = 345
+)
+
+// Availability payloads.
+const (
+	online  = "online"
+	offline = "offline"
+)
+
+// A Config configures a Bridge.
+type Config struct {
+	// Clients are the devices bridged to the broker.
+	Clients []*keylight.Client
+
+	// Broker is the address of the MQTT broker, such as "localhost:1883".
+	Broker string
+
+	// ClientID, Username, and Password are used to connect to the broker. If
+	// ClientID is empty, "keylight" is used. Credentials are only sent to a
+	// broker on the loopback interface or over TLS.
+	ClientID, Username, Password string
+
+	// TLSConfig, if set, is used to connect to the broker using TLS.
+	TLSConfig *tls.Config
+
+	// Topic is the base topic for device state and commands. If empty,
+	// "keylight" is used.
+	Topic string
+
+	// DiscoveryPrefix is the Home Assistant MQTT discovery prefix. If empty,
+	// "homeassistant" is used.
+	DiscoveryPrefix string
+
+	// Interval is the interval at which devices are polled for changes. If
+	// zero, 5 seconds is used.
+	Interval time.Duration
+
+	// Logger, if set, logs connection failures and commands which fail.
+	Logger *slog.Logger
+}
+
+// A Bridge publishes the state of Key Light devices to an MQTT broker and
+// applies commands received from it.
+type Bridge struct {
+	devices            []*device
+	broker             string
+	clientID           string
+	username, password string
+	tlsConfig          *tls.Config
+	topic              string
+	status             string
+	prefix             string
+	interval           time.Duration
+	ll                 *slog.Logger
+}
+
+// A device is the state of a device bridged to the broker.
+type device struct {
+	c *keylight.Client
+
+	// info is set once the device is first reached.
+	info *keylight.Device
+
+	// The state most recently published for the device, which is reset on
+	// each connection to the broker.
+	discovered int
+	available  string
+	published  map[string]string
+}
+
+// New creates a Bridge, as configured by cfg.
+func New(cfg Config) (*Bridge, error) {
+	if len(cfg.Clients) == 0 {
+		return nil, errors.New("mqttbridge: at least one client is required")
+	}
+	if cfg.Broker == "" {
+		return nil, errors.New("mqttbridge: broker address must not be empty")
+	}
+	if (cfg.Username != "" || cfg.Password != "") && cfg.TLSConfig == nil && !loopback(cfg.Broker) {
+		return nil, errors.New("mqttbridge: TLS is required to send credentials to a remote broker")
+	}
+
+	if cfg.ClientID == "" {
+		cfg.ClientID = "keylight"
+	}
+	if cfg.Topic == "" {
+		cfg.Topic = "keylight"
+	}
+	if cfg.DiscoveryPrefix == "" {
+		cfg.DiscoveryPrefix = "homeassistant"
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 5 * time.Second
+	}
+
+	devices := make([]*device, 0, len(cfg.Clients))
+	for _, c := range cfg.Clients {
+		devices = append(devices, &device{c: c})
+	}
+
+	topic := strings.TrimSuffix(cfg.Topic, "/")
+
+	return &Bridge{
+		devices:   devices,
+		broker:    cfg.Broker,
+		clientID:  cfg.ClientID,
+		username:  cfg.Username,
+		password:  cfg.Password,
+		tlsConfig: cfg.TLSConfig,
+		topic:     topic,
+		status:    topic + "/bridge/availability",
+		prefix:    strings.TrimSuffix(cfg.DiscoveryPrefix, "/"),
+		interval:  cfg.Interval,
+		ll:        cfg.Logger,
+	}, nil
+}
+
+// loopback reports whether the broker address addr is on the loopback
+// interface.
+func loopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Run connects to the broker and bridges devices until ctx is canceled, at
+// which point it marks the bridge offline and returns ctx.Err(). If the
+// connection to the broker fails, Run reconnects with exponential backoff.
+func (b *Bridge) Run(ctx context.Context) error {
+	const maxBackoff = 30 * time.Second
+	backoff := time.Second
+
+	for {
+		connected, err := b.session(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if connected {
+			backoff = time.Second
+		}
+
+		if b.ll != nil {
+			b.ll.Warn("broker connection failed", slog.String("broker", b.broker),
+				slog.Duration("retry", backoff), slog.String("error", err.Error()))
+		}
+
+		t := time.NewTimer(backoff)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// session bridges devices over a single connection to the broker, and
+// reports whether the connection was established.
+func (b *Bridge) session(ctx context.Context) (bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Messages are handled by the session loop so that commands and polls
+	// never race for the same device. The client delivers messages in order
+	// on its own goroutine, which the handler blocks until the session loop
+	// is ready or finished.
+	var (
+		msgs = make(chan mqtt.Message, 16)
+		lost = make(chan error, 1)
+	)
+
+	scheme := "tcp"
+	if b.tlsConfig != nil {
+		scheme = "tls"
+	}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(scheme+"://"+b.broker).
+		SetClientID(b.clientID).
+		SetUsername(b.username).
+		SetPassword(b.password).
+		SetTLSConfig(b.tlsConfig).
+		SetBinaryWill(b.status, []byte(offline), 0, true).
+		SetConnectTimeout(10 * time.Second).
+		SetWriteTimeout(10 * time.Second).
+		// Run reconnects and republishes state itself.
+		SetAutoReconnect(false).
+		SetDefaultPublishHandler(func(_ mqtt.Client, m mqtt.Message) {
+			select {
+			case msgs <- m:
+			case <-ctx.Done():
+			}
+		}).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			lost <- err
+		})
+
+	// Connecting is bounded by the connect timeout.
+	mc := mqtt.NewClient(opts)
+	conn := mc.Connect()
+	conn.Wait()
+	if err := conn.Error(); err != nil {
+		return false, err
+	}
+	defer func() {
+		// Unblock the message handler so that the client can shut down.
+		cancel()
+		mc.Disconnect(250)
+	}()
+
+	for _, d := range b.devices {
+		d.discovered, d.available, d.published = 0, "", nil
+	}
+
+	filters := map[string]byte{
+		b.topic + "/+/+/set":   0,
+		b.topic + "/+/+/+/set": 0,
+		b.prefix + "/status":   0,
+	}
+	if err := wait(ctx, mc.SubscribeMultiple(filters, nil)); err != nil {
+		return true, err
+	}
+	if err := b.publish(mc, b.status, online); err != nil {
+		return true, err
+	}
+
+	b.poll(ctx, mc)
+
+	t := time.NewTicker(b.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// Mark the bridge offline explicitly, because the broker does not
+			// publish the will of a client which disconnects cleanly.
+			_ = b.publish(mc, b.status, offline)
+			return true, ctx.Err()
+		case err := <-lost:
+			return true, err
+		case <-t.C:
+			b.poll(ctx, mc)
+		case m := <-msgs:
+			b.handle(ctx, mc, m)
+		}
+	}
+}
+
+// poll publishes the state of all devices concurrently.
+func (b *Bridge) poll(ctx context.Context, mc mqtt.Client) {
+	ctx, cancel := context.WithTimeout(ctx, b.interval)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, d := range b.devices {
+		wg.Add(1)
+		go func(d *device) {
+			defer wg.Done()
+
+			lights, err := d.poll(ctx)
+			if err != nil && b.ll != nil {
+				b.ll.Debug("failed to poll device", slog.String("addr", d.c.Addr()), slog.String("error", err.Error()))
+			}
+			if err := b.update(mc, d, lights); err != nil && b.ll != nil {
+				b.ll.Warn("failed to publish device state", slog.String("addr", d.c.Addr()), slog.String("error", err.Error()))
+			}
+		}(d)
+	}
+	wg.Wait()
+}
+
+// poll fetches the current state of the device's lights, and its accessory
+// information if it is not yet known. It returns nil lights if the device is
+// unreachable.
+func (d *device) poll(ctx context.Context) ([]*keylight.Light, error) {
+	if d.info == nil {
+		info, err := d.c.AccessoryInfo(ctx)
+		if err != nil {
+			return nil, err
+		}
+		d.info = info
+	}
+
+	return d.c.Lights(ctx)
+}
+
+// update publishes the discovery configuration and state of d which have
+// changed since they were last published. If lights is nil, d is marked
+// unavailable.
+func (b *Bridge) update(mc mqtt.Client, d *device, lights []*keylight.Light) error {
+	if d.info == nil {
+		// Nothing is known about the device, so it cannot be published.
+		return nil
+	}
+
+	base := b.topic + "/" + d.info.SerialNumber
+
+	available := online
+	if lights == nil {
+		available = offline
+	}
+	if available != d.available {
+		if err := b.publish(mc, base+"/availability", available); err != nil {
+			return err
+		}
+		d.available = available
+	}
+
+	if lights == nil {
+		return nil
+	}
+
+	if len(lights) != d.discovered {
+		for i := range lights {
+			if err := b.discover(mc, d, i, len(lights)); err != nil {
+				return err
+			}
+		}
+		d.discovered = len(lights)
+	}
+
+	if d.published == nil {
+		d.published = make(map[string]string)
+	}
+
+	for i, l := range lights {
+		light := fmt.Sprintf("%s/%d", base, i)
+
+		state := map[string]string{
+			light + "/state":      "OFF",
+			light + "/brightness": strconv.Itoa(l.Brightness),
+		}
+		if l.On {
+			state[light+"/state"] = "ON"
+		}
+		if l.Mode == keylight.ColorModeTemperature {
+			state[light+"/color_temp"] = strconv.Itoa(mireds(l))
+		}
+
+		for topic, payload := range state {
+			if d.published[topic] == payload {
+				continue
+			}
+
+			if err := b.publish(mc, topic, payload); err != nil {
+				return err
+			}
+			d.published[topic] = payload
+		}
+	}
+
+	return nil
+}
+
+// A discovery is a Home Assistant MQTT discovery payload for a light.
+type discovery struct {
+	// Name is null for devices with a single light, so that the light takes
+	// the name of the device.
+	Name     *string `json:"name"`
+	UniqueID string  `json:"unique_id"`
+
+	CommandTopic           string `json:"command_topic"`
+	StateTopic             string `json:"state_topic"`
+	BrightnessCommandTopic string `json:"brightness_command_topic"`
+	BrightnessStateTopic   string `json:"brightness_state_topic"`
+	BrightnessScale        int    `json:"brightness_scale"`
+	ColorTempCommandTopic  string `json:"color_temp_command_topic"`
+	ColorTempStateTopic    string `json:"color_temp_state_topic"`
+	MinMireds              int    `json:"min_mireds"`
+	MaxMireds              int    `json:"max_mireds"`
+
+	Availability     []availability `json:"availability"`
+	AvailabilityMode string         `json:"availability_mode"`
+
+	Device discoveryDevice `json:"device"`
+}
+
+// An availability is a Home Assistant availability topic.
+type availability struct {
+	Topic string `json:"topic"`
+}
+
+// A discoveryDevice is the Home Assistant device registry entry for a light.
+type discoveryDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model"`
+	SerialNumber string   `json:"serial_number"`
+	SWVersion    string   `json:"sw_version"`
+}
+
+// discover publishes the Home Assistant discovery payload for light i of n on
+// device d.
+func (b *Bridge) discover(mc mqtt.Client, d *device, i, n int) error {
+	serial := d.info.SerialNumber
+	base := b.topic + "/" + serial
+	light := fmt.Sprintf("%s/%d", base, i)
+
+	var name *string
+	if n > 1 {
+		s := fmt.Sprintf("Light %d", i+1)
+		name = &s
+	}
+
+	display := d.info.DisplayName
+	if display == "" {
+		display = d.info.ProductName
+	}
+
+	payload, err := json.Marshal(discovery{
+		Name:                   name,
+		UniqueID:               fmt.Sprintf("keylight_%s_%d", serial, i),
+		CommandTopic:           light + "/set",
+		StateTopic:             light + "/state",
+		BrightnessCommandTopic: light + "/brightness/set",
+		BrightnessStateTopic:   light + "/brightness",
+		BrightnessScale:        keylight.BrightnessMax,
+		ColorTempCommandTopic:  light + "/color_temp/set",
+		ColorTempStateTopic:    light + "/color_temp",
+		MinMireds:              minMireds,
+		MaxMireds:              maxMireds,
+		Availability: []availability{
+			{Topic: b.status},
+			{Topic: base + "/availability"},
+		},
+		AvailabilityMode: "all",
+		Device: discoveryDevice{
+			Identifiers:  []string{"keylight_" + serial},
+			Name:         display,
+			Manufacturer: "Elgato",
+			Model:        d.info.ProductName,
+			SerialNumber: serial,
+			SWVersion:    d.info.FirmwareVersion,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return b.publish(mc, fmt.Sprintf("%s/light/keylight_%s_%d/config", b.prefix, serial, i), string(payload))
+}
+
+// handle handles a message received from the broker.
+func (b *Bridge) handle(ctx context.Context, mc mqtt.Client, m mqtt.Message) {
+	if m.Topic() == b.prefix+"/status" {
+		// Home Assistant restarted, so publish everything again.
+		if string(m.Payload()) == online {
+			for _, d := range b.devices {
+				d.discovered, d.published = 0, nil
+			}
+			b.poll(ctx, mc)
+		}
+		return
+	}
+
+	d, u, err := b.command(m)
+	if err != nil {
+		if b.ll != nil {
+			b.ll.Warn("invalid command", slog.String("topic", m.Topic()), slog.String("error", err.Error()))
+		}
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, b.interval)
+	defer cancel()
+
+	lights, err := d.c.UpdateLights(ctx, u)
+	if err != nil {
+		if b.ll != nil {
+			b.ll.Warn("failed to update lights", slog.String("addr", d.c.Addr()), slog.String("error", err.Error()))
+		}
+		return
+	}
+
+	if err := b.update(mc, d, lights); err != nil && b.ll != nil {
+		b.ll.Warn("failed to publish device state", slog.String("addr", d.c.Addr()), slog.String("error", err.Error()))
+	}
+}
+
+// command parses a command message into the device and update to apply.
+func (b *Bridge) command(m mqtt.Message) (*device, *keylight.LightUpdate, error) {
+	// SERIAL/N/set or SERIAL/N/FIELD/set.
+	parts := strings.Split(strings.TrimPrefix(m.Topic(), b.topic+"/"), "/")
+	if len(parts) < 3 || len(parts) > 4 || parts[len(parts)-1] != "set" {
+		return nil, nil, errors.New("unknown topic")
+	}
+
+	var d *device
+	for _, dd := range b.devices {
+		if dd.info != nil && dd.info.SerialNumber == parts[0] {
+			d = dd
+			break
+		}
+	}
+	if d == nil {
+		return nil, nil, fmt.Errorf("unknown device %q", parts[0])
+	}
+
+	i, err := strconv.Atoi(parts[1])
+	if err != nil || i < 0 {
+		return nil, nil, fmt.Errorf("invalid light index %q", parts[1])
+	}
+
+	u := &keylight.LightUpdate{Index: i}
+	payload := strings.TrimSpace(string(m.Payload()))
+
+	field := "state"
+	if len(parts) == 4 {
+		field = parts[2]
+	}
+
+	switch field {
+	case "state":
+		var on bool
+		switch payload {
+		case "ON":
+			on = true
+		case "OFF":
+		default:
+			return nil, nil, fmt.Errorf("invalid state %q", payload)
+		}
+		u.On = &on
+	case "brightness":
+		v, err := strconv.ParseFloat(payload, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid brightness %q", payload)
+		}
+
+		brightness := max(keylight.BrightnessMin, min(int(math.Round(v)), keylight.BrightnessMax))
+		u.Brightness = &brightness
+	case "color_temp":
+		v, err := strconv.ParseFloat(payload, 64)
+		if err != nil || v <= 0 {
+			return nil, nil, fmt.Errorf("invalid color temperature %q", payload)
+		}
+
+		temperature := max(keylight.TemperatureMin, min(keylight.MiredsToKelvin(v), keylight.TemperatureMax))
+		u.Temperature = &temperature
+	default:
+		return nil, nil, fmt.Errorf("unknown field %q", field)
+	}
+
+	return d, u, nil
+}
+
+// publish publishes a retained message. Writes are bounded by the client's
+// write timeout.
+func (b *Bridge) publish(mc mqtt.Client, topic, payload string) error {
+	t := mc.Publish(topic, 0, true, payload)
+	t.Wait()
+	return t.Error()
+}
+
+// wait waits for t to complete or for ctx to be canceled.
+func wait(ctx context.Context, t mqtt.Token) error {
+	select {
+	case <-t.Done():
+		return t.Error()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// mireds returns the color temperature of l in mireds, using the device's
+// native units when available for precision.
+func mireds(l *keylight.Light) int {
+	if l.RawTemperature != 0 {
+		return int(math.Round(keylight.RawToMireds(l.RawTemperature)))
+	}
+
+	return int(math.Round(keylight.KelvinToMireds(l.Temperature)))
+}
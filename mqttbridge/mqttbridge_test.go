@@ -0,0 +1,272 @@
+package mqttbridge_test
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/keylight"
+	"github.com/mdlayher/keylight/internal/mqtttest"
+	"github.com/mdlayher/keylight/keylighttest"
+	"github.com/mdlayher/keylight/mqttbridge"
+)
+
+func TestBridge(t *testing.T) {
+	broker, err := mqtttest.NewBroker()
+	if err != nil {
+		t.Fatalf("failed to create broker: %v", err)
+	}
+	defer broker.Close()
+
+	d := keylighttest.NewDevice(&keylighttest.Config{
+		Device: &keylight.Device{
+			ProductName:     "Elgato Key Light",
+			FirmwareVersion: "1.0.3",
+			SerialNumber:    "SN0",
+			DisplayName:     "Desk",
+		},
+		Lights: []*keylight.Light{{On: true, Brightness: 40, Temperature: 5000}},
+	})
+	srv := httptest.NewServer(d)
+	defer srv.Close()
+
+	c, err := keylight.New(srv.URL)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	b, err := mqttbridge.New(mqttbridge.Config{
+		Clients:  []*keylight.Client{c},
+		Broker:   broker.Addr(),
+		Interval: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("failed to create bridge: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errC := make(chan error, 1)
+	go func() { errC <- b.Run(ctx) }()
+
+	// The initial state of the device is published to retained topics.
+	for topic, payload := range map[string]string{
+		"keylight/bridge/availability": "online",
+		"keylight/SN0/availability":    "online",
+		"keylight/SN0/0/state":         "ON",
+		"keylight/SN0/0/brightness":    "40",
+		"keylight/SN0/0/color_temp":    "200",
+	} {
+		waitRetained(t, broker, topic, payload)
+	}
+
+	var got map[string]interface{}
+	m := broker.Retained("homeassistant/light/keylight_SN0_0/config")
+	if m == nil {
+		t.Fatal("no discovery payload was published")
+	}
+	if err := json.Unmarshal(m.Payload, &got); err != nil {
+		t.Fatalf("failed to unmarshal discovery payload: %v", err)
+	}
+
+	want := map[string]interface{}{
+		"name":                     nil,
+		"unique_id":                "keylight_SN0_0",
+		"command_topic":            "keylight/SN0/0/set",
+		"state_topic":              "keylight/SN0/0/state",
+		"brightness_command_topic": "keylight/SN0/0/brightness/set",
+		"brightness_state_topic":   "keylight/SN0/0/brightness",
+		"brightness_scale":         100.0,
+		"color_temp_command_topic": "keylight/SN0/0/color_temp/set",
+		"color_temp_state_topic":   "keylight/SN0/0/color_temp",
+		"min_mireds":               143.0,
+		"max_mireds":               345.0,
+		"availability": []interface{}{
+			map[string]interface{}{"topic": "keylight/bridge/availability"},
+			map[string]interface{}{"topic": "keylight/SN0/availability"},
+		},
+		"availability_mode": "all",
+		"device": map[string]interface{}{
+			"identifiers":   []interface{}{"keylight_SN0"},
+			"name":          "Desk",
+			"manufacturer":  "Elgato",
+			"model":         "Elgato Key Light",
+			"serial_number": "SN0",
+			"sw_version":    "1.0.3",
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected discovery payload (-want +got):\n%s", diff)
+	}
+
+	// Commands are applied to the device and its new state is published.
+	mc := mqtt.NewClient(mqtt.NewClientOptions().AddBroker("tcp://" + broker.Addr()))
+	if ct := mc.Connect(); ct.Wait() && ct.Error() != nil {
+		t.Fatalf("failed to dial broker: %v", ct.Error())
+	}
+	defer mc.Disconnect(0)
+
+	tests := []struct {
+		topic, payload string
+		state          string
+		want           keylight.Light
+	}{
+		{
+			topic:   "keylight/SN0/0/set",
+			payload: "OFF",
+			state:   "keylight/SN0/0/state",
+			want:    keylight.Light{Brightness: 40, Temperature: 5000},
+		},
+		{
+			topic:   "keylight/SN0/0/brightness/set",
+			payload: "75",
+			state:   "keylight/SN0/0/brightness",
+			want:    keylight.Light{Brightness: 75, Temperature: 5000},
+		},
+		{
+			topic:   "keylight/SN0/0/color_temp/set",
+			payload: "250",
+			state:   "keylight/SN0/0/color_temp",
+			want:    keylight.Light{Brightness: 75, Temperature: 4000},
+		},
+		{
+			topic:   "keylight/SN0/0/set",
+			payload: "ON",
+			state:   "keylight/SN0/0/state",
+			want:    keylight.Light{On: true, Brightness: 75, Temperature: 4000},
+		},
+	}
+
+	for _, tt := range tests {
+		if pt := mc.Publish(tt.topic, 0, false, tt.payload); pt.Wait() && pt.Error() != nil {
+			t.Fatalf("failed to publish command: %v", pt.Error())
+		}
+
+		waitRetained(t, broker, tt.state, tt.payload)
+
+		l := d.Lights()[0]
+		got := keylight.Light{On: l.On, Brightness: l.Brightness, Temperature: l.Temperature}
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Fatalf("%s: unexpected light state (-want +got):\n%s", tt.topic, diff)
+		}
+	}
+
+	// When the connection to the broker fails, the will marks the bridge
+	// offline until it reconnects.
+	broker.Drop()
+	waitRetained(t, broker, "keylight/bridge/availability", "offline")
+	waitRetained(t, broker, "keylight/bridge/availability", "online")
+
+	// Stopping the bridge marks it offline.
+	cancel()
+	if err := <-errC; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context canceled, but got: %v", err)
+	}
+	waitRetained(t, broker, "keylight/bridge/availability", "offline")
+}
+
+func TestBridgeTLS(t *testing.T) {
+	// Borrow the certificate of a test HTTPS server, which is valid for the
+	// loopback interface.
+	srv := httptest.NewTLSServer(nil)
+	defer srv.Close()
+
+	broker, err := mqtttest.NewTLSBroker(&tls.Config{Certificates: srv.TLS.Certificates})
+	if err != nil {
+		t.Fatalf("failed to create broker: %v", err)
+	}
+	defer broker.Close()
+
+	dsrv := httptest.NewServer(keylighttest.NewDevice(nil))
+	defer dsrv.Close()
+
+	c, err := keylight.New(dsrv.URL)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	b, err := mqttbridge.New(mqttbridge.Config{
+		Clients:   []*keylight.Client{c},
+		Broker:    broker.Addr(),
+		Username:  "keylight",
+		Password:  "secret",
+		TLSConfig: &tls.Config{RootCAs: srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs},
+		Interval:  20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("failed to create bridge: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errC := make(chan error, 1)
+	go func() { errC <- b.Run(ctx) }()
+
+	waitRetained(t, broker, "keylight/bridge/availability", "online")
+
+	cancel()
+	if err := <-errC; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context canceled, but got: %v", err)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	c, err := keylight.New("http://keylight:9123")
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		cfg  mqttbridge.Config
+	}{
+		{
+			name: "no clients",
+			cfg:  mqttbridge.Config{Broker: "localhost:1883"},
+		},
+		{
+			name: "no broker",
+			cfg:  mqttbridge.Config{Clients: []*keylight.Client{c}},
+		},
+		{
+			name: "credentials without TLS",
+			cfg: mqttbridge.Config{
+				Clients:  []*keylight.Client{c},
+				Broker:   "mqtt.example.com:1883",
+				Username: "keylight",
+				Password: "secret",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := mqttbridge.New(tt.cfg); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
+
+// waitRetained waits for the broker to retain payload on topic.
+func waitRetained(t *testing.T, b *mqtttest.Broker, topic, payload string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		m := b.Retained(topic)
+		if m != nil && string(m.Payload) == payload {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %q on %q, last message: %v", payload, topic, m)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
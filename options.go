@@ -0,0 +1,130 @@
+package keylight
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// An Option configures a Client created by New.
+type Option func(c *Client)
+
+// New creates a Client for the Key Light specified by addr, configured by
+// zero or more Options. By default, a Client uses an HTTP client with a 2
+// second timeout and makes a single attempt for each request.
+func New(addr string, options ...Option) (*Client, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{u: u}
+	for _, o := range options {
+		o(c)
+	}
+
+	if c.c == nil {
+		c.c = &http.Client{Timeout: 2 * time.Second}
+	}
+
+	if len(c.middleware) > 0 {
+		// Copy the caller's HTTP client so that it is not modified.
+		hc := *c.c
+		rt := hc.Transport
+		if rt == nil {
+			rt = http.DefaultTransport
+		}
+
+		// Apply in reverse so the first Middleware sees requests first.
+		for i := len(c.middleware) - 1; i >= 0; i-- {
+			rt = c.middleware[i](rt)
+		}
+
+		hc.Transport = rt
+		c.c = &hc
+	}
+
+	return c, nil
+}
+
+// WithHTTPClient configures the HTTP client used by a Client. If c is nil, a
+// default HTTP client will be configured.
+func WithHTTPClient(c *http.Client) Option {
+	return func(cl *Client) {
+		cl.c = c
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with each request.
+func WithUserAgent(ua string) Option {
+	return func(c *Client) {
+		c.userAgent = ua
+	}
+}
+
+// WithLogger enables logging of each request and its response or error at
+// debug level.
+func WithLogger(ll *slog.Logger) Option {
+	return func(c *Client) {
+		c.log = ll
+	}
+}
+
+// A Middleware wraps an http.RoundTripper to observe or modify the requests
+// and responses of a Client.
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// A RoundTripperFunc is an adapter to allow the use of ordinary functions as
+// an http.RoundTripper, such as within a Middleware.
+type RoundTripperFunc func(r *http.Request) (*http.Response, error)
+
+// RoundTrip implements http.RoundTripper.
+func (fn RoundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return fn(r)
+}
+
+// WithMiddleware adds Middleware to the chain which wraps the transport of a
+// Client's HTTP client. Middleware is applied in order, so the first
+// Middleware sees each request first and each response last. The caller's
+// HTTP client is not modified.
+func WithMiddleware(mw ...Middleware) Option {
+	return func(c *Client) {
+		c.middleware = append(c.middleware, mw...)
+	}
+}
+
+// Timeouts configures per-operation timeouts for a Client. A timeout applies
+// to an entire operation, including any retries, but only when the caller's
+// context has no deadline. Zero values disable the timeout for that kind of
+// operation.
+type Timeouts struct {
+	// Read applies to operations which fetch information from a device.
+	Read time.Duration
+
+	// Write applies to operations which modify a device or its lights.
+	Write time.Duration
+}
+
+// WithTimeouts configures per-operation timeouts for a Client.
+func WithTimeouts(t Timeouts) Option {
+	return func(c *Client) {
+		c.timeouts = t
+	}
+}
+
+// withTimeout applies the appropriate operation timeout for method to ctx if
+// ctx has no deadline.
+func (c *Client) withTimeout(ctx context.Context, method string) (context.Context, context.CancelFunc) {
+	d := c.timeouts.Write
+	if method == http.MethodGet {
+		d = c.timeouts.Read
+	}
+
+	if _, ok := ctx.Deadline(); ok || d == 0 {
+		return ctx, func() {}
+	}
+
+	return context.WithTimeout(ctx, d)
+}
@@ -0,0 +1,166 @@
+package keylight_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/keylight"
+)
+
+func TestClientUserAgent(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	var got string
+	c := testOptionsClient(t, func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("User-Agent")
+		_, _ = w.Write([]byte(`{}`))
+	}, keylight.WithUserAgent("studio-automation/1.0"))
+
+	if _, err := c.AccessoryInfo(ctx); err != nil {
+		t.Fatalf("failed to fetch device: %v", err)
+	}
+
+	if diff := cmp.Diff("studio-automation/1.0", got); diff != "" {
+		t.Fatalf("unexpected User-Agent (-want +got):\n%s", diff)
+	}
+}
+
+func TestClientLogger(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	var buf bytes.Buffer
+	ll := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	c := testOptionsClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}, keylight.WithLogger(ll))
+
+	if _, err := c.AccessoryInfo(ctx); err == nil {
+		t.Fatal("an error was expected, but none occurred")
+	}
+
+	for _, s := range []string{
+		`msg="request complete"`,
+		"method=GET",
+		"/elgato/accessory-info",
+		"status=404",
+	} {
+		if !strings.Contains(buf.String(), s) {
+			t.Fatalf("log output did not contain %q:\n%s", s, buf.String())
+		}
+	}
+}
+
+func TestClientMiddleware(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	var calls []string
+	mw := func(name string) keylight.Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return keylight.RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				calls = append(calls, name+" request")
+				r.Header.Add("X-Middleware", name)
+
+				res, err := next.RoundTrip(r)
+				calls = append(calls, name+" response")
+				return res, err
+			})
+		}
+	}
+
+	var header []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Values("X-Middleware")
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	hc := &http.Client{Timeout: time.Second}
+	c, err := keylight.New(srv.URL,
+		keylight.WithHTTPClient(hc),
+		keylight.WithMiddleware(mw("first"), mw("second")),
+	)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	if _, err := c.AccessoryInfo(ctx); err != nil {
+		t.Fatalf("failed to fetch device: %v", err)
+	}
+
+	want := []string{"first request", "second request", "second response", "first response"}
+	if diff := cmp.Diff(want, calls); diff != "" {
+		t.Fatalf("unexpected middleware calls (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff([]string{"first", "second"}, header); diff != "" {
+		t.Fatalf("unexpected middleware headers (-want +got):\n%s", diff)
+	}
+
+	if hc.Transport != nil {
+		t.Fatal("caller's HTTP client was modified")
+	}
+}
+
+func TestClientTimeouts(t *testing.T) {
+	c := testOptionsClient(t, func(_ http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			// Writes complete immediately.
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+		case <-time.After(100 * time.Millisecond):
+		}
+	}, keylight.WithTimeouts(keylight.Timeouts{
+		Read:  20 * time.Millisecond,
+		Write: time.Second,
+	}))
+
+	// No deadline, so the read timeout applies.
+	if _, err := c.AccessoryInfo(context.Background()); !errors.Is(err, keylight.ErrTimeout) {
+		t.Fatalf("expected timeout, but got: %v", err)
+	}
+
+	if err := c.Identify(context.Background()); err != nil {
+		t.Fatalf("failed to identify: %v", err)
+	}
+
+	// The caller's deadline takes precedence over the read timeout.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if _, err := c.AccessoryInfo(ctx); err == nil || errors.Is(err, keylight.ErrTimeout) {
+		// The handler responds with an empty body which fails to decode,
+		// but the request itself must not time out.
+		t.Fatalf("expected decoding error, but got: %v", err)
+	}
+}
+
+// testOptionsClient creates a *keylight.Client configured with options which
+// is pointed at the HTTP server running with handler fn.
+func testOptionsClient(t *testing.T, fn http.HandlerFunc, options ...keylight.Option) *keylight.Client {
+	t.Helper()
+
+	srv := httptest.NewServer(fn)
+	t.Cleanup(srv.Close)
+
+	c, err := keylight.New(srv.URL, options...)
+	if err != nil {
+		t.Fatalf("failed to create keylight client: %v", err)
+	}
+
+	return c
+}
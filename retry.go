@@ -0,0 +1,106 @@
+package keylight
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// A RetryPolicy configures retries of failed idempotent requests. Only GET
+// and PUT requests are retried, so Identify is never retried.
+//
+// Requests which fail because the device is unreachable, the request timed
+// out, the response was truncated, or the device returned an HTTP 5xx status
+// are retried. Requests are never retried once the caller's context is done.
+type RetryPolicy struct {
+	// Attempts is the maximum number of attempts for a request, including the
+	// first. Values less than 1 are treated as 1.
+	Attempts int
+
+	// MinBackoff is the delay before the first retry, which doubles for each
+	// subsequent retry up to MaxBackoff. Each delay is randomly reduced by up
+	// to half to avoid synchronized retries from multiple clients.
+	MinBackoff, MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy is a RetryPolicy suitable for most Key Light devices.
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:   3,
+	MinBackoff: 100 * time.Millisecond,
+	MaxBackoff: 1 * time.Second,
+}
+
+// WithRetry enables retries of failed idempotent requests according to p.
+func WithRetry(p RetryPolicy) Option {
+	if p.Attempts < 1 {
+		p.Attempts = 1
+	}
+	if p.MaxBackoff < p.MinBackoff {
+		p.MaxBackoff = p.MinBackoff
+	}
+
+	return func(c *Client) {
+		c.retry = &p
+	}
+}
+
+// WithSerialization serializes requests made by a Client so that only one
+// request is in flight at a time, even when the Client is used by many
+// goroutines concurrently. Key Light firmware is known to drop connections
+// under concurrent load.
+func WithSerialization() Option {
+	return func(c *Client) {
+		c.sem = make(chan struct{}, 1)
+	}
+}
+
+// idempotent reports whether requests using method may be safely retried.
+func idempotent(method string) bool {
+	return method == http.MethodGet || method == http.MethodPut
+}
+
+// retryable reports whether a request which failed with err may succeed if
+// retried.
+func retryable(err error) bool {
+	var herr *HTTPError
+	switch {
+	case errors.As(err, &herr):
+		return herr.StatusCode >= http.StatusInternalServerError
+	case errors.Is(err, ErrTimeout), errors.Is(err, ErrUnreachable):
+		return true
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		// The connection was dropped while reading the response.
+		return true
+	default:
+		return false
+	}
+}
+
+// wait waits before the retry numbered n, starting with 1. It returns false if
+// ctx is canceled while waiting.
+func (p *RetryPolicy) wait(ctx context.Context, n int) bool {
+	d := p.MinBackoff
+	for i := 1; i < n && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+
+	if d > 0 {
+		d -= time.Duration(rand.Int63n(int64(d)/2 + 1))
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
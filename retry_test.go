@@ -0,0 +1,197 @@
+package keylight_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/keylight"
+	"github.com/mdlayher/keylight/keylighttest"
+)
+
+func TestClientRetry(t *testing.T) {
+	policy := keylight.RetryPolicy{
+		Attempts:   3,
+		MinBackoff: 1 * time.Millisecond,
+		MaxBackoff: 5 * time.Millisecond,
+	}
+
+	tests := []struct {
+		name   string
+		faults []keylighttest.Fault
+		fn     func(ctx context.Context, c *keylight.Client) error
+		ok     bool
+		left   int
+	}{
+		{
+			name: "GET recovers",
+			faults: []keylighttest.Fault{
+				{StatusCode: http.StatusInternalServerError},
+				{Reset: true},
+			},
+			fn: func(ctx context.Context, c *keylight.Client) error {
+				_, err := c.Lights(ctx)
+				return err
+			},
+			ok: true,
+		},
+		{
+			name: "PUT recovers",
+			faults: []keylighttest.Fault{
+				{Truncate: true},
+			},
+			fn: func(ctx context.Context, c *keylight.Client) error {
+				return c.SetLights(ctx, []*keylight.Light{{On: true, Brightness: 10, Temperature: 3000}})
+			},
+			ok: true,
+		},
+		{
+			name: "attempts exhausted",
+			faults: []keylighttest.Fault{
+				{StatusCode: http.StatusServiceUnavailable, Times: 4},
+			},
+			fn: func(ctx context.Context, c *keylight.Client) error {
+				_, err := c.AccessoryInfo(ctx)
+				return err
+			},
+			left: 1,
+		},
+		{
+			name: "client error not retried",
+			faults: []keylighttest.Fault{
+				{StatusCode: http.StatusBadRequest, Times: 2},
+			},
+			fn: func(ctx context.Context, c *keylight.Client) error {
+				_, err := c.AccessoryInfo(ctx)
+				return err
+			},
+			left: 1,
+		},
+		{
+			name: "identify not retried",
+			faults: []keylighttest.Fault{
+				{StatusCode: http.StatusInternalServerError},
+			},
+			fn: func(ctx context.Context, c *keylight.Client) error {
+				return c.Identify(ctx)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+			defer cancel()
+
+			d, c := testDeviceClient(t, keylight.WithRetry(policy))
+			for _, f := range tt.faults {
+				d.InjectFault(f)
+			}
+
+			err := tt.fn(ctx, c)
+			if tt.ok && err != nil {
+				t.Fatalf("failed to perform request: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("an error was expected, but none occurred")
+			}
+
+			if diff := cmp.Diff(tt.left, d.Faults()); diff != "" {
+				t.Fatalf("unexpected number of remaining faults (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestClientRetryCanceled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	d, c := testDeviceClient(t, keylight.WithRetry(keylight.RetryPolicy{
+		Attempts:   3,
+		MinBackoff: 1 * time.Second,
+	}))
+	d.InjectFault(keylighttest.Fault{StatusCode: http.StatusInternalServerError, Times: 3})
+
+	// The context expires while waiting to retry, so the original error is
+	// returned immediately.
+	start := time.Now()
+	_, err := c.Lights(ctx)
+
+	var herr *keylight.HTTPError
+	if !errors.As(err, &herr) {
+		t.Fatalf("expected HTTP error, but got: %v", err)
+	}
+
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatal("client did not stop retrying when the context expired")
+	}
+}
+
+func TestClientSerialization(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var inflight, max int32
+	d := keylighttest.NewDevice(nil)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inflight, 1)
+		defer atomic.AddInt32(&inflight, -1)
+
+		for {
+			m := atomic.LoadInt32(&max)
+			if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+				break
+			}
+		}
+
+		// Give other requests a chance to arrive concurrently.
+		time.Sleep(5 * time.Millisecond)
+		d.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	c, err := keylight.New(srv.URL, keylight.WithSerialization())
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.Lights(ctx); err != nil {
+				panicf("failed to fetch lights: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if diff := cmp.Diff(int32(1), atomic.LoadInt32(&max)); diff != "" {
+		t.Fatalf("unexpected maximum concurrent requests (-want +got):\n%s", diff)
+	}
+}
+
+// testDeviceClient creates a *keylight.Client configured with options which
+// is connected to an emulated device.
+func testDeviceClient(t *testing.T, options ...keylight.Option) (*keylighttest.Device, *keylight.Client) {
+	t.Helper()
+
+	d := keylighttest.NewDevice(nil)
+	srv := httptest.NewServer(d)
+	t.Cleanup(srv.Close)
+
+	c, err := keylight.New(srv.URL, options...)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	return d, c
+}
@@ -0,0 +1,286 @@
+package keylight
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A Scene is a named preset of light states for one or more Key Light
+// devices.
+type Scene struct {
+	// Name is the unique name of the Scene, such as "recording".
+	Name string `json:"name"`
+
+	// Lights maps the serial number of each device to the state of all of
+	// the device's lights.
+	Lights map[string][]*Light `json:"lights"`
+}
+
+// validate verifies that s is well-formed.
+func (s *Scene) validate() error {
+	if s.Name == "" {
+		return errors.New("scene name must not be empty")
+	}
+
+	for serial, lights := range s.Lights {
+		if err := validateLights(lights); err != nil {
+			return fmt.Errorf("scene %q, device %q: %w", s.Name, serial, err)
+		}
+	}
+
+	return nil
+}
+
+// CaptureScene creates a Scene named name from the current state of the
+// lights on the devices of clients.
+func CaptureScene(ctx context.Context, name string, clients []*Client) (*Scene, error) {
+	var (
+		mu sync.Mutex
+		s  = &Scene{Name: name, Lights: make(map[string][]*Light, len(clients))}
+	)
+
+	results := NewGroup(clients, nil).each(ctx, func(ctx context.Context, _ int, c *Client, r *GroupResult) {
+		d, err := c.AccessoryInfo(ctx)
+		if err != nil {
+			r.Err = err
+			return
+		}
+
+		lights, err := c.Lights(ctx)
+		if err != nil {
+			r.Err = err
+			return
+		}
+		r.Lights = lights
+
+		mu.Lock()
+		defer mu.Unlock()
+		s.Lights[d.SerialNumber] = lights
+	})
+	if err := groupError(results); err != nil {
+		return nil, err
+	}
+
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// ApplyScene applies Scene s to the devices in the Group, matching devices to
+// the Scene by serial number. Devices which are not part of the Scene are left
+// unchanged, as are devices in the Scene which are not part of the Group.
+//
+// If d is greater than zero, each device transitions to the Scene's state over
+// duration d using EasePerceptual. Scenes are applied atomically: if any
+// device fails, all devices are restored to their previous light state
+// regardless of the Group's configuration. It returns a result for each device
+// in the order of the Group's clients, and a *GroupError if any device failed.
+func (g *Group) ApplyScene(ctx context.Context, s *Scene, d time.Duration) ([]*GroupResult, error) {
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+
+	// Identify every device before changing any of them, so a device which
+	// cannot be reached leaves all devices unchanged.
+	serials := make([]string, len(g.clients))
+	results := g.each(ctx, func(ctx context.Context, i int, c *Client, r *GroupResult) {
+		info, err := c.AccessoryInfo(ctx)
+		if err != nil {
+			r.Err = err
+			return
+		}
+
+		serials[i] = info.SerialNumber
+	})
+	if err := groupError(results); err != nil {
+		return results, err
+	}
+
+	return g.update(ctx, true, func(ctx context.Context, i int, c *Client, _ []*Light) ([]*Light, error) {
+		lights, ok := s.Lights[serials[i]]
+		if !ok {
+			return nil, nil
+		}
+
+		if d <= 0 {
+			return c.ApplyLights(ctx, lights)
+		}
+
+		if err := c.Transition(ctx, lights, d, EasePerceptual); err != nil {
+			return nil, err
+		}
+
+		return c.Lights(ctx)
+	})
+}
+
+// A SceneStore persists Scenes in a JSON file. A SceneStore is safe for
+// concurrent use, but does not coordinate with other processes using the same
+// file.
+type SceneStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewSceneStore creates a SceneStore which persists Scenes in the file at
+// path. The file and its parent directories are created when the first Scene
+// is saved.
+func NewSceneStore(path string) *SceneStore {
+	return &SceneStore{path: path}
+}
+
+// A sceneFile is the JSON representation of the file used by a SceneStore.
+type sceneFile struct {
+	Scenes []*Scene `json:"scenes"`
+}
+
+// List returns all of the Scenes in the store, sorted by name.
+func (s *SceneStore) List() ([]*Scene, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.read()
+}
+
+// Get returns the Scene named name, or an error wrapping ErrSceneNotFound if
+// no such Scene exists.
+func (s *SceneStore) Get(name string) (*Scene, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scenes, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sc := range scenes {
+		if sc.Name == name {
+			return sc, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrSceneNotFound, name)
+}
+
+// Save stores Scene sc, replacing any existing Scene with the same name.
+func (s *SceneStore) Save(sc *Scene) error {
+	if err := sc.validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scenes, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	out := []*Scene{sc}
+	for _, v := range scenes {
+		if v.Name != sc.Name {
+			out = append(out, v)
+		}
+	}
+
+	return s.write(out)
+}
+
+// Delete removes the Scene named name, or returns an error wrapping
+// ErrSceneNotFound if no such Scene exists.
+func (s *SceneStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scenes, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	out := make([]*Scene, 0, len(scenes))
+	for _, v := range scenes {
+		if v.Name != name {
+			out = append(out, v)
+		}
+	}
+
+	if len(out) == len(scenes) {
+		return fmt.Errorf("%w: %q", ErrSceneNotFound, name)
+	}
+
+	return s.write(out)
+}
+
+// read reads all Scenes from the store's file. A file which does not exist
+// contains no Scenes.
+func (s *SceneStore) read() ([]*Scene, error) {
+	b, err := os.ReadFile(s.path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var f sceneFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse scene file %q: %w", s.path, err)
+	}
+
+	sort.Slice(f.Scenes, func(i, j int) bool {
+		return f.Scenes[i].Name < f.Scenes[j].Name
+	})
+
+	return f.Scenes, nil
+}
+
+// write atomically replaces the store's file with scenes.
+func (s *SceneStore) write(scenes []*Scene) error {
+	sort.Slice(scenes, func(i, j int) bool {
+		return scenes[i].Name < scenes[j].Name
+	})
+
+	b, err := json.MarshalIndent(sceneFile{Scenes: scenes}, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(s.path, append(b, '\n'))
+}
+
+// writeFileAtomic writes b to a temporary file and renames it to path, so that
+// readers never observe a partially written file.
+func writeFileAtomic(path string, b []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,215 @@
+package keylight_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/keylight"
+	"github.com/mdlayher/keylight/keylighttest"
+)
+
+func TestSceneCaptureApply(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	devices, clients := testSceneDevices(t, 3)
+
+	recording := []*keylight.Light{{On: true, Brightness: 80, Temperature: 4500}}
+	for _, c := range clients[:2] {
+		if err := c.SetLights(ctx, recording); err != nil {
+			t.Fatalf("failed to set lights: %v", err)
+		}
+	}
+
+	// Only capture the first two devices.
+	s, err := keylight.CaptureScene(ctx, "recording", clients[:2])
+	if err != nil {
+		t.Fatalf("failed to capture scene: %v", err)
+	}
+
+	if diff := cmp.Diff([]string{"SN0", "SN1"}, sceneSerials(s)); diff != "" {
+		t.Fatalf("unexpected scene devices (-want +got):\n%s", diff)
+	}
+
+	// Change the lights and then restore the scene with a transition.
+	g := keylight.NewGroup(clients, nil)
+	off := false
+	if _, err := g.Adjust(ctx, keylight.Adjustment{Brightness: -50, On: &off}); err != nil {
+		t.Fatalf("failed to adjust lights: %v", err)
+	}
+	third := devices[2].Lights()
+
+	if _, err := g.ApplyScene(ctx, s, 250*time.Millisecond); err != nil {
+		t.Fatalf("failed to apply scene: %v", err)
+	}
+
+	for i, d := range devices[:2] {
+		if diff := cmp.Diff(recording, d.Lights(), ignoreRaw); diff != "" {
+			t.Fatalf("%d: unexpected lights (-want +got):\n%s", i, diff)
+		}
+	}
+
+	// Devices which are not part of the scene are unchanged.
+	if diff := cmp.Diff(third, devices[2].Lights()); diff != "" {
+		t.Fatalf("unexpected lights on device outside scene (-want +got):\n%s", diff)
+	}
+}
+
+func TestSceneApplyRollback(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	devices, clients := testSceneDevices(t, 3)
+
+	s := &keylight.Scene{
+		Name:   "meeting",
+		Lights: make(map[string][]*keylight.Light),
+	}
+	for i := range devices {
+		s.Lights[fmt.Sprintf("SN%d", i)] = []*keylight.Light{{On: true, Brightness: 60, Temperature: 5000}}
+	}
+
+	prev := devices[0].Lights()
+	devices[1].InjectFault(keylighttest.Fault{
+		Method:     http.MethodPut,
+		StatusCode: http.StatusServiceUnavailable,
+	})
+
+	// Scenes are atomic even though the Group does not enable rollback.
+	results, err := keylight.NewGroup(clients, nil).ApplyScene(ctx, s, 0)
+
+	var gerr *keylight.GroupError
+	if !errors.As(err, &gerr) {
+		t.Fatalf("expected group error, but got: %v", err)
+	}
+
+	for i, d := range devices {
+		if diff := cmp.Diff(prev, d.Lights(), ignoreRaw); diff != "" {
+			t.Fatalf("%d: unexpected lights (-want +got):\n%s", i, diff)
+		}
+
+		// The failed device is also restored, since it may have applied the
+		// update before failing.
+		if !results[i].RolledBack {
+			t.Fatalf("%d: device was not rolled back", i)
+		}
+	}
+}
+
+func TestSceneStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keylight", "scenes.json")
+	s := keylight.NewSceneStore(path)
+
+	scenes, err := s.List()
+	if err != nil {
+		t.Fatalf("failed to list empty store: %v", err)
+	}
+	if len(scenes) != 0 {
+		t.Fatalf("expected no scenes, but got: %d", len(scenes))
+	}
+
+	evening := &keylight.Scene{
+		Name: "evening",
+		Lights: map[string][]*keylight.Light{
+			"SN0": {{On: true, Brightness: 20, Temperature: 2900, RawTemperature: 344}},
+		},
+	}
+	recording := &keylight.Scene{
+		Name: "recording",
+		Lights: map[string][]*keylight.Light{
+			"SN0": {{On: true, Brightness: 80, Temperature: 4500, RawTemperature: 265}},
+			"SN1": {{On: false, Brightness: 80, Mode: keylight.ColorModeHueSaturation, Hue: 240, Saturation: 50}},
+		},
+	}
+
+	for _, sc := range []*keylight.Scene{recording, evening, evening} {
+		if err := s.Save(sc); err != nil {
+			t.Fatalf("failed to save scene: %v", err)
+		}
+	}
+
+	// Scenes persist across stores and are sorted by name.
+	scenes, err = keylight.NewSceneStore(path).List()
+	if err != nil {
+		t.Fatalf("failed to list scenes: %v", err)
+	}
+
+	if diff := cmp.Diff([]*keylight.Scene{evening, recording}, scenes); diff != "" {
+		t.Fatalf("unexpected scenes (-want +got):\n%s", diff)
+	}
+
+	if err := s.Delete("evening"); err != nil {
+		t.Fatalf("failed to delete scene: %v", err)
+	}
+
+	if _, err := s.Get("evening"); !errors.Is(err, keylight.ErrSceneNotFound) {
+		t.Fatalf("expected scene not found, but got: %v", err)
+	}
+	if err := s.Delete("evening"); !errors.Is(err, keylight.ErrSceneNotFound) {
+		t.Fatalf("expected scene not found, but got: %v", err)
+	}
+
+	got, err := s.Get("recording")
+	if err != nil {
+		t.Fatalf("failed to get scene: %v", err)
+	}
+
+	if diff := cmp.Diff(recording, got); diff != "" {
+		t.Fatalf("unexpected scene (-want +got):\n%s", diff)
+	}
+
+	if err := s.Save(&keylight.Scene{}); err == nil {
+		t.Fatal("expected an error saving an unnamed scene, but none occurred")
+	}
+}
+
+// testSceneDevices creates n emulated devices with serial numbers SN0 through
+// SNn-1.
+func testSceneDevices(t *testing.T, n int) ([]*keylighttest.Device, []*keylight.Client) {
+	t.Helper()
+
+	var (
+		devices []*keylighttest.Device
+		clients []*keylight.Client
+	)
+
+	for i := 0; i < n; i++ {
+		d := keylighttest.NewDevice(&keylighttest.Config{
+			Device: &keylight.Device{
+				ProductName:  "Elgato Key Light",
+				SerialNumber: fmt.Sprintf("SN%d", i),
+			},
+		})
+		srv := httptest.NewServer(d)
+		t.Cleanup(srv.Close)
+
+		c, err := keylight.New(srv.URL)
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+
+		devices = append(devices, d)
+		clients = append(clients, c)
+	}
+
+	return devices, clients
+}
+
+// sceneSerials returns the serial numbers of the devices in s, in order.
+func sceneSerials(s *keylight.Scene) []string {
+	var serials []string
+	for serial := range s.Lights {
+		serials = append(serials, serial)
+	}
+	sort.Strings(serials)
+
+	return serials
+}
@@ -0,0 +1,403 @@
+// Package schedule runs time-based rules, such as "turn on at 40% and 4500K
+// at 08:55 on weekdays", against Elgato Key Light devices and groups of
+// devices.
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mdlayher/keylight"
+)
+
+// A File is the configuration file for a Scheduler, stored as JSON:
+//
+//	{
+//	  "location": "America/New_York",
+//	  "devices": {
+//	    "left": "http://keylight-1:9123",
+//	    "right": "http://keylight-2:9123"
+//	  },
+//	  "groups": {
+//	    "studio": ["left", "right"]
+//	  },
+//	  "rules": [
+//	    {"when": "weekdays 08:55", "target": "studio", "on": true, "brightness": 40, "temperature": 4500},
+//	    {"when": "every day 23:00", "target": "studio", "on": false}
+//	  ]
+//	}
+type File struct {
+	// Location is the name of the IANA time zone in which rules are
+	// evaluated. If empty, the local time zone is used.
+	Location string `json:"location,omitempty"`
+
+	// Devices maps device names to the addresses of their HTTP APIs.
+	Devices map[string]string `json:"devices"`
+
+	// Groups maps group names to the names of the devices in each group.
+	Groups map[string][]string `json:"groups,omitempty"`
+
+	// Rules are the rules run by the Scheduler.
+	Rules []*Rule `json:"rules"`
+}
+
+// A Rule applies a change to the lights of a device or group at the times
+// selected by a Spec.
+type Rule struct {
+	// Name optionally describes the Rule in logs and errors.
+	Name string `json:"name,omitempty"`
+
+	// When selects the times at which the Rule runs.
+	When Spec `json:"when"`
+
+	// Target is the name of a device or group in the File.
+	Target string `json:"target"`
+
+	// On, if set, turns all lights on or off.
+	On *bool `json:"on,omitempty"`
+
+	// Brightness and Temperature, if non-zero, set the brightness percentage
+	// and color temperature in Kelvin of all lights. Setting Temperature
+	// switches color-capable lights to keylight.ColorModeTemperature.
+	Brightness  int `json:"brightness,omitempty"`
+	Temperature int `json:"temperature,omitempty"`
+}
+
+// String returns a description of the Rule.
+func (r *Rule) String() string {
+	if r.Name != "" {
+		return fmt.Sprintf("rule %q", r.Name)
+	}
+
+	return fmt.Sprintf("rule %q for %q", r.When, r.Target)
+}
+
+// validate verifies that r is well-formed.
+func (r *Rule) validate() error {
+	if r.When == (Spec{}) {
+		return fmt.Errorf("%s: time specification must not be empty", r)
+	}
+	if r.Target == "" {
+		return fmt.Errorf("%s: target must not be empty", r)
+	}
+	if r.On == nil && r.Brightness == 0 && r.Temperature == 0 {
+		return fmt.Errorf("%s: no changes to lights", r)
+	}
+	if b := r.Brightness; b != 0 && (b < keylight.BrightnessMin || b > keylight.BrightnessMax) {
+		return fmt.Errorf("%s: %w", r, &keylight.RangeError{
+			Field: "brightness",
+			Value: float64(b),
+			Min:   keylight.BrightnessMin,
+			Max:   keylight.BrightnessMax,
+		})
+	}
+	if t := r.Temperature; t != 0 && (t < keylight.TemperatureMin || t > keylight.TemperatureMax) {
+		return fmt.Errorf("%s: %w", r, &keylight.RangeError{
+			Field: "temperature",
+			Value: float64(t),
+			Min:   keylight.TemperatureMin,
+			Max:   keylight.TemperatureMax,
+		})
+	}
+
+	return nil
+}
+
+// update returns the partial update applied by the Rule to each light.
+func (r *Rule) update() *keylight.LightUpdate {
+	u := &keylight.LightUpdate{On: r.On}
+	if r.Brightness != 0 {
+		u.Brightness = &r.Brightness
+	}
+	if r.Temperature != 0 {
+		u.Temperature = &r.Temperature
+	}
+
+	return u
+}
+
+// Load reads and validates a File from the file at path.
+func Load(path string) (*File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Parse(f)
+}
+
+// Parse reads and validates a File from r.
+func Parse(r io.Reader) (*File, error) {
+	var f File
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return nil, err
+	}
+
+	if err := f.validate(); err != nil {
+		return nil, err
+	}
+
+	return &f, nil
+}
+
+// validate verifies that f is well-formed.
+func (f *File) validate() error {
+	if _, err := f.location(); err != nil {
+		return err
+	}
+
+	for name, devices := range f.Groups {
+		if _, ok := f.Devices[name]; ok {
+			return fmt.Errorf("group %q has the same name as a device", name)
+		}
+		if len(devices) == 0 {
+			return fmt.Errorf("group %q must contain at least one device", name)
+		}
+
+		for _, d := range devices {
+			if _, ok := f.Devices[d]; !ok {
+				return fmt.Errorf("group %q contains unknown device %q", name, d)
+			}
+		}
+	}
+
+	for _, r := range f.Rules {
+		if err := r.validate(); err != nil {
+			return err
+		}
+
+		_, device := f.Devices[r.Target]
+		_, group := f.Groups[r.Target]
+		if !device && !group {
+			return fmt.Errorf("%s: unknown target %q", r, r.Target)
+		}
+	}
+
+	return nil
+}
+
+// location returns the time zone for f.
+func (f *File) location() (*time.Location, error) {
+	if f.Location == "" {
+		return time.Local, nil
+	}
+
+	return time.LoadLocation(f.Location)
+}
+
+// A Config configures a Scheduler.
+type Config struct {
+	// Interval is the interval at which rules are evaluated. If zero, 30
+	// seconds is used.
+	Interval time.Duration
+
+	// CatchUp is how late a Rule may run after its scheduled time, such as
+	// when the system resumes after sleeping through it. A Rule which was
+	// missed by more than CatchUp is skipped until its next occurrence. If
+	// zero, one hour is used. CatchUp is never less than Interval.
+	CatchUp time.Duration
+
+	// Now, if set, returns the current time. If nil, time.Now is used.
+	Now func() time.Time
+
+	// Options are applied to the keylight.Client for each device.
+	Options []keylight.Option
+
+	// Logger, if set, logs the result of each Rule run by Run.
+	Logger *slog.Logger
+}
+
+// A Firing is the result of running a Rule.
+type Firing struct {
+	// Rule is the Rule which ran, and Time is the time at which it was
+	// scheduled to run.
+	Rule *Rule
+	Time time.Time
+
+	// Err is the error which occurred while running the Rule, if any. Errors
+	// from devices are reported as a *keylight.GroupError.
+	Err error
+}
+
+// A Scheduler runs the rules of a File at their scheduled times.
+//
+// When a Scheduler is evaluated after a delay, such as after the system
+// resumes from sleep, each Rule which was missed runs once for its most
+// recent occurrence, in the order they were scheduled, unless it is later
+// than the configured CatchUp duration.
+type Scheduler struct {
+	rules   []*Rule
+	targets map[string][]*keylight.Client
+	loc     *time.Location
+	every   time.Duration
+	catchUp time.Duration
+	now     func() time.Time
+	ll      *slog.Logger
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+// New creates a Scheduler which runs the rules of f, as configured by cfg.
+// Rules are evaluated from the time New is called, so occurrences before then
+// do not run.
+func New(f *File, cfg Config) (*Scheduler, error) {
+	if err := f.validate(); err != nil {
+		return nil, err
+	}
+
+	loc, err := f.location()
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Interval <= 0 {
+		cfg.Interval = 30 * time.Second
+	}
+	if cfg.CatchUp <= 0 {
+		cfg.CatchUp = time.Hour
+	}
+	if cfg.CatchUp < cfg.Interval {
+		cfg.CatchUp = cfg.Interval
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+
+	devices := make(map[string]*keylight.Client, len(f.Devices))
+	for name, addr := range f.Devices {
+		c, err := keylight.New(addr, cfg.Options...)
+		if err != nil {
+			return nil, fmt.Errorf("device %q: %w", name, err)
+		}
+
+		devices[name] = c
+	}
+
+	targets := make(map[string][]*keylight.Client, len(f.Devices)+len(f.Groups))
+	for name, c := range devices {
+		targets[name] = []*keylight.Client{c}
+	}
+	for name, group := range f.Groups {
+		for _, d := range group {
+			targets[name] = append(targets[name], devices[d])
+		}
+	}
+
+	s := &Scheduler{
+		rules:   f.Rules,
+		targets: targets,
+		loc:     loc,
+		every:   cfg.Interval,
+		catchUp: cfg.CatchUp,
+		now:     cfg.Now,
+		ll:      cfg.Logger,
+	}
+	s.last = s.clock()
+
+	return s, nil
+}
+
+// Run evaluates the rules at each interval until ctx is canceled, at which
+// point it returns ctx.Err().
+func (s *Scheduler) Run(ctx context.Context) error {
+	t := time.NewTicker(s.every)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		for _, f := range s.Tick(ctx) {
+			if s.ll == nil {
+				continue
+			}
+
+			if f.Err != nil {
+				s.ll.Warn("failed to run rule", slog.String("rule", f.Rule.String()),
+					slog.Time("scheduled", f.Time), slog.String("error", f.Err.Error()))
+				continue
+			}
+
+			s.ll.Info("ran rule", slog.String("rule", f.Rule.String()), slog.Time("scheduled", f.Time))
+		}
+	}
+}
+
+// Tick runs each Rule which was scheduled since the previous Tick, or since
+// the Scheduler was created, and returns the results in the order the rules
+// were scheduled.
+func (s *Scheduler) Tick(ctx context.Context) []*Firing {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock()
+	last := s.last
+	s.last = now
+
+	var due []*Firing
+	for _, r := range s.rules {
+		at := r.When.Prev(now)
+		if at.IsZero() || !at.After(last) || now.Sub(at) > s.catchUp {
+			continue
+		}
+
+		due = append(due, &Firing{Rule: r, Time: at})
+	}
+
+	// Run in the order scheduled so the most recent Rule takes effect, and
+	// in the order of the File for rules scheduled at the same time.
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].Time.Before(due[j].Time)
+	})
+
+	for _, f := range due {
+		f.Err = s.run(ctx, f.Rule)
+	}
+
+	return due
+}
+
+// Next returns the next Rule scheduled after the current time and the time it
+// is scheduled to run, or false if there are no rules.
+func (s *Scheduler) Next() (*Rule, time.Time, bool) {
+	now := s.clock()
+
+	var (
+		next *Rule
+		at   time.Time
+	)
+	for _, r := range s.rules {
+		t := r.When.Next(now)
+		if next == nil || t.Before(at) {
+			next, at = r, t
+		}
+	}
+
+	return next, at, next != nil
+}
+
+// run applies r to each device of its target concurrently.
+func (s *Scheduler) run(ctx context.Context, r *Rule) error {
+	_, err := keylight.NewGroup(s.targets[r.Target], nil).UpdateLights(ctx, r.update())
+	return err
+}
+
+// clock returns the current time in the Scheduler's location.
+func (s *Scheduler) clock() time.Time {
+	// Strip the monotonic clock reading, which does not advance while the
+	// system is suspended, so that time spent asleep is counted when
+	// comparing against the previous evaluation.
+	return s.now().Round(0).In(s.loc)
+}
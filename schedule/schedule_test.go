@@ -0,0 +1,327 @@
+package schedule_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/keylight"
+	"github.com/mdlayher/keylight/keylighttest"
+	"github.com/mdlayher/keylight/schedule"
+)
+
+func TestSchedulerTick(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	left, right := testDevice(t), testDevice(t)
+
+	f, err := schedule.Parse(strings.NewReader(fmt.Sprintf(`{
+		"location": "UTC",
+		"devices": {"left": %q, "right": %q},
+		"groups": {"studio": ["left", "right"]},
+		"rules": [
+			{"name": "morning", "when": "weekdays 08:55", "target": "studio", "on": true, "brightness": 40, "temperature": 4500},
+			{"name": "night", "when": "every day 23:00", "target": "studio", "on": false},
+			{"name": "dim", "when": "every day 23:00", "target": "left", "brightness": 10}
+		]
+	}`, left.url, right.url)))
+	if err != nil {
+		t.Fatalf("failed to parse schedule: %v", err)
+	}
+
+	// Monday.
+	clock := &fakeClock{now: time.Date(2024, time.June, 3, 8, 0, 0, 0, time.UTC)}
+	s, err := schedule.New(f, schedule.Config{Now: clock.Now})
+	if err != nil {
+		t.Fatalf("failed to create scheduler: %v", err)
+	}
+
+	if r, at, ok := s.Next(); !ok || r.Name != "morning" || !at.Equal(time.Date(2024, time.June, 3, 8, 55, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected next rule: %v at %s", r, at)
+	}
+
+	tick := func(advance time.Duration, want ...string) {
+		t.Helper()
+
+		clock.Advance(advance)
+
+		var got []string
+		for _, f := range s.Tick(ctx) {
+			if f.Err != nil {
+				t.Fatalf("failed to run %s: %v", f.Rule, f.Err)
+			}
+			got = append(got, f.Rule.Name)
+		}
+
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("unexpected rules at %s (-want +got):\n%s", clock.Now(), diff)
+		}
+	}
+
+	lights := func(d *testDeviceServer, want keylight.Light) {
+		t.Helper()
+
+		got := *d.d.Lights()[0]
+		got.RawTemperature = 0
+
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("unexpected lights (-want +got):\n%s", diff)
+		}
+	}
+
+	tick(30 * time.Second)
+	tick(55*time.Minute+5*time.Second, "morning")
+	lights(left, keylight.Light{On: true, Brightness: 40, Temperature: 4500})
+	lights(right, keylight.Light{On: true, Brightness: 40, Temperature: 4500})
+
+	// Rules at the same time run in the order of the file.
+	tick(14*time.Hour+4*time.Minute+30*time.Second, "night", "dim")
+	lights(left, keylight.Light{Brightness: 10, Temperature: 4500})
+	lights(right, keylight.Light{Brightness: 40, Temperature: 4500})
+
+	// The system sleeps until Tuesday 09:30, so the missed morning rule is
+	// caught up.
+	tick(10*time.Hour+29*time.Minute+55*time.Second, "morning")
+	lights(left, keylight.Light{On: true, Brightness: 40, Temperature: 4500})
+	tick(time.Minute)
+}
+
+func TestSchedulerCatchUp(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	d := testDevice(t)
+
+	f := &schedule.File{
+		Location: "UTC",
+		Devices:  map[string]string{"desk": d.url},
+		Rules: []*schedule.Rule{
+			{Name: "morning", When: mustSpec(t, "weekdays 08:55"), Target: "desk", On: boolp(true), Brightness: 40},
+			{Name: "night", When: mustSpec(t, "every day 23:00"), Target: "desk", On: boolp(false)},
+		},
+	}
+
+	// Friday evening.
+	clock := &fakeClock{now: time.Date(2024, time.June, 7, 22, 0, 0, 0, time.UTC)}
+	s, err := schedule.New(f, schedule.Config{Now: clock.Now})
+	if err != nil {
+		t.Fatalf("failed to create scheduler: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		advance time.Duration
+		want    []string
+	}{
+		{
+			// Sleeps through the night rule, then resumes within the catch up
+			// duration.
+			name:    "resume",
+			advance: 1*time.Hour + 30*time.Minute,
+			want:    []string{"night"},
+		},
+		{
+			// Sleeps for the weekend and resumes Monday 09:30: the night
+			// rules are too late, but morning is caught up, once.
+			name:    "weekend",
+			advance: 58 * time.Hour,
+			want:    []string{"morning"},
+		},
+		{
+			// Sleeps through all of Tuesday and resumes 23:10, so only the
+			// most recent night rule runs.
+			name:    "days",
+			advance: 37*time.Hour + 40*time.Minute,
+			want:    []string{"night"},
+		},
+	}
+
+	for _, tt := range tests {
+		clock.Advance(tt.advance)
+
+		var got []string
+		for _, f := range s.Tick(ctx) {
+			if f.Err != nil {
+				t.Fatalf("%s: failed to run %s: %v", tt.name, f.Rule, f.Err)
+			}
+			got = append(got, f.Rule.Name)
+		}
+
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Fatalf("%s: unexpected rules (-want +got):\n%s", tt.name, diff)
+		}
+	}
+}
+
+func TestSchedulerTickError(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ok, bad := testDevice(t), testDevice(t)
+	bad.d.InjectFault(keylighttest.Fault{
+		Method:     http.MethodPut,
+		Path:       "/elgato/lights",
+		StatusCode: http.StatusInternalServerError,
+	})
+
+	f := &schedule.File{
+		Location: "UTC",
+		Devices:  map[string]string{"ok": ok.url, "bad": bad.url},
+		Groups:   map[string][]string{"all": {"ok", "bad"}},
+		Rules: []*schedule.Rule{
+			{When: mustSpec(t, "12:00"), Target: "all", On: boolp(true)},
+		},
+	}
+
+	clock := &fakeClock{now: time.Date(2024, time.June, 3, 11, 59, 50, 0, time.UTC)}
+	s, err := schedule.New(f, schedule.Config{Now: clock.Now})
+	if err != nil {
+		t.Fatalf("failed to create scheduler: %v", err)
+	}
+
+	clock.Advance(time.Minute)
+	firings := s.Tick(ctx)
+	if len(firings) != 1 || firings[0].Err == nil {
+		t.Fatalf("expected one failed rule, but got: %v", firings)
+	}
+
+	var herr *keylight.HTTPError
+	if !errors.As(firings[0].Err, &herr) || !strings.Contains(firings[0].Err.Error(), bad.url) {
+		t.Fatalf("unexpected error: %v", firings[0].Err)
+	}
+
+	if !ok.d.Lights()[0].On {
+		t.Fatal("light of working device was not turned on")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name, in, err string
+
+		// field, if set, is the field of the expected *keylight.RangeError.
+		field string
+	}{
+		{
+			name: "bad spec",
+			in:   `{"rules": [{"when": "someday 12:00"}]}`,
+			err:  `invalid day "someday" in "someday 12:00"`,
+		},
+		{
+			name: "location",
+			in:   `{"location": "Nowhere/Special"}`,
+			err:  "unknown time zone Nowhere/Special",
+		},
+		{
+			name: "unknown group device",
+			in:   `{"devices": {"a": "http://a"}, "groups": {"g": ["a", "b"]}}`,
+			err:  `group "g" contains unknown device "b"`,
+		},
+		{
+			name: "group shadows device",
+			in:   `{"devices": {"a": "http://a"}, "groups": {"a": ["a"]}}`,
+			err:  `group "a" has the same name as a device`,
+		},
+		{
+			name: "no when",
+			in:   `{"devices": {"a": "http://a"}, "rules": [{"name": "r", "target": "a", "on": true}]}`,
+			err:  `rule "r": time specification must not be empty`,
+		},
+		{
+			name: "unknown target",
+			in:   `{"devices": {"a": "http://a"}, "rules": [{"when": "12:00", "target": "b", "on": true}]}`,
+			err:  `rule "every day 12:00" for "b": unknown target "b"`,
+		},
+		{
+			name: "no changes",
+			in:   `{"devices": {"a": "http://a"}, "rules": [{"name": "r", "when": "12:00", "target": "a"}]}`,
+			err:  `rule "r": no changes to lights`,
+		},
+		{
+			name:  "brightness",
+			in:    `{"devices": {"a": "http://a"}, "rules": [{"name": "r", "when": "12:00", "target": "a", "brightness": 101}]}`,
+			err:   `rule "r": brightness (101) out of range 3 <= x <= 100`,
+			field: "brightness",
+		},
+		{
+			name:  "temperature",
+			in:    `{"devices": {"a": "http://a"}, "rules": [{"name": "r", "when": "12:00", "target": "a", "temperature": 2000}]}`,
+			err:   `rule "r": temperature (2000) out of range 2900 <= x <= 7000`,
+			field: "temperature",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := schedule.Parse(strings.NewReader(tt.in))
+			if err == nil {
+				t.Fatal("an error was expected, but none occurred")
+			}
+
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var rerr *keylight.RangeError
+			if tt.field != "" && (!errors.As(err, &rerr) || rerr.Field != tt.field) {
+				t.Fatalf("expected %s range error, but got: %v", tt.field, err)
+			}
+		})
+	}
+}
+
+type testDeviceServer struct {
+	d   *keylighttest.Device
+	url string
+}
+
+func testDevice(t *testing.T) *testDeviceServer {
+	t.Helper()
+
+	d := keylighttest.NewDevice(nil)
+	srv := httptest.NewServer(d)
+	t.Cleanup(srv.Close)
+
+	return &testDeviceServer{d: d, url: srv.URL}
+}
+
+func mustSpec(t *testing.T, s string) schedule.Spec {
+	t.Helper()
+
+	sp, err := schedule.ParseSpec(s)
+	if err != nil {
+		t.Fatalf("failed to parse spec: %v", err)
+	}
+
+	return sp
+}
+
+func boolp(b bool) *bool { return &b }
+
+// A fakeClock is a manually advanced clock.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
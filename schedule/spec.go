@@ -0,0 +1,221 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Spec is a recurring wall clock time on selected days of the week, such as
+// "weekdays 08:55" or "every day 23:00".
+//
+// A Spec is parsed from a list of days followed by a time of day in 24-hour
+// HH:MM format. Days may be "every day" or "daily", "weekdays", "weekends", or
+// a comma-separated list of three-letter day names and ranges such as
+// "mon,wed,fri" or "mon-thu,sat". If the days are omitted, the Spec occurs
+// every day.
+type Spec struct {
+	days         [7]bool
+	hour, minute int
+}
+
+// Day names indexed by time.Weekday.
+var dayNames = [7]string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// ParseSpec parses a Spec from s.
+func ParseSpec(s string) (Spec, error) {
+	fields := strings.Fields(strings.ToLower(s))
+	if len(fields) == 0 {
+		return Spec{}, errors.New("empty time specification")
+	}
+
+	var sp Spec
+
+	clock := fields[len(fields)-1]
+	hh, mm, ok := strings.Cut(clock, ":")
+	if !ok || len(hh) == 0 || len(hh) > 2 || len(mm) != 2 {
+		return Spec{}, fmt.Errorf("invalid time of day %q in %q, expected HH:MM", clock, s)
+	}
+
+	var err error
+	if sp.hour, err = strconv.Atoi(hh); err != nil || sp.hour < 0 || sp.hour > 23 {
+		return Spec{}, fmt.Errorf("invalid hour %q in %q", hh, s)
+	}
+	if sp.minute, err = strconv.Atoi(mm); err != nil || sp.minute < 0 || sp.minute > 59 {
+		return Spec{}, fmt.Errorf("invalid minute %q in %q", mm, s)
+	}
+
+	switch days := strings.Join(fields[:len(fields)-1], " "); days {
+	case "", "every day", "daily":
+		for i := range sp.days {
+			sp.days[i] = true
+		}
+	case "weekdays":
+		for i := time.Monday; i <= time.Friday; i++ {
+			sp.days[i] = true
+		}
+	case "weekends":
+		sp.days[time.Saturday], sp.days[time.Sunday] = true, true
+	default:
+		for _, r := range strings.Split(days, ",") {
+			first, last, isRange := strings.Cut(r, "-")
+
+			start, ok := parseDay(first)
+			if !ok {
+				return Spec{}, fmt.Errorf("invalid day %q in %q", first, s)
+			}
+
+			end := start
+			if isRange {
+				if end, ok = parseDay(last); !ok {
+					return Spec{}, fmt.Errorf("invalid day %q in %q", last, s)
+				}
+			}
+
+			// Ranges may wrap around the end of the week, as in "fri-mon".
+			for d := start; ; d = (d + 1) % 7 {
+				sp.days[d] = true
+				if d == end {
+					break
+				}
+			}
+		}
+	}
+
+	return sp, nil
+}
+
+// parseDay parses a three-letter day name.
+func parseDay(s string) (time.Weekday, bool) {
+	for i, d := range dayNames {
+		if s == d {
+			return time.Weekday(i), true
+		}
+	}
+
+	return 0, false
+}
+
+// String returns the canonical form of the Spec.
+func (sp Spec) String() string {
+	var days string
+	switch sp.days {
+	case [7]bool{true, true, true, true, true, true, true}:
+		days = "every day"
+	case [7]bool{false, true, true, true, true, true, false}:
+		days = "weekdays"
+	case [7]bool{true, false, false, false, false, false, true}:
+		days = "weekends"
+	default:
+		var ss []string
+		for i := time.Monday; i <= time.Saturday+1; i++ {
+			if d := i % 7; sp.days[d] {
+				ss = append(ss, dayNames[d])
+			}
+		}
+		days = strings.Join(ss, ",")
+	}
+
+	return fmt.Sprintf("%s %02d:%02d", days, sp.hour, sp.minute)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (sp Spec) MarshalText() ([]byte, error) {
+	return []byte(sp.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (sp *Spec) UnmarshalText(b []byte) error {
+	v, err := ParseSpec(string(b))
+	if err != nil {
+		return err
+	}
+
+	*sp = v
+	return nil
+}
+
+// Prev returns the most recent occurrence of the Spec at or before t, in t's
+// location.
+func (sp Spec) Prev(t time.Time) time.Time {
+	y, m, d := t.Date()
+
+	// A week and a day covers every possible weekday, plus an occurrence later
+	// in the day of t which has not happened yet.
+	for i := 0; i <= 7; i++ {
+		date := time.Date(y, m, d-i, 0, 0, 0, 0, t.Location())
+		if !sp.days[date.Weekday()] {
+			continue
+		}
+
+		if at := sp.on(date); !at.After(t) {
+			return at
+		}
+	}
+
+	// Unreachable for a Spec created by ParseSpec, which selects at least one
+	// day.
+	return time.Time{}
+}
+
+// Next returns the first occurrence of the Spec after t, in t's location.
+func (sp Spec) Next(t time.Time) time.Time {
+	y, m, d := t.Date()
+
+	for i := 0; i <= 7; i++ {
+		date := time.Date(y, m, d+i, 0, 0, 0, 0, t.Location())
+		if !sp.days[date.Weekday()] {
+			continue
+		}
+
+		if at := sp.on(date); at.After(t) {
+			return at
+		}
+	}
+
+	return time.Time{}
+}
+
+// on returns the instant at which the Spec's wall clock time occurs on the
+// calendar date of midnight.
+//
+// Daylight saving time transitions are handled explicitly rather than relying
+// on the normalization of time.Date, which is unspecified for such times. When
+// the clocks go back and the wall clock time occurs twice, the earlier instant
+// is used so the Spec occurs once. When the clocks go forward and the wall
+// clock time is skipped, the time is interpreted using the offset in effect
+// before the transition, so "02:30" occurs at 03:30 when clocks go forward from
+// 02:00 to 03:00.
+func (sp Spec) on(midnight time.Time) time.Time {
+	y, m, d := midnight.Date()
+	loc := midnight.Location()
+
+	// Assume at most one transition per day, so the offsets at the start and
+	// end of the day are the only ones in effect on that date.
+	_, before := midnight.Zone()
+	_, after := time.Date(y, m, d+1, 0, 0, 0, 0, loc).Zone()
+
+	utc := time.Date(y, m, d, sp.hour, sp.minute, 0, 0, time.UTC)
+
+	var at time.Time
+	for _, off := range []int{before, after} {
+		t := utc.Add(-time.Duration(off) * time.Second).In(loc)
+		if t.Hour() != sp.hour || t.Minute() != sp.minute {
+			// This offset is not in effect at this wall clock time.
+			continue
+		}
+
+		if at.IsZero() || t.Before(at) {
+			at = t
+		}
+	}
+
+	if at.IsZero() {
+		// The wall clock time was skipped.
+		at = utc.Add(-time.Duration(before) * time.Second).In(loc)
+	}
+
+	return at
+}
@@ -0,0 +1,134 @@
+package schedule_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/keylight/schedule"
+)
+
+func TestParseSpec(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+		ok             bool
+	}{
+		{name: "every day", in: "every day 23:00", want: "every day 23:00", ok: true},
+		{name: "daily", in: "Daily 7:05", want: "every day 07:05", ok: true},
+		{name: "time only", in: "06:30", want: "every day 06:30", ok: true},
+		{name: "weekdays", in: "weekdays 08:55", want: "weekdays 08:55", ok: true},
+		{name: "weekends", in: "weekends 10:00", want: "weekends 10:00", ok: true},
+		{name: "weekdays as range", in: "mon-fri 08:55", want: "weekdays 08:55", ok: true},
+		{name: "list", in: "mon,wed,fri 12:00", want: "mon,wed,fri 12:00", ok: true},
+		{name: "wrapping range", in: "fri-mon 00:00", want: "mon,fri,sat,sun 00:00", ok: true},
+		{name: "empty", in: ""},
+		{name: "no time", in: "weekdays"},
+		{name: "bad hour", in: "24:00"},
+		{name: "bad minute", in: "12:60"},
+		{name: "short minute", in: "12:5"},
+		{name: "bad day", in: "someday 12:00"},
+		{name: "bad range", in: "mon-xyz 12:00"},
+		{name: "empty day", in: "mon,,fri 12:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sp, err := schedule.ParseSpec(tt.in)
+			if tt.ok && err != nil {
+				t.Fatalf("failed to parse: %v", err)
+			}
+			if !tt.ok {
+				if err == nil {
+					t.Fatal("expected an error, but none occurred")
+				}
+				return
+			}
+
+			if diff := cmp.Diff(tt.want, sp.String()); diff != "" {
+				t.Fatalf("unexpected spec (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSpecDaylightSaving(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("skipping, failed to load time zone: %v", err)
+	}
+
+	sp, err := schedule.ParseSpec("every day 01:30")
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+
+	skipped, err := schedule.ParseSpec("every day 02:30")
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+
+	utc := func(h, m int, d int, month time.Month) time.Time {
+		return time.Date(2024, month, d, h, m, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name     string
+		spec     schedule.Spec
+		next     bool
+		at, want time.Time
+	}{
+		{
+			// 02:30 does not exist on the day clocks go forward, so it runs
+			// an hour later at 03:30 EDT.
+			name: "spring forward skipped",
+			spec: skipped,
+			next: true,
+			at:   time.Date(2024, time.March, 10, 0, 0, 0, 0, loc),
+			want: utc(7, 30, 10, time.March),
+		},
+		{
+			name: "spring forward prev",
+			spec: skipped,
+			at:   time.Date(2024, time.March, 10, 12, 0, 0, 0, loc),
+			want: utc(7, 30, 10, time.March),
+		},
+		{
+			// 01:30 occurs twice on the day clocks go back, and runs at the
+			// first, which is 01:30 EDT.
+			name: "fall back first",
+			spec: sp,
+			next: true,
+			at:   time.Date(2024, time.November, 3, 0, 0, 0, 0, loc),
+			want: utc(5, 30, 3, time.November),
+		},
+		{
+			// It does not run again at 01:30 EST.
+			name: "fall back once",
+			spec: sp,
+			next: true,
+			at:   utc(5, 30, 3, time.November).In(loc),
+			want: utc(6, 30, 4, time.November),
+		},
+		{
+			name: "fall back prev",
+			spec: sp,
+			at:   utc(6, 45, 3, time.November).In(loc),
+			want: utc(5, 30, 3, time.November),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got time.Time
+			if tt.next {
+				got = tt.spec.Next(tt.at)
+			} else {
+				got = tt.spec.Prev(tt.at)
+			}
+
+			if !got.Equal(tt.want) {
+				t.Fatalf("unexpected time: want %s, got %s", tt.want.In(loc), got)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package keylight
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+var (
+	_ json.Marshaler   = &LightSettings{}
+	_ json.Unmarshaler = &LightSettings{}
+)
+
+// PowerOnBehavior determines the state of a Key Light's lights when the device
+// is powered on.
+type PowerOnBehavior int
+
+// Possible PowerOnBehavior values for use in LightSettings.
+const (
+	// PowerOnRestore restores the light state from before the device lost
+	// power.
+	PowerOnRestore PowerOnBehavior = 1
+
+	// PowerOnDefaults applies the PowerOnBrightness and PowerOnTemperature
+	// values from LightSettings.
+	PowerOnDefaults PowerOnBehavior = 2
+)
+
+// LightSettings are the persistent light settings of a Key Light device.
+type LightSettings struct {
+	// PowerOnBehavior determines the state of the lights when the device is
+	// powered on.
+	PowerOnBehavior PowerOnBehavior
+
+	// PowerOnBrightness is the brightness applied when PowerOnBehavior is
+	// PowerOnDefaults, with a valid range of 3-100.
+	PowerOnBrightness int
+
+	// PowerOnTemperature is the color temperature applied when PowerOnBehavior
+	// is PowerOnDefaults, with a valid range of 2900-7000K.
+	PowerOnTemperature int
+
+	// PowerOnRawTemperature is the power on color temperature in native
+	// Elgato API units with a valid range of 143-344, as reported by the
+	// device. Like Light.RawTemperature, it is sent to the device in place of
+	// PowerOnTemperature whenever it still converts to PowerOnTemperature, so
+	// that settings which are read and written back without modification are
+	// unchanged. If PowerOnTemperature is zero, PowerOnRawTemperature alone
+	// sets the power on color temperature.
+	PowerOnRawTemperature int
+
+	// SwitchOnDuration and SwitchOffDuration are the fade durations used when
+	// the lights are turned on and off. ColorChangeDuration is the fade
+	// duration used when brightness or temperature changes. All durations
+	// have millisecond precision and must not be negative.
+	SwitchOnDuration    time.Duration
+	SwitchOffDuration   time.Duration
+	ColorChangeDuration time.Duration
+}
+
+// A jsonLightSettings is the raw JSON representation of LightSettings.
+type jsonLightSettings struct {
+	PowerOnBehavior       int `json:"powerOnBehavior"`
+	PowerOnBrightness     int `json:"powerOnBrightness"`
+	PowerOnTemperature    int `json:"powerOnTemperature"`
+	SwitchOnDurationMs    int `json:"switchOnDurationMs"`
+	SwitchOffDurationMs   int `json:"switchOffDurationMs"`
+	ColorChangeDurationMs int `json:"colorChangeDurationMs"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s *LightSettings) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonLightSettings{
+		PowerOnBehavior:   int(s.PowerOnBehavior),
+		PowerOnBrightness: s.PowerOnBrightness,
+		// The API has its own format but Kelvin is more friendly for users.
+		PowerOnTemperature:    s.powerOnRawTemperature(),
+		SwitchOnDurationMs:    int(s.SwitchOnDuration.Milliseconds()),
+		SwitchOffDurationMs:   int(s.SwitchOffDuration.Milliseconds()),
+		ColorChangeDurationMs: int(s.ColorChangeDuration.Milliseconds()),
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *LightSettings) UnmarshalJSON(b []byte) error {
+	var js jsonLightSettings
+	if err := json.Unmarshal(b, &js); err != nil {
+		return err
+	}
+
+	*s = LightSettings{
+		PowerOnBehavior:   PowerOnBehavior(js.PowerOnBehavior),
+		PowerOnBrightness: js.PowerOnBrightness,
+		// The API has its own format but Kelvin is more friendly for users.
+		// Keep the raw value as well so it can be written back exactly.
+		PowerOnTemperature:    RawToKelvin(js.PowerOnTemperature),
+		PowerOnRawTemperature: js.PowerOnTemperature,
+		SwitchOnDuration:      time.Duration(js.SwitchOnDurationMs) * time.Millisecond,
+		SwitchOffDuration:     time.Duration(js.SwitchOffDurationMs) * time.Millisecond,
+		ColorChangeDuration:   time.Duration(js.ColorChangeDurationMs) * time.Millisecond,
+	}
+
+	return nil
+}
+
+// powerOnRawTemperature returns the power on color temperature in API units,
+// preferring PowerOnRawTemperature when it is consistent with
+// PowerOnTemperature.
+func (s *LightSettings) powerOnRawTemperature() int {
+	return preferRaw(s.PowerOnRawTemperature, s.PowerOnTemperature)
+}
+
+// Settings retrieves the persistent light settings from a Key Light device.
+func (c *Client) Settings(ctx context.Context) (*LightSettings, error) {
+	var s LightSettings
+	if err := c.do(ctx, http.MethodGet, "/elgato/lights/settings", nil, &s); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// SetSettings updates the persistent light settings of a Key Light device.
+func (c *Client) SetSettings(ctx context.Context, s *LightSettings) error {
+	switch s.PowerOnBehavior {
+	case PowerOnRestore, PowerOnDefaults:
+	default:
+		return fmt.Errorf("power on behavior (%d) is invalid", s.PowerOnBehavior)
+	}
+
+	if s.PowerOnTemperature == 0 && s.PowerOnRawTemperature != 0 {
+		if err := checkRange("power on raw temperature", s.PowerOnRawTemperature, RawTemperatureMin, RawTemperatureMax); err != nil {
+			return err
+		}
+	} else if err := checkRange("power on temperature", s.PowerOnTemperature, TemperatureMin, TemperatureMax); err != nil {
+		return err
+	}
+
+	if err := checkRange("power on brightness", s.PowerOnBrightness, BrightnessMin, BrightnessMax); err != nil {
+		return err
+	}
+
+	for _, d := range []struct {
+		name string
+		d    time.Duration
+	}{
+		{name: "switch on duration", d: s.SwitchOnDuration},
+		{name: "switch off duration", d: s.SwitchOffDuration},
+		{name: "color change duration", d: s.ColorChangeDuration},
+	} {
+		if d.d < 0 {
+			return fmt.Errorf("%s (%s) must not be negative", d.name, d.d)
+		}
+	}
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	return c.do(ctx, http.MethodPut, "/elgato/lights/settings", b, nil)
+}
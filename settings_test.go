@@ -0,0 +1,183 @@
+package keylight_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/keylight"
+)
+
+func TestClientSettings(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if diff := cmp.Diff(http.MethodGet, r.Method); diff != "" {
+			panicf("unexpected HTTP method (-want +got):\n%s", diff)
+		}
+
+		if diff := cmp.Diff("/elgato/lights/settings", r.URL.Path); diff != "" {
+			panicf("unexpected URL path (-want +got):\n%s", diff)
+		}
+
+		// Raw output from a Key Light device.
+		_, _ = io.WriteString(w, `{"powerOnBehavior":1,"powerOnBrightness":20,"powerOnTemperature":213,"switchOnDurationMs":100,"switchOffDurationMs":300,"colorChangeDurationMs":100}`)
+	})
+
+	got, err := c.Settings(ctx)
+	if err != nil {
+		t.Fatalf("failed to fetch settings: %v", err)
+	}
+
+	want := &keylight.LightSettings{
+		PowerOnBehavior:       keylight.PowerOnRestore,
+		PowerOnBrightness:     20,
+		PowerOnTemperature:    5550,
+		PowerOnRawTemperature: 213,
+		SwitchOnDuration:      100 * time.Millisecond,
+		SwitchOffDuration:     300 * time.Millisecond,
+		ColorChangeDuration:   100 * time.Millisecond,
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected settings (-want +got):\n%s", diff)
+	}
+}
+
+func TestClientSetSettings(t *testing.T) {
+	settings := func(fn func(s *keylight.LightSettings)) *keylight.LightSettings {
+		s := &keylight.LightSettings{
+			PowerOnBehavior:     keylight.PowerOnDefaults,
+			PowerOnBrightness:   20,
+			PowerOnTemperature:  2900,
+			SwitchOnDuration:    100 * time.Millisecond,
+			SwitchOffDuration:   300 * time.Millisecond,
+			ColorChangeDuration: 150 * time.Millisecond,
+		}
+		if fn != nil {
+			fn(s)
+		}
+		return s
+	}
+
+	tests := []struct {
+		name     string
+		settings *keylight.LightSettings
+		body     string
+		check    func(t *testing.T, err error)
+	}{
+		{
+			name:     "OK",
+			settings: settings(nil),
+			body:     `{"powerOnBehavior":2,"powerOnBrightness":20,"powerOnTemperature":344,"switchOnDurationMs":100,"switchOffDurationMs":300,"colorChangeDurationMs":150}`,
+		},
+		{
+			name: "OK raw temperature",
+			settings: settings(func(s *keylight.LightSettings) {
+				s.PowerOnTemperature, s.PowerOnRawTemperature = 0, 291
+			}),
+			body: `{"powerOnBehavior":2,"powerOnBrightness":20,"powerOnTemperature":291,"switchOnDurationMs":100,"switchOffDurationMs":300,"colorChangeDurationMs":150}`,
+		},
+		{
+			name: "raw temperature outside of range",
+			settings: settings(func(s *keylight.LightSettings) {
+				s.PowerOnTemperature, s.PowerOnRawTemperature = 0, 345
+			}),
+			check: func(t *testing.T, err error) {
+				if !strings.Contains(err.Error(), "power on raw temperature (345) out of range 143 <= x <= 344") {
+					t.Fatalf("error did not mention malformed raw temperature input: %v", err)
+				}
+			},
+		},
+		{
+			name: "bad power on behavior",
+			settings: settings(func(s *keylight.LightSettings) {
+				s.PowerOnBehavior = 0
+			}),
+			check: func(t *testing.T, err error) {
+				if !strings.Contains(err.Error(), "power on behavior (0) is invalid") {
+					t.Fatalf("error did not mention malformed power on behavior: %v", err)
+				}
+			},
+		},
+		{
+			name: "temperature outside of range",
+			settings: settings(func(s *keylight.LightSettings) {
+				s.PowerOnTemperature = 7001
+			}),
+			check: func(t *testing.T, err error) {
+				if !strings.Contains(err.Error(), "power on temperature (7001) out of range 2900 <= x <= 7000") {
+					t.Fatalf("error did not mention malformed temperature input: %v", err)
+				}
+			},
+		},
+		{
+			name: "brightness outside of range",
+			settings: settings(func(s *keylight.LightSettings) {
+				s.PowerOnBrightness = 2
+			}),
+			check: func(t *testing.T, err error) {
+				if !strings.Contains(err.Error(), "power on brightness (2) out of range 3 <= x <= 100") {
+					t.Fatalf("error did not mention malformed brightness input: %v", err)
+				}
+			},
+		},
+		{
+			name: "negative duration",
+			settings: settings(func(s *keylight.LightSettings) {
+				s.SwitchOffDuration = -1 * time.Second
+			}),
+			check: func(t *testing.T, err error) {
+				if !strings.Contains(err.Error(), "switch off duration (-1s) must not be negative") {
+					t.Fatalf("error did not mention malformed duration input: %v", err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+			defer cancel()
+
+			var got string
+			c := testClient(t, func(_ http.ResponseWriter, r *http.Request) {
+				if diff := cmp.Diff(http.MethodPut, r.Method); diff != "" {
+					panicf("unexpected HTTP method (-want +got):\n%s", diff)
+				}
+
+				if diff := cmp.Diff("/elgato/lights/settings", r.URL.Path); diff != "" {
+					panicf("unexpected URL path (-want +got):\n%s", diff)
+				}
+
+				b, err := io.ReadAll(r.Body)
+				if err != nil {
+					panicf("failed to read body: %v", err)
+				}
+				got = string(b)
+			})
+
+			err := c.SetSettings(ctx, tt.settings)
+			if err == nil && tt.check != nil {
+				t.Fatal("an error was expected, but none occurred")
+			}
+			if err != nil {
+				if tt.check == nil {
+					t.Fatalf("failed to set settings: %v", err)
+				}
+
+				tt.check(t, err)
+				return
+			}
+
+			if diff := cmp.Diff(tt.body, got); diff != "" {
+				t.Fatalf("unexpected request body (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
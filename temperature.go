@@ -0,0 +1,53 @@
+package keylight
+
+import "math"
+
+// Constants used to convert between Kelvin and the native temperature units
+// of the Elgato API.
+const (
+	tempConstant   = 9900
+	tempCoefficent = 20.35
+	tempHalfstep   = 25
+	tempStep       = 50
+)
+
+// RawToKelvin converts a temperature in native Elgato API units to Kelvin,
+// rounded to the nearest 50K as displayed by Elgato's own software. Multiple
+// raw values may convert to the same Kelvin value.
+func RawToKelvin(raw int) int {
+	kelvin := tempConstant - int(math.Round(float64(raw)*tempCoefficent))
+	remainder := kelvin % tempStep
+	if remainder > tempHalfstep {
+		return kelvin + tempStep - remainder
+	}
+	return kelvin - remainder
+}
+
+// KelvinToRaw converts a temperature in Kelvin to the nearest temperature in
+// native Elgato API units. Kelvin values which are multiples of 50K convert
+// back to the same value using RawToKelvin.
+func KelvinToRaw(kelvin int) int {
+	return int(math.Round(float64(tempConstant-kelvin) / tempCoefficent))
+}
+
+// KelvinToMireds converts a temperature in Kelvin to mireds.
+func KelvinToMireds(kelvin int) float64 {
+	return 1e6 / float64(kelvin)
+}
+
+// MiredsToKelvin converts a temperature in mireds to the nearest Kelvin.
+func MiredsToKelvin(mireds float64) int {
+	return int(math.Round(1e6 / mireds))
+}
+
+// RawToMireds converts a temperature in native Elgato API units to mireds,
+// without the rounding applied by RawToKelvin.
+func RawToMireds(raw int) float64 {
+	return 1e6 / (tempConstant - float64(raw)*tempCoefficent)
+}
+
+// MiredsToRaw converts a temperature in mireds to the nearest temperature in
+// native Elgato API units.
+func MiredsToRaw(mireds float64) int {
+	return int(math.Round((tempConstant - 1e6/mireds) / tempCoefficent))
+}
@@ -0,0 +1,88 @@
+package keylight_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/keylight"
+)
+
+func TestTemperatureConversion(t *testing.T) {
+	tests := []struct {
+		kelvin, raw int
+	}{
+		{
+			kelvin: 2900,
+			raw:    344,
+		},
+		{
+			kelvin: 7000,
+			raw:    143,
+		},
+		{
+			kelvin: 3800,
+			raw:    300,
+		},
+		{
+			kelvin: 3750,
+			raw:    302,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%dK", tt.kelvin), func(t *testing.T) {
+			if diff := cmp.Diff(tt.kelvin, keylight.RawToKelvin(tt.raw)); diff != "" {
+				t.Fatalf("unexpected temperature Kelvin value (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tt.raw, keylight.KelvinToRaw(tt.kelvin)); diff != "" {
+				t.Fatalf("unexpected temperature raw value (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTemperatureRoundTrip(t *testing.T) {
+	// Every Kelvin value in 50K steps converts to raw units and back exactly.
+	for k := 2900; k <= 7000; k += 50 {
+		if diff := cmp.Diff(k, keylight.RawToKelvin(keylight.KelvinToRaw(k))); diff != "" {
+			t.Fatalf("unexpected Kelvin round trip (-want +got):\n%s", diff)
+		}
+	}
+
+	for raw := 143; raw <= 344; raw++ {
+		if diff := cmp.Diff(raw, keylight.MiredsToRaw(keylight.RawToMireds(raw))); diff != "" {
+			t.Fatalf("unexpected mireds round trip (-want +got):\n%s", diff)
+		}
+
+		// Lights which are read and written back without modification are
+		// unchanged, even though Kelvin values are rounded.
+		in := fmt.Sprintf(`{"on":1,"brightness":50,"temperature":%d}`, raw)
+
+		var l keylight.Light
+		if err := json.Unmarshal([]byte(in), &l); err != nil {
+			t.Fatalf("failed to unmarshal light: %v", err)
+		}
+
+		out, err := json.Marshal(&l)
+		if err != nil {
+			t.Fatalf("failed to marshal light: %v", err)
+		}
+
+		if diff := cmp.Diff(in, string(out)); diff != "" {
+			t.Fatalf("unexpected light JSON (-want +got):\n%s", diff)
+		}
+	}
+}
+
+func TestMireds(t *testing.T) {
+	if diff := cmp.Diff(200.0, keylight.KelvinToMireds(5000)); diff != "" {
+		t.Fatalf("unexpected mireds (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(2900, keylight.MiredsToKelvin(keylight.KelvinToMireds(2900))); diff != "" {
+		t.Fatalf("unexpected Kelvin (-want +got):\n%s", diff)
+	}
+}
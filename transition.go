@@ -0,0 +1,203 @@
+package keylight
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// transitionInterval is the interval between updates sent during a
+// Transition, which is paced to avoid overwhelming the device.
+const transitionInterval = 100 * time.Millisecond
+
+// An Easing determines how light values progress over the course of a
+// Transition.
+type Easing int
+
+// Possible Easing values for use with Transition.
+const (
+	// EaseLinear changes values at a constant rate.
+	EaseLinear Easing = iota
+
+	// EaseInOut changes values slowly at the beginning and end of a
+	// transition, and quickly in the middle.
+	EaseInOut
+
+	// EasePerceptual changes brightness at a constant perceived rate using
+	// the CIE 1976 lightness scale, and color temperature at a constant
+	// perceived rate using mireds.
+	EasePerceptual
+)
+
+// Transition smoothly changes the state of all lights on a Key Light device
+// from their current state to target over duration d, by sending paced
+// updates whose values are interpolated according to easing. The final update
+// applies target exactly.
+//
+// Lights which are off fade in from minimum brightness, and lights which are
+// turned off fade out to minimum brightness before turning off. Hue and
+// saturation are only interpolated when a light is in ColorModeHueSaturation
+// before and after the transition; otherwise its color changes immediately.
+//
+// Transition blocks until the transition completes or ctx is canceled, in
+// which case the lights are left in an intermediate state and ctx.Err() is
+// returned.
+func (c *Client) Transition(ctx context.Context, target []*Light, d time.Duration, easing Easing) error {
+	switch easing {
+	case EaseLinear, EaseInOut, EasePerceptual:
+	default:
+		return fmt.Errorf("easing (%d) is invalid", easing)
+	}
+
+	if err := validateLights(target); err != nil {
+		return err
+	}
+
+	steps := int(math.Ceil(float64(d) / float64(transitionInterval)))
+	if steps <= 1 {
+		return c.SetLights(ctx, target)
+	}
+
+	from, err := c.Lights(ctx)
+	if err != nil {
+		return err
+	}
+	if len(from) != len(target) {
+		return &LightCountError{
+			Configured: len(target),
+			Present:    len(from),
+		}
+	}
+
+	tick := time.NewTicker(d / time.Duration(steps))
+	defer tick.Stop()
+
+	var prev []*Light
+	for i := 1; i <= steps; i++ {
+		lights := target
+		if i < steps {
+			lights = interpolateLights(from, target, float64(i)/float64(steps), easing)
+		}
+
+		// Skip updates which would not change anything.
+		if !equalLights(prev, lights) {
+			if err := c.SetLights(ctx, lights); err != nil {
+				return err
+			}
+			prev = lights
+		}
+
+		if i == steps {
+			break
+		}
+
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+// interpolateLights produces the state of lights at progress t between from
+// and to, where 0 <= t <= 1.
+func interpolateLights(from, to []*Light, t float64, easing Easing) []*Light {
+	if easing == EaseInOut {
+		// Smoothstep.
+		t = t * t * (3 - 2*t)
+	}
+
+	out := make([]*Light, 0, len(to))
+	for i := range to {
+		a, b := *from[i], *to[i]
+
+		// Fade in from and out to minimum brightness.
+		if !a.On {
+			a.Brightness = BrightnessMin
+		}
+		if !b.On {
+			b.Brightness = BrightnessMin
+		}
+
+		l := &Light{
+			// Lights remain on for the duration of the transition if they are
+			// on at either end.
+			On:   a.On || b.On,
+			Mode: b.Mode,
+		}
+
+		if easing == EasePerceptual {
+			l.Brightness = int(math.Round(fromLightness(lerp(toLightness(a.Brightness), toLightness(b.Brightness), t))))
+		} else {
+			l.Brightness = int(math.Round(lerp(float64(a.Brightness), float64(b.Brightness), t)))
+		}
+
+		switch {
+		case b.Mode == ColorModeTemperature && a.Mode == ColorModeTemperature:
+			// Interpolate in API units, which are linear in Kelvin, so that
+			// lights which only specify a raw temperature are supported.
+			ra, rb := a.rawTemperature(), b.rawTemperature()
+			if easing == EasePerceptual {
+				l.RawTemperature = MiredsToRaw(lerp(RawToMireds(ra), RawToMireds(rb), t))
+			} else {
+				l.RawTemperature = int(math.Round(lerp(float64(ra), float64(rb), t)))
+			}
+			l.Temperature = RawToKelvin(l.RawTemperature)
+		case b.Mode == ColorModeHueSaturation && a.Mode == ColorModeHueSaturation:
+			// Take the shortest path around the color wheel.
+			dh := math.Mod(b.Hue-a.Hue+540, 360) - 180
+			l.Hue = math.Mod(a.Hue+dh*t+360, 360)
+			l.Saturation = lerp(a.Saturation, b.Saturation, t)
+		default:
+			// Color modes differ, change color immediately.
+			l.Temperature, l.RawTemperature = b.Temperature, b.RawTemperature
+			l.Hue, l.Saturation = b.Hue, b.Saturation
+		}
+
+		out = append(out, l)
+	}
+
+	return out
+}
+
+// equalLights reports whether a and b contain the same light states.
+func equalLights(a, b []*Light) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if *a[i] != *b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// lerp linearly interpolates between a and b at t.
+func lerp(a, b, t float64) float64 {
+	return a + (b-a)*t
+}
+
+// toLightness converts a brightness percentage to CIE 1976 lightness (L*).
+func toLightness(brightness int) float64 {
+	y := float64(brightness) / 100
+	if y <= 216.0/24389 {
+		return y * 24389 / 27
+	}
+
+	return 116*math.Cbrt(y) - 16
+}
+
+// fromLightness converts CIE 1976 lightness (L*) to a brightness percentage.
+func fromLightness(l float64) float64 {
+	if l <= 8 {
+		return l * 27 / 24389 * 100
+	}
+
+	return math.Pow((l+16)/116, 3) * 100
+}
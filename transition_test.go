@@ -0,0 +1,254 @@
+package keylight_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/keylight"
+	"github.com/mdlayher/keylight/keylighttest"
+)
+
+func TestClientTransition(t *testing.T) {
+	tests := []struct {
+		name   string
+		from   *keylight.Light
+		to     *keylight.Light
+		easing keylight.Easing
+		want   []*keylight.Light
+	}{
+		{
+			name:   "linear",
+			from:   &keylight.Light{On: true, Brightness: 10, Temperature: 3000},
+			to:     &keylight.Light{On: true, Brightness: 70, Temperature: 6000},
+			easing: keylight.EaseLinear,
+			want: []*keylight.Light{
+				{On: true, Brightness: 30, Temperature: 4000},
+				{On: true, Brightness: 50, Temperature: 5000},
+				{On: true, Brightness: 70, Temperature: 6000},
+			},
+		},
+		{
+			name:   "ease in out",
+			from:   &keylight.Light{On: true, Brightness: 10, Temperature: 3000},
+			to:     &keylight.Light{On: true, Brightness: 90, Temperature: 3000},
+			easing: keylight.EaseInOut,
+			want: []*keylight.Light{
+				{On: true, Brightness: 23, Temperature: 3000},
+				{On: true, Brightness: 50, Temperature: 3000},
+				{On: true, Brightness: 78, Temperature: 3000},
+				{On: true, Brightness: 90, Temperature: 3000},
+			},
+		},
+		{
+			name:   "perceptual fade in",
+			from:   &keylight.Light{On: false, Brightness: 80, Temperature: 3000},
+			to:     &keylight.Light{On: true, Brightness: 100, Temperature: 3000},
+			easing: keylight.EasePerceptual,
+			want: []*keylight.Light{
+				// Perceptual brightness changes slowly at low levels.
+				{On: true, Brightness: 28, Temperature: 3000},
+				{On: true, Brightness: 100, Temperature: 3000},
+			},
+		},
+		{
+			name:   "fade out",
+			from:   &keylight.Light{On: true, Brightness: 43, Temperature: 3000},
+			to:     &keylight.Light{On: false, Brightness: 43, Temperature: 3000},
+			easing: keylight.EaseLinear,
+			want: []*keylight.Light{
+				{On: true, Brightness: 23, Temperature: 3000},
+				{On: false, Brightness: 43, Temperature: 3000},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+
+			_, c, updates := testTransitionClient(t, tt.from)
+
+			d := time.Duration(len(tt.want)) * 100 * time.Millisecond
+			if err := c.Transition(ctx, []*keylight.Light{tt.to}, d, tt.easing); err != nil {
+				t.Fatalf("failed to transition: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.want, updates(), ignoreRaw); diff != "" {
+				t.Fatalf("unexpected updates (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestClientTransitionHue(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	_, c, updates := testTransitionClient(t, &keylight.Light{
+		On:         true,
+		Brightness: 50,
+		Mode:       keylight.ColorModeHueSaturation,
+		Hue:        350,
+		Saturation: 100,
+	}, &keylighttest.LightStrip)
+
+	target := &keylight.Light{
+		On:         true,
+		Brightness: 50,
+		Mode:       keylight.ColorModeHueSaturation,
+		Hue:        30,
+		Saturation: 50,
+	}
+
+	if err := c.Transition(ctx, []*keylight.Light{target}, 200*time.Millisecond, keylight.EaseLinear); err != nil {
+		t.Fatalf("failed to transition: %v", err)
+	}
+
+	// The hue wraps around the color wheel rather than passing through all
+	// other colors.
+	want := []*keylight.Light{
+		{On: true, Brightness: 50, Mode: keylight.ColorModeHueSaturation, Hue: 10, Saturation: 75},
+		target,
+	}
+
+	if diff := cmp.Diff(want, updates(), ignoreRaw); diff != "" {
+		t.Fatalf("unexpected updates (-want +got):\n%s", diff)
+	}
+}
+
+func TestClientTransitionRaw(t *testing.T) {
+	tests := []struct {
+		name   string
+		easing keylight.Easing
+		want   []int
+	}{
+		{
+			name:   "linear",
+			easing: keylight.EaseLinear,
+			want:   []int{225, 250, 275, 300},
+		},
+		{
+			name:   "perceptual",
+			easing: keylight.EasePerceptual,
+			want:   []int{234, 261, 282, 300},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+
+			_, c, updates := testTransitionClient(t, &keylight.Light{On: true, Brightness: 50, RawTemperature: 200})
+
+			// Lights which only specify a raw temperature are interpolated in
+			// API units.
+			target := []*keylight.Light{{On: true, Brightness: 50, RawTemperature: 300}}
+			if err := c.Transition(ctx, target, 400*time.Millisecond, tt.easing); err != nil {
+				t.Fatalf("failed to transition: %v", err)
+			}
+
+			var got []int
+			for _, l := range updates() {
+				got = append(got, l.RawTemperature)
+			}
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Fatalf("unexpected raw temperatures (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestClientTransitionCanceled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+
+	_, c, updates := testTransitionClient(t, &keylight.Light{On: true, Brightness: 10, Temperature: 3000})
+
+	err := c.Transition(ctx, []*keylight.Light{{On: true, Brightness: 100, Temperature: 3000}},
+		10*time.Second, keylight.EaseLinear)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context deadline exceeded, but got: %v", err)
+	}
+
+	if n := len(updates()); n == 0 || n > 3 {
+		t.Fatalf("unexpected number of updates: %d", n)
+	}
+}
+
+func TestClientTransitionErrors(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	_, c, updates := testTransitionClient(t, &keylight.Light{On: true, Brightness: 10, Temperature: 3000})
+
+	light := &keylight.Light{On: true, Brightness: 10, Temperature: 3000}
+
+	var rerr *keylight.RangeError
+	err := c.Transition(ctx, []*keylight.Light{{Brightness: 101, Temperature: 3000}}, time.Second, keylight.EaseLinear)
+	if !errors.As(err, &rerr) {
+		t.Fatalf("expected range error, but got: %v", err)
+	}
+
+	var lerr *keylight.LightCountError
+	err = c.Transition(ctx, []*keylight.Light{light, light}, time.Second, keylight.EaseLinear)
+	if !errors.As(err, &lerr) {
+		t.Fatalf("expected light count error, but got: %v", err)
+	}
+
+	if err := c.Transition(ctx, []*keylight.Light{light}, time.Second, 10); err == nil {
+		t.Fatal("expected invalid easing error, but none occurred")
+	}
+
+	if n := len(updates()); n != 0 {
+		t.Fatalf("expected no updates, but got %d", n)
+	}
+}
+
+// testTransitionClient creates a client connected to an emulated device with
+// a single light in state l. The returned function reports the state of the
+// light after each update.
+func testTransitionClient(t *testing.T, l *keylight.Light, p ...*keylighttest.Profile) (*keylighttest.Device, *keylight.Client, func() []*keylight.Light) {
+	t.Helper()
+
+	cfg := &keylighttest.Config{Lights: []*keylight.Light{l}}
+	if len(p) > 0 {
+		cfg.Profile = p[0]
+	}
+	d := keylighttest.NewDevice(cfg)
+
+	var (
+		mu      sync.Mutex
+		updates []*keylight.Light
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d.ServeHTTP(w, r)
+
+		if r.Method == http.MethodPut && r.URL.Path == "/elgato/lights" {
+			mu.Lock()
+			defer mu.Unlock()
+			updates = append(updates, d.Lights()...)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	c, err := keylight.NewClient(srv.URL, nil)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	return d, c, func() []*keylight.Light {
+		mu.Lock()
+		defer mu.Unlock()
+		return updates
+	}
+}
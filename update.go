@@ -0,0 +1,157 @@
+package keylight
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+var _ json.Marshaler = &LightUpdate{}
+
+// A LightUpdate is a partial update to the state of a single light on a Key
+// Light device. Only the fields which are set are sent to the device, so the
+// light's other attributes are left unchanged.
+type LightUpdate struct {
+	// Index is the index of the light to update, as returned by Lights.
+	Index int
+
+	// On, if set, turns the light on or off.
+	On *bool
+
+	// Brightness, if set, is the light's brightness level with a valid range
+	// of 3-100.
+	Brightness *int
+
+	// Temperature, if set, is the light's color temperature with a valid range
+	// of 2900-7000K. Setting a temperature switches the light to
+	// ColorModeTemperature.
+	Temperature *int
+
+	// Hue and Saturation, if set, are the light's hue in degrees and color
+	// saturation with valid ranges of 0-360 and 0-100. Setting either switches
+	// the light to ColorModeHueSaturation, and they must not be combined with
+	// Temperature.
+	Hue, Saturation *float64
+}
+
+// MarshalJSON implements json.Marshaler.
+func (u *LightUpdate) MarshalJSON() ([]byte, error) {
+	var jl struct {
+		On          *int     `json:"on,omitempty"`
+		Brightness  *int     `json:"brightness,omitempty"`
+		Temperature *int     `json:"temperature,omitempty"`
+		Hue         *float64 `json:"hue,omitempty"`
+		Saturation  *float64 `json:"saturation,omitempty"`
+	}
+
+	if u.On != nil {
+		on := boolToInt(*u.On)
+		jl.On = &on
+	}
+	if u.Temperature != nil {
+		// The API has its own format but Kelvin is more friendly for users.
+		temp := KelvinToRaw(*u.Temperature)
+		jl.Temperature = &temp
+	}
+	jl.Brightness, jl.Hue, jl.Saturation = u.Brightness, u.Hue, u.Saturation
+
+	return json.Marshal(jl)
+}
+
+// validate verifies that all of the fields set in u are within their valid
+// ranges.
+func (u *LightUpdate) validate() error {
+	if u.Index < 0 {
+		return fmt.Errorf("light index (%d) must not be negative", u.Index)
+	}
+
+	if u.Brightness != nil {
+		if err := checkRange("brightness", *u.Brightness, BrightnessMin, BrightnessMax); err != nil {
+			return err
+		}
+	}
+
+	if u.Temperature != nil {
+		if u.Hue != nil || u.Saturation != nil {
+			return fmt.Errorf("light %d: temperature cannot be combined with hue or saturation", u.Index)
+		}
+
+		if err := checkRange("temperature", *u.Temperature, TemperatureMin, TemperatureMax); err != nil {
+			return err
+		}
+	}
+
+	if u.Hue != nil {
+		if err := checkRange("hue", *u.Hue, HueMin, HueMax); err != nil {
+			return err
+		}
+	}
+
+	if u.Saturation != nil {
+		if err := checkRange("saturation", *u.Saturation, SaturationMin, SaturationMax); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UpdateLights applies partial updates to one or more lights on a Key Light
+// device in a single request. Unlike SetLights, only the fields set in each
+// LightUpdate are sent to the device, so concurrent changes to other
+// attributes or other lights made by another controller are not overwritten.
+//
+// UpdateLights returns the state of all lights as reported by the device after
+// applying the updates.
+func (c *Client) UpdateLights(ctx context.Context, updates ...*LightUpdate) ([]*Light, error) {
+	var n int
+	seen := make(map[int]bool, len(updates))
+	for _, u := range updates {
+		if err := u.validate(); err != nil {
+			return nil, err
+		}
+		if seen[u.Index] {
+			return nil, fmt.Errorf("light %d is updated more than once", u.Index)
+		}
+		seen[u.Index] = true
+
+		if u.Index >= n {
+			n = u.Index + 1
+		}
+	}
+
+	// Lights which are not being updated are sent as empty objects so that
+	// each update is applied to the light at its index.
+	body := struct {
+		Lights []*LightUpdate `json:"lights"`
+	}{Lights: make([]*LightUpdate, n)}
+
+	for i := range body.Lights {
+		body.Lights[i] = &LightUpdate{Index: i}
+	}
+	for _, u := range updates {
+		body.Lights[u.Index] = u
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	var out lightsBody
+	if err := c.do(ctx, http.MethodPut, "/elgato/lights", b, &out); err != nil {
+		return nil, err
+	}
+
+	// As with SetLights, attempting to update a light which does not exist is
+	// treated as an error.
+	if len(out.Lights) < n {
+		return nil, &LightCountError{
+			Configured: n,
+			Present:    len(out.Lights),
+		}
+	}
+
+	return out.Lights, nil
+}
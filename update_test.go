@@ -0,0 +1,158 @@
+package keylight_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/keylight"
+	"github.com/mdlayher/keylight/keylighttest"
+)
+
+func TestClientUpdateLightsBody(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if diff := cmp.Diff(http.MethodPut, r.Method); diff != "" {
+			panicf("unexpected HTTP method (-want +got):\n%s", diff)
+		}
+
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			panicf("failed to read body: %v", err)
+		}
+
+		// Only the fields being changed are sent, and light 0 is skipped.
+		const want = `{"lights":[{},{"on":0,"temperature":241}]}`
+		if diff := cmp.Diff(want, string(b)); diff != "" {
+			panicf("unexpected request body (-want +got):\n%s", diff)
+		}
+
+		_, _ = io.WriteString(w, `{"numberOfLights":2,"lights":[{"on":1,"brightness":20,"temperature":213},{"on":0,"brightness":40,"temperature":241}]}`)
+	})
+
+	lights, err := c.UpdateLights(ctx, &keylight.LightUpdate{
+		Index:       1,
+		On:          boolp(false),
+		Temperature: intp(5000),
+	})
+	if err != nil {
+		t.Fatalf("failed to update lights: %v", err)
+	}
+
+	want := []*keylight.Light{
+		{On: true, Brightness: 20, Temperature: 5550},
+		{On: false, Brightness: 40, Temperature: 5000},
+	}
+
+	if diff := cmp.Diff(want, lights, ignoreRaw); diff != "" {
+		t.Fatalf("unexpected lights (-want +got):\n%s", diff)
+	}
+}
+
+func TestClientUpdateLightsPreservesState(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	d := keylighttest.NewDevice(&keylighttest.Config{
+		Profile: &keylighttest.LightStrip,
+		Lights: []*keylight.Light{
+			{On: true, Brightness: 20, Temperature: 4700},
+			{On: true, Brightness: 30, Mode: keylight.ColorModeHueSaturation, Hue: 120, Saturation: 50},
+		},
+	})
+	srv := httptest.NewServer(d)
+	defer srv.Close()
+
+	c, err := keylight.New(srv.URL)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	_, err = c.UpdateLights(ctx,
+		&keylight.LightUpdate{Index: 0, Brightness: intp(80)},
+		&keylight.LightUpdate{Index: 1, Hue: floatp(240)},
+	)
+	if err != nil {
+		t.Fatalf("failed to update lights: %v", err)
+	}
+
+	want := []*keylight.Light{
+		{On: true, Brightness: 80, Temperature: 4700},
+		{On: true, Brightness: 30, Mode: keylight.ColorModeHueSaturation, Hue: 240, Saturation: 50},
+	}
+
+	if diff := cmp.Diff(want, d.Lights(), ignoreRaw); diff != "" {
+		t.Fatalf("unexpected lights (-want +got):\n%s", diff)
+	}
+}
+
+func TestClientUpdateLightsErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		updates []*keylight.LightUpdate
+		err     string
+	}{
+		{
+			name:    "negative index",
+			updates: []*keylight.LightUpdate{{Index: -1, On: boolp(true)}},
+			err:     "light index (-1) must not be negative",
+		},
+		{
+			name: "duplicate index",
+			updates: []*keylight.LightUpdate{
+				{Index: 0, On: boolp(true)},
+				{Index: 0, Brightness: intp(10)},
+			},
+			err: "light 0 is updated more than once",
+		},
+		{
+			name:    "brightness outside of range",
+			updates: []*keylight.LightUpdate{{Brightness: intp(101)}},
+			err:     "brightness (101) out of range 3 <= x <= 100",
+		},
+		{
+			name:    "temperature outside of range",
+			updates: []*keylight.LightUpdate{{Temperature: intp(2899)}},
+			err:     "temperature (2899) out of range 2900 <= x <= 7000",
+		},
+		{
+			name:    "temperature and hue",
+			updates: []*keylight.LightUpdate{{Temperature: intp(5000), Hue: floatp(10)}},
+			err:     "light 0: temperature cannot be combined with hue or saturation",
+		},
+		{
+			name:    "light not present",
+			updates: []*keylight.LightUpdate{{Index: 1, On: boolp(true)}},
+			err:     "attempted to configure 2 lights, but 1 are present",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			_, c := testDeviceClient(t)
+
+			_, err := c.UpdateLights(ctx, tt.updates...)
+			if err == nil {
+				t.Fatal("an error was expected, but none occurred")
+			}
+
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func boolp(b bool) *bool        { return &b }
+func intp(i int) *int           { return &i }
+func floatp(f float64) *float64 { return &f }
@@ -0,0 +1,234 @@
+package keylight
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Polling intervals used by Watch.
+const (
+	// defaultWatchInterval is used when the caller's interval is not
+	// positive.
+	defaultWatchInterval = 1 * time.Second
+
+	// maxWatchBackoff is the maximum polling interval used while a device is
+	// unreachable, unless the caller's interval is longer.
+	maxWatchBackoff = 1 * time.Minute
+)
+
+// An EventKind is the kind of change reported by an Event.
+type EventKind int
+
+// Possible EventKind values reported by Watch.
+const (
+	// Light events: Event.Light, Event.Old, and Event.New are set.
+	EventPower EventKind = iota
+	EventBrightness
+	EventTemperature
+	EventColor
+
+	// EventDisplayName indicates the device's display name changed.
+	// Event.Device is set.
+	EventDisplayName
+
+	// EventUnreachable indicates the device could not be polled. Event.Err is
+	// set.
+	EventUnreachable
+
+	// EventReachable indicates the device could be polled again after it was
+	// unreachable. Event.Device is set.
+	EventReachable
+)
+
+// String returns the string representation of an EventKind.
+func (k EventKind) String() string {
+	switch k {
+	case EventPower:
+		return "power"
+	case EventBrightness:
+		return "brightness"
+	case EventTemperature:
+		return "temperature"
+	case EventColor:
+		return "color"
+	case EventDisplayName:
+		return "display name"
+	case EventUnreachable:
+		return "unreachable"
+	case EventReachable:
+		return "reachable"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(k))
+	}
+}
+
+// An Event is a change in the state of a Key Light device observed by Watch.
+type Event struct {
+	// Kind is the kind of change.
+	Kind EventKind
+
+	// Time is the time at which the change was observed.
+	Time time.Time
+
+	// Light is the index of the light which changed, and Old and New are its
+	// previous and current states.
+	Light    int
+	Old, New *Light
+
+	// Device is the current accessory information of the device.
+	Device *Device
+
+	// Err is the error which occurred while polling an unreachable device.
+	Err error
+}
+
+// Watch polls a Key Light device at approximately the specified interval and
+// reports changes to its lights, display name, and reachability as Events.
+// Each polling interval is randomly adjusted by up to 10% so that many
+// watchers do not poll in lockstep, and polling backs off exponentially while
+// the device is unreachable.
+//
+// If interval is not positive, the device is polled every second. The first
+// successful poll establishes the initial state of the device and does not
+// produce Events. The returned channel is closed when ctx is canceled.
+func (c *Client) Watch(ctx context.Context, interval time.Duration) <-chan *Event {
+	events := make(chan *Event)
+
+	go func() {
+		defer close(events)
+
+		var (
+			w        watcher
+			failures int
+		)
+
+		for {
+			evs, err := w.poll(ctx, c)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				failures++
+			} else {
+				failures = 0
+			}
+
+			for _, e := range evs {
+				select {
+				case events <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			t := time.NewTimer(watchDelay(interval, failures))
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+				return
+			}
+		}
+	}()
+
+	return events
+}
+
+// watchDelay computes the delay before the next poll, applying jitter and
+// exponential backoff after consecutive failures.
+func watchDelay(interval time.Duration, failures int) time.Duration {
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+
+	d := interval
+	if failures > 0 {
+		maxDelay := max(interval, maxWatchBackoff)
+		for i := 0; i < failures && d < maxDelay; i++ {
+			d *= 2
+		}
+		d = min(d, maxDelay)
+	}
+
+	// Jitter by +/- 10%.
+	if j := int64(d) / 5; j > 0 {
+		d += time.Duration(rand.Int63n(j+1) - j/2)
+	}
+
+	return d
+}
+
+// A watcher tracks the state of a device between polls.
+type watcher struct {
+	device      *Device
+	lights      []*Light
+	unreachable bool
+}
+
+// poll fetches the current state of a device and reports any changes since
+// the previous poll.
+func (w *watcher) poll(ctx context.Context, c *Client) ([]*Event, error) {
+	now := time.Now()
+
+	d, err := c.AccessoryInfo(ctx)
+	var lights []*Light
+	if err == nil {
+		lights, err = c.Lights(ctx)
+	}
+	if err != nil {
+		if w.unreachable || ctx.Err() != nil {
+			// Already reported.
+			return nil, err
+		}
+
+		w.unreachable = true
+		return []*Event{{Kind: EventUnreachable, Time: now, Err: err}}, err
+	}
+
+	var events []*Event
+	if w.unreachable {
+		w.unreachable = false
+		events = append(events, &Event{Kind: EventReachable, Time: now, Device: d})
+	}
+
+	if w.device == nil {
+		// Initial state.
+		w.device, w.lights = d, lights
+		return events, nil
+	}
+
+	if d.DisplayName != w.device.DisplayName {
+		events = append(events, &Event{Kind: EventDisplayName, Time: now, Device: d})
+	}
+
+	for i, l := range lights {
+		if i >= len(w.lights) {
+			break
+		}
+		old := w.lights[i]
+
+		light := func(k EventKind) *Event {
+			return &Event{Kind: k, Time: now, Light: i, Old: old, New: l, Device: d}
+		}
+
+		if l.On != old.On {
+			events = append(events, light(EventPower))
+		}
+		if l.Brightness != old.Brightness {
+			events = append(events, light(EventBrightness))
+		}
+		if l.Mode != old.Mode || l.Hue != old.Hue || l.Saturation != old.Saturation {
+			if l.Mode == ColorModeHueSaturation || old.Mode == ColorModeHueSaturation {
+				events = append(events, light(EventColor))
+			}
+		}
+		if l.Temperature != old.Temperature && l.Mode == ColorModeTemperature {
+			events = append(events, light(EventTemperature))
+		}
+	}
+
+	w.device, w.lights = d, lights
+	return events, nil
+}
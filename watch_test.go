@@ -0,0 +1,159 @@
+package keylight_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/keylight"
+	"github.com/mdlayher/keylight/keylighttest"
+)
+
+func TestClientWatch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	d, c := testDeviceClient(t)
+
+	// Fail the initial poll so the watcher reports reachability once its
+	// initial state is established.
+	d.InjectFault(keylighttest.Fault{
+		Path:       "/elgato/accessory-info",
+		StatusCode: http.StatusInternalServerError,
+	})
+
+	events := c.Watch(ctx, 5*time.Millisecond)
+
+	e := <-events
+	if diff := cmp.Diff(keylight.EventUnreachable, e.Kind); diff != "" {
+		t.Fatalf("unexpected event kind (-want +got):\n%s", diff)
+	}
+
+	var herr *keylight.HTTPError
+	if !errors.As(e.Err, &herr) {
+		t.Fatalf("expected *keylight.HTTPError, but got: %v", e.Err)
+	}
+
+	e = <-events
+	if diff := cmp.Diff(keylight.EventReachable, e.Kind); diff != "" {
+		t.Fatalf("unexpected event kind (-want +got):\n%s", diff)
+	}
+
+	// Change the device's state as another user would.
+	want := &keylight.Light{On: true, Brightness: 50, Temperature: 4000}
+	if err := c.SetLights(ctx, []*keylight.Light{want}); err != nil {
+		t.Fatalf("failed to set lights: %v", err)
+	}
+	if err := c.SetDisplayName(ctx, "Studio"); err != nil {
+		t.Fatalf("failed to set display name: %v", err)
+	}
+
+	var kinds []keylight.EventKind
+	for len(kinds) < 4 {
+		select {
+		case e := <-events:
+			kinds = append(kinds, e.Kind)
+
+			switch e.Kind {
+			case keylight.EventDisplayName:
+				if diff := cmp.Diff("Studio", e.Device.DisplayName); diff != "" {
+					t.Fatalf("unexpected display name (-want +got):\n%s", diff)
+				}
+			default:
+				if diff := cmp.Diff(want, e.New, ignoreRaw); diff != "" {
+					t.Fatalf("unexpected new light (-want +got):\n%s", diff)
+				}
+			}
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for events: %v", kinds)
+		}
+	}
+
+	sort.Slice(kinds, func(i, j int) bool { return kinds[i] < kinds[j] })
+
+	wantKinds := []keylight.EventKind{
+		keylight.EventPower,
+		keylight.EventBrightness,
+		keylight.EventTemperature,
+		keylight.EventDisplayName,
+	}
+
+	if diff := cmp.Diff(wantKinds, kinds); diff != "" {
+		t.Fatalf("unexpected event kinds (-want +got):\n%s", diff)
+	}
+
+	// The channel is closed once the context is canceled.
+	cancel()
+	for range events {
+	}
+}
+
+func TestWatchDelay(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		failures int
+		min, max time.Duration
+	}{
+		{
+			name:     "jitter",
+			interval: time.Second,
+			min:      900 * time.Millisecond,
+			max:      1100 * time.Millisecond,
+		},
+		{
+			name:     "backoff",
+			interval: time.Second,
+			failures: 3,
+			min:      7200 * time.Millisecond,
+			max:      8800 * time.Millisecond,
+		},
+		{
+			name:     "maximum backoff",
+			interval: time.Second,
+			failures: 10,
+			min:      54 * time.Second,
+			max:      66 * time.Second,
+		},
+		{
+			name:     "interval exceeds maximum backoff",
+			interval: 2 * time.Minute,
+			failures: 5,
+			min:      108 * time.Second,
+			max:      132 * time.Second,
+		},
+		{
+			name: "zero interval",
+			min:  900 * time.Millisecond,
+			max:  1100 * time.Millisecond,
+		},
+		{
+			name:     "negative interval",
+			interval: -time.Second,
+			failures: 1,
+			min:      1800 * time.Millisecond,
+			max:      2200 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen := make(map[time.Duration]bool)
+			for i := 0; i < 100; i++ {
+				d := keylight.WatchDelay(tt.interval, tt.failures)
+				if d < tt.min || d > tt.max {
+					t.Fatalf("delay %v is outside of range [%v, %v]", d, tt.min, tt.max)
+				}
+				seen[d] = true
+			}
+
+			if len(seen) < 2 {
+				t.Fatal("delay was not jittered")
+			}
+		})
+	}
+}
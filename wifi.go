@@ -23,6 +23,14 @@ type WiFiInfo struct {
 	SecurityType WiFiSecurity `json:"securityType,omitempty"`
 }
 
+// A WiFiStatus contains information about a Key Light's current wireless
+// network connection.
+type WiFiStatus struct {
+	SSID         string `json:"ssid,omitempty"`
+	FrequencyMHz int    `json:"frequencyMHz,omitempty"`
+	RSSI         int    `json:"rssi,omitempty"`
+}
+
 // WiFiSecurity is the security type of the wireless network.
 //
 // The Elgato Key Light supports none, WEP, and WPA/WPA2 Personal
@@ -64,7 +72,7 @@ func (c *Client) SetWiFiInfo(ctx context.Context, wifi *WiFiInfo, device *Device
 	mode := cipher.NewCBCEncrypter(block, iv)
 	mode.CryptBlocks(ciphertext[aes.BlockSize:], plaintext)
 
-	return c.do(ctx, http.MethodPut, pathWiFiInfo, bytes.NewReader(ciphertext), nil)
+	return c.do(ctx, http.MethodPut, pathWiFiInfo, ciphertext, nil)
 }
 
 // aesKey returns the AES key based on the device's board type and firmware